@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/pismo/istiops/pkg/logger"
+	istiOperator "github.com/pismo/istiops/pkg/operator"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pismo/istiops/pkg/spec"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	applyCmd.PersistentFlags().StringP("filename", "f", "", "* traffic spec file to be applied")
+	applyCmd.PersistentFlags().Bool("dry-run", false, "print the diff of istio' resources instead of applying it")
+
+	_ = applyCmd.MarkPersistentFlagRequired("filename")
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Reconciles istio's traffic to a declarative traffic spec file",
+	Run: func(cmd *cobra.Command, args []string) {
+		kubeContext, _ := rootCmd.Flags().GetString("context")
+		kubeConfigPath, _ := rootCmd.Flags().GetString("kubeconfig")
+		clientSetup(kubeContext, kubeConfigPath)
+
+		s, err := spec.Load(cmd.Flag("filename").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		// every shift is validated before any resource is touched
+		var planned []plannedShift
+		for i, shiftSpec := range s.Shifts {
+			p, err := planShift(s, shiftSpec, dryRun)
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("shifts[%d]: %s", i, err), "cmd")
+			}
+			planned = append(planned, p)
+		}
+
+		// a failed shift is reverted by its operator's transaction, the following ones are still applied
+		var failed []string
+		for _, p := range planned {
+			if p.spec.Drained() {
+				continue
+			}
+
+			err := applyChanges(p, dryRun, func() error {
+				return p.op.Update(p.shift)
+			})
+			if err != nil {
+				logger.Error(fmt.Sprintf("could not apply destination '%s': %s", p.spec.Destination, err), trackingId)
+				failed = append(failed, p.spec.Destination)
+			}
+		}
+
+		// routes of builds which are drained or no longer in the spec are removed from each destination
+		for _, group := range groupShifts(planned) {
+			keep, drain := group.subsets()
+			p := group[0]
+			err := applyChanges(p, dryRun, func() error {
+				return p.op.Prune(p.shift, keep, drain)
+			})
+			if err != nil {
+				logger.Error(fmt.Sprintf("could not prune destination '%s': %s", p.spec.Destination, err), trackingId)
+				failed = append(failed, p.spec.Destination)
+			}
+		}
+
+		if len(failed) > 0 {
+			logger.Fatal(fmt.Sprintf("%d of %d shifts failed: %s", len(failed), len(planned), strings.Join(failed, ", ")), "cmd")
+		}
+	},
+}
+
+// plannedShift is a validated shift of a traffic spec, along with the operator which applies it
+type plannedShift struct {
+	spec      spec.ShiftSpec
+	shift     router.Shift
+	namespace string
+	subset    string
+	op        *istiOperator.Istiops
+}
+
+// planShift builds the operator of a shift spec, validating the shift against its routers
+func planShift(s *spec.Spec, shiftSpec spec.ShiftSpec, dryRun bool) (plannedShift, error) {
+	shift, err := shiftSpec.Shift()
+	if err != nil {
+		return plannedShift{}, err
+	}
+
+	masterRoute, err := router.ParseMasterRoute(shiftSpec.MasterRoute)
+	if err != nil {
+		return plannedShift{}, err
+	}
+
+	drR := &router.DestinationRule{
+		TrackingId: trackingId,
+		Name:       shift.Hostname,
+		Namespace:  s.NamespaceOf(shiftSpec),
+		Build:      shiftSpec.Build,
+		Istio:      clients.Istio,
+		KubeClient: clients.Kubernetes,
+		Audit:      auditOf(clients),
+		DryRun:     dryRun,
+		DiffOutput: os.Stdout,
+	}
+
+	vsR := &router.VirtualService{
+		TrackingId:  trackingId,
+		Name:        shift.Hostname,
+		Namespace:   s.NamespaceOf(shiftSpec),
+		Build:       shiftSpec.Build,
+		Istio:       clients.Istio,
+		KubeClient:  clients.Kubernetes,
+		Audit:       auditOf(clients),
+		DryRun:      dryRun,
+		DiffOutput:  os.Stdout,
+		MasterRoute: masterRoute,
+		Reconcile:   true,
+	}
+
+	// drained shifts are only pruned, they're never shifted to
+	if !shiftSpec.Drained() {
+		err = drR.Validate(shift)
+		if err != nil {
+			return plannedShift{}, err
+		}
+
+		err = vsR.Validate(shift)
+		if err != nil {
+			return plannedShift{}, err
+		}
+	}
+
+	return plannedShift{
+		spec:      shiftSpec,
+		shift:     shift,
+		namespace: s.NamespaceOf(shiftSpec),
+		subset:    router.SubsetName(shift.Hostname, shiftSpec.Build, s.NamespaceOf(shiftSpec)),
+		op:        &istiOperator.Istiops{DrRouter: drR, VsRouter: vsR, DryRun: dryRun},
+	}, nil
+}
+
+// shiftGroup are the planned shifts of the same destination and label-selector
+type shiftGroup []plannedShift
+
+// groupShifts groups planned shifts by destination and label-selector, in the order of the spec
+func groupShifts(planned []plannedShift) []shiftGroup {
+	var groups []shiftGroup
+	for _, p := range planned {
+		grouped := false
+		for i, group := range groups {
+			first := group[0]
+			if first.shift.Hostname == p.shift.Hostname && first.namespace == p.namespace && reflect.DeepEqual(first.shift.Selector, p.shift.Selector) {
+				groups[i] = append(group, p)
+				grouped = true
+				break
+			}
+		}
+
+		if !grouped {
+			groups = append(groups, shiftGroup{p})
+		}
+	}
+
+	return groups
+}
+
+// subsets returns the subsets which keep their routes and the drained ones of a group
+func (g shiftGroup) subsets() ([]string, []string) {
+	var keep, drain []string
+	for _, p := range g {
+		if p.spec.Drained() {
+			drain = append(drain, p.subset)
+			continue
+		}
+
+		keep = append(keep, p.subset)
+		for subset := range p.spec.Weights {
+			keep = append(keep, subset)
+		}
+	}
+
+	return keep, drain
+}
+
+// applyChanges runs fn over istio's resources of a planned shift, printing the diff of every changed resource
+func applyChanges(p plannedShift, dryRun bool, fn func() error) error {
+	before, err := p.op.Get(p.shift.Selector)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	// dry-run diffs are already printed by the routers
+	if dryRun {
+		return nil
+	}
+
+	after, err := p.op.Get(p.shift.Selector)
+	if err != nil {
+		return err
+	}
+
+	changes, err := spec.Changes(before, after)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		logger.Info(fmt.Sprintf("No changes for destination '%s'", p.spec.Destination), trackingId)
+	}
+
+	for _, change := range changes {
+		logger.Info(fmt.Sprintf("Applied changes to '%s'", change.Resource), trackingId)
+		fmt.Print(change.Diff)
+	}
+
+	return nil
+}
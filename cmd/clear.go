@@ -2,18 +2,22 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/pismo/istiops/pkg/logger"
+	istiOperator "github.com/pismo/istiops/pkg/operator"
 	"github.com/pismo/istiops/pkg/router"
 	"github.com/spf13/cobra"
 )
 
 func init() {
-	rulesClearCmd.PersistentFlags().StringP("namespace", "n", "default", "kubernetes' cluster namespace")
+	rulesClearCmd.PersistentFlags().StringP("namespace", "n", "default", "kubernetes' cluster namespace, or many comma-separated ones")
+	rulesClearCmd.PersistentFlags().BoolP("all-namespaces", "A", false, "clear routes of every namespace with resources matched by label-selector")
 	rulesClearCmd.PersistentFlags().StringP("label-selector", "l", "", "* labels selector to filter istio' resources")
 	rulesClearCmd.PersistentFlags().StringP("mode", "m", "soft", "if 'hard' all canary rules will be cleaned otherwise only canary rules with no pods will be cleaned")
+	rulesClearCmd.PersistentFlags().Bool("dry-run", false, "print the diff of istio' resources instead of applying it")
+	rulesClearCmd.PersistentFlags().String("master-route", router.MasterRouteRegex, "definition of the master-route: 'regex' (uri regex '.+'), 'prefix' (uri prefix '/') or 'catch-all' (no match)")
 
-	_ = rulesClearCmd.MarkPersistentFlagRequired("namespace")
 	_ = rulesClearCmd.MarkPersistentFlagRequired("label-selector")
 }
 
@@ -25,13 +29,13 @@ var rulesClearCmd = &cobra.Command{
 		kubeConfigPath, _ := rootCmd.Flags().GetString("kubeconfig")
 		clientSetup(kubeContext, kubeConfigPath)
 
-		namespace := cmd.Flag("namespace").Value.String()
-		if namespace == "" {
-			namespace = "default"
-		} else {
-			namespace = cmd.Flag("namespace").Value.String()
+		// namespaces must be explicitly chosen, as routes are removed
+		if !cmd.Flag("namespace").Changed && !cmd.Flag("all-namespaces").Changed {
+			logger.Fatal("either --namespace or --all-namespaces is required", "cmd")
 		}
 
+		namespace, manyNamespaces, allNamespaces := namespaces(cmd)
+
 		mappedLabelSelector, err := router.Mapify(trackingId, fmt.Sprintf("%s", cmd.Flag("label-selector").Value))
 		if err != nil {
 			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
@@ -45,25 +49,45 @@ var rulesClearCmd = &cobra.Command{
 			clearMode = "hard"
 		}
 
+		masterRoute, err := router.ParseMasterRoute(cmd.Flag("master-route").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
 		drR := &router.DestinationRule{
 			TrackingId: trackingId,
 			Namespace:  namespace,
 			Istio:      clients.Istio,
 			KubeClient: clients.Kubernetes,
+			Audit:      auditOf(clients),
+			DryRun:     dryRun,
+			DiffOutput: os.Stdout,
 		}
 
 		vsR := &router.VirtualService{
-			TrackingId: trackingId,
-			Namespace:  namespace,
-			Istio:      clients.Istio,
-			KubeClient: clients.Kubernetes,
+			TrackingId:  trackingId,
+			Namespace:   namespace,
+			Istio:       clients.Istio,
+			KubeClient:  clients.Kubernetes,
+			Audit:       auditOf(clients),
+			DryRun:      dryRun,
+			DiffOutput:  os.Stdout,
+			MasterRoute: masterRoute,
 		}
 
 		shift := router.Shift{
 			Selector: mappedLabelSelector,
 		}
 
-		op := operator(drR, vsR)
+		op := &istiOperator.Istiops{
+			DrRouter:      drR,
+			VsRouter:      vsR,
+			DryRun:        dryRun,
+			Namespaces:    manyNamespaces,
+			AllNamespaces: allNamespaces,
+		}
 		err = op.Clear(shift, clearMode)
 		if err != nil {
 			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pismo/istiops/pkg/controller"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	controllerCmd.PersistentFlags().StringP("namespace", "n", "", "namespace of the watched trafficShifts (all namespaces when empty)")
+	controllerCmd.PersistentFlags().Duration("resync", controller.DefaultResync, "period which every trafficShift is applied again")
+}
+
+var controllerCmd = &cobra.Command{
+	Use:   "controller",
+	Short: "Continuously reconciles istio's traffic to TrafficShift custom resources",
+	Run: func(cmd *cobra.Command, args []string) {
+		kubeContext, _ := rootCmd.Flags().GetString("context")
+		kubeConfigPath, _ := rootCmd.Flags().GetString("kubeconfig")
+		clientSetup(kubeContext, kubeConfigPath)
+
+		resync, _ := cmd.Flags().GetDuration("resync")
+
+		c := &controller.Controller{
+			TrackingId:    trackingId,
+			Namespace:     cmd.Flag("namespace").Value.String(),
+			TrafficShifts: &controller.DynamicTrafficShifts{Client: clients.Dynamic},
+			Istio:         clients.Istio,
+			KubeClient:    clients.Kubernetes,
+			Resync:        resync,
+			Audit:         auditOf(clients),
+		}
+
+		logger.Info(fmt.Sprintf("Starting controller of trafficShifts at namespace '%s'", c.Namespace), trackingId)
+		err := c.Run(interrupted())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+	},
+}
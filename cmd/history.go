@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pismo/istiops/pkg/view"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	historyCmd.PersistentFlags().StringP("namespace", "n", "default", "kubernetes' cluster namespace")
+	historyCmd.PersistentFlags().StringP("label-selector", "l", "", "* labels selector to filter istio' resources")
+	historyCmd.PersistentFlags().IntP("revision", "r", 0, "print the whole spec of virtualServices at the given revision")
+	historyCmd.PersistentFlags().StringP("output", "o", "pretty", "output format: 'pretty', 'json' or 'yaml'")
+
+	_ = historyCmd.MarkPersistentFlagRequired("label-selector")
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List previous states of virtualServices' routes",
+	Run: func(cmd *cobra.Command, args []string) {
+		kubeContext, _ := rootCmd.Flags().GetString("context")
+		kubeConfigPath, _ := rootCmd.Flags().GetString("kubeconfig")
+		clientSetup(kubeContext, kubeConfigPath)
+
+		namespace := cmd.Flag("namespace").Value.String()
+		if namespace == "" {
+			namespace = "default"
+		}
+
+		output := cmd.Flag("output").Value.String()
+		if output != "yaml" && output != "json" && output != "pretty" {
+			logger.Fatal(fmt.Sprintf("--output must be 'yaml', 'json' or 'pretty'"), trackingId)
+		}
+
+		mappedLabelSelector, err := router.Mapify(trackingId, cmd.Flag("label-selector").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		vsR := &router.VirtualService{
+			TrackingId: trackingId,
+			Namespace:  namespace,
+			Istio:      clients.Istio,
+			KubeClient: clients.Kubernetes,
+		}
+
+		vss, err := vsR.List(mappedLabelSelector)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		revision, _ := cmd.Flags().GetInt("revision")
+		if revision != 0 {
+			for _, vs := range vss.VList.Items {
+				spec, err := view.SpecAt(vs, revision)
+				if err != nil {
+					logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+				}
+
+				jsonSpec, err := (&jsonpb.Marshaler{Indent: "  "}).MarshalToString(spec)
+				if err != nil {
+					logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+				}
+
+				if output == "json" {
+					fmt.Println(jsonSpec)
+					continue
+				}
+
+				yamlSpec, err := yaml.JSONToYAML([]byte(jsonSpec))
+				if err != nil {
+					logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+				}
+
+				fmt.Println(fmt.Sprintf("# virtualService '%s/%s' at revision %d", vs.Namespace, vs.Name, revision))
+				fmt.Print(string(yamlSpec))
+			}
+			return
+		}
+
+		var revisions []view.Revision
+		for _, vs := range vss.VList.Items {
+			vsRevisions, err := view.Revisions(vs)
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+			}
+			revisions = append(revisions, vsRevisions...)
+		}
+		view.SortRevisions(revisions)
+
+		switch output {
+		case "json":
+			jsonData, err := json.MarshalIndent(revisions, "", "  ")
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+			}
+			fmt.Println(string(jsonData))
+		case "yaml":
+			yamlData, err := yaml.Marshal(revisions)
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+			}
+			fmt.Print(string(yamlData))
+		default:
+			if len(revisions) == 0 {
+				fmt.Println("No recorded changes")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VIRTUALSERVICE\tREVISION\tTIME\tOPERATION\tBUILD\tROUTES\tUSER\tTRACKING-ID")
+			for _, r := range revisions {
+				build := "-"
+				if r.Build != 0 {
+					build = fmt.Sprintf("%d", r.Build)
+				}
+
+				fmt.Fprintln(w, fmt.Sprintf("%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s",
+					r.Name, r.Number, r.Timestamp.Local().Format("2006-01-02 15:04:05"), r.Operation, build,
+					strings.Join(r.Routes, " | "), r.User, r.TrackingId))
+			}
+			_ = w.Flush()
+		}
+	},
+}
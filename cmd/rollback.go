@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rollbackCmd.PersistentFlags().StringP("namespace", "n", "default", "kubernetes' cluster namespace")
+	rollbackCmd.PersistentFlags().StringP("label-selector", "l", "", "* labels selector to filter istio' resources")
+	rollbackCmd.PersistentFlags().String("master-route", router.MasterRouteRegex, "definition of the master-route: 'regex' (uri regex '.+'), 'prefix' (uri prefix '/') or 'catch-all' (no match)")
+
+	_ = rollbackCmd.MarkPersistentFlagRequired("label-selector")
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restores the master-route to its previous subsets & weights",
+	Run: func(cmd *cobra.Command, args []string) {
+		kubeContext, _ := rootCmd.Flags().GetString("context")
+		kubeConfigPath, _ := rootCmd.Flags().GetString("kubeconfig")
+		clientSetup(kubeContext, kubeConfigPath)
+
+		namespace := cmd.Flag("namespace").Value.String()
+		if namespace == "" {
+			namespace = "default"
+		}
+
+		mappedLabelSelector, err := router.Mapify(trackingId, cmd.Flag("label-selector").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		masterRoute, err := router.ParseMasterRoute(cmd.Flag("master-route").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		drR := &router.DestinationRule{
+			TrackingId: trackingId,
+			Namespace:  namespace,
+			Istio:      clients.Istio,
+			KubeClient: clients.Kubernetes,
+			Audit:      auditOf(clients),
+		}
+
+		vsR := &router.VirtualService{
+			TrackingId:  trackingId,
+			Namespace:   namespace,
+			Istio:       clients.Istio,
+			KubeClient:  clients.Kubernetes,
+			Audit:       auditOf(clients),
+			MasterRoute: masterRoute,
+		}
+
+		op := operator(drR, vsR)
+		err = op.Rollback(mappedLabelSelector)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+	},
+}
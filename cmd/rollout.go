@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pismo/istiops/pkg/analysis"
+	"github.com/pismo/istiops/pkg/logger"
+	istiOperator "github.com/pismo/istiops/pkg/operator"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rolloutCmd.PersistentFlags().StringP("namespace", "n", "default", "kubernetes' cluster namespace")
+	rolloutCmd.PersistentFlags().StringP("destination", "d", "", "* destination's hostname with port ('api.domain.io:8080' or 'k8s-service:8080')")
+	rolloutCmd.PersistentFlags().Uint32P("build", "b", 0, "* build")
+	rolloutCmd.PersistentFlags().StringP("label-selector", "l", "", "* labels selector to filter istio' resources")
+	rolloutCmd.PersistentFlags().StringP("pod-selector", "p", "", "* pod")
+	rolloutCmd.PersistentFlags().StringP("steps", "s", "10,25,50,100", "comma separated weights (percentage) to be applied in order")
+	rolloutCmd.PersistentFlags().DurationP("interval", "i", 0, "pause between each step (ex: '30s', '5m'), required by the canary analysis")
+	rolloutCmd.PersistentFlags().String("master-route", router.MasterRouteRegex, "definition of the master-route: 'regex' (uri regex '.+'), 'prefix' (uri prefix '/') or 'catch-all' (no match)")
+	// boolean optional flags
+	rolloutCmd.PersistentFlags().Bool("resume", false, "resume a previous rollout from its last applied step")
+	rolloutCmd.PersistentFlags().Bool("abort", false, "abort a running rollout, no further step will be applied")
+	rolloutCmd.PersistentFlags().Bool("force", false, "resume a rollout which failed its canary analysis, without analyzing its resumed step")
+	// canary analysis optional flags
+	rolloutCmd.PersistentFlags().String("prometheus", "", "prometheus-compatible address to analyze each step before moving on (ex: 'http://prometheus:9090')")
+	rolloutCmd.PersistentFlags().Float64("max-error-rate", 0, "ratio (0 - 1) of failed requests accepted for the canary subset")
+	rolloutCmd.PersistentFlags().Duration("max-latency", 0, "p99 request duration accepted for the canary subset (ex: '500ms')")
+	rolloutCmd.PersistentFlags().Float64("tolerance", 0, "ratio which the canary can be worse than the master-route subset (ex: '0.1' for 10%)")
+	rolloutCmd.PersistentFlags().String("analysis-window", "1m", "range of metrics evaluated by the analysis queries")
+	rolloutCmd.PersistentFlags().Bool("allow-no-data", false, "take a canary without metrics as a healthy one, instead of rolling it back")
+	rolloutCmd.PersistentFlags().String("error-rate-query", analysis.DefaultErrorRateQuery, "error rate query template")
+	rolloutCmd.PersistentFlags().String("latency-query", analysis.DefaultLatencyQuery, "latency (seconds) query template")
+
+	_ = rolloutCmd.MarkPersistentFlagRequired("destination")
+	_ = rolloutCmd.MarkPersistentFlagRequired("build")
+	_ = rolloutCmd.MarkPersistentFlagRequired("label-selector")
+	_ = rolloutCmd.MarkPersistentFlagRequired("pod-selector")
+}
+
+var rolloutCmd = &cobra.Command{
+	Use:   "rollout",
+	Short: "Progressively shift istio's traffic through weight steps",
+	Run: func(cmd *cobra.Command, args []string) {
+		kubeContext, _ := rootCmd.Flags().GetString("context")
+		kubeConfigPath, _ := rootCmd.Flags().GetString("kubeconfig")
+		clientSetup(kubeContext, kubeConfigPath)
+
+		namespace := cmd.Flag("namespace").Value.String()
+		if namespace == "" {
+			namespace = "default"
+		}
+
+		mappedLabelSelector, err := router.Mapify(trackingId, cmd.Flag("label-selector").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		masterRoute, err := router.ParseMasterRoute(cmd.Flag("master-route").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		abort, _ := cmd.Flags().GetBool("abort")
+		if abort {
+			vsR := &router.VirtualService{
+				TrackingId:  trackingId,
+				Namespace:   namespace,
+				Istio:       clients.Istio,
+				KubeClient:  clients.Kubernetes,
+				Audit:       auditOf(clients),
+				MasterRoute: masterRoute,
+			}
+
+			op := operator(&router.DestinationRule{}, vsR)
+			err = op.AbortRollout(mappedLabelSelector)
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+			}
+			return
+		}
+
+		destination := cmd.Flag("destination").Value.String()
+		destinationSplitted := strings.Split(destination, ":")
+		if len(destinationSplitted) != 2 {
+			logger.Fatal(fmt.Sprintf("destination '%s' does not follow the format 'destination:port'", destination), "cmd")
+		}
+
+		portUint, err := strconv.ParseUint(destinationSplitted[1], 10, 32)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		mappedPodSelector, err := router.Mapify(trackingId, cmd.Flag("pod-selector").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		buildInt, err := strconv.ParseUint(cmd.Flag("build").Value.String(), 10, 32)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
+		var steps []int32
+		for _, step := range strings.Split(cmd.Flag("steps").Value.String(), ",") {
+			stepInt, err := strconv.ParseInt(strings.TrimSpace(step), 10, 32)
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("invalid step '%s': %s", step, err), "cmd")
+			}
+			steps = append(steps, int32(stepInt))
+		}
+
+		interval, _ := cmd.Flags().GetDuration("interval")
+		resume, _ := cmd.Flags().GetBool("resume")
+		force, _ := cmd.Flags().GetBool("force")
+
+		drR := router.DestinationRule{
+			TrackingId: trackingId,
+			Name:       destinationSplitted[0],
+			Namespace:  namespace,
+			Build:      uint32(buildInt),
+			Istio:      clients.Istio,
+			KubeClient: clients.Kubernetes,
+			Audit:      auditOf(clients),
+		}
+
+		vsR := router.VirtualService{
+			TrackingId:  trackingId,
+			Name:        destinationSplitted[0],
+			Namespace:   namespace,
+			Build:       uint32(buildInt),
+			Istio:       clients.Istio,
+			KubeClient:  clients.Kubernetes,
+			Audit:       auditOf(clients),
+			MasterRoute: masterRoute,
+		}
+
+		shift := router.Shift{
+			Selector: mappedLabelSelector,
+			Hostname: destinationSplitted[0],
+			Port:     uint32(portUint),
+			Traffic: router.Traffic{
+				PodSelector: mappedPodSelector,
+				Exact:       true,
+			},
+		}
+
+		rollout := istiOperator.Rollout{
+			Steps:    steps,
+			Interval: interval,
+			Resume:   resume,
+			Force:    force,
+		}
+
+		prometheus := cmd.Flag("prometheus").Value.String()
+		if prometheus != "" {
+			maxErrorRate, _ := cmd.Flags().GetFloat64("max-error-rate")
+			maxLatency, _ := cmd.Flags().GetDuration("max-latency")
+			tolerance, _ := cmd.Flags().GetFloat64("tolerance")
+			allowNoData, _ := cmd.Flags().GetBool("allow-no-data")
+
+			rollout.Gate = &analysis.Analysis{
+				TrackingId: trackingId,
+				Provider:   &analysis.Prometheus{Address: prometheus},
+				Queries: analysis.Queries{
+					ErrorRate: cmd.Flag("error-rate-query").Value.String(),
+					Latency:   cmd.Flag("latency-query").Value.String(),
+				},
+				Thresholds: analysis.Thresholds{
+					MaxErrorRate: maxErrorRate,
+					MaxLatency:   maxLatency,
+					Tolerance:    tolerance,
+				},
+				Window:      cmd.Flag("analysis-window").Value.String(),
+				AllowNoData: allowNoData,
+			}
+		}
+
+		op := operator(&drR, &vsR)
+		err = op.Rollout(shift, rollout)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+	},
+}
@@ -3,6 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/google/uuid"
 	"github.com/pismo/istiops/pkg/client"
@@ -22,8 +25,13 @@ func init() {
 	kubeConfigDefaultPath := homedir.HomeDir() + "/.kube/config"
 	rootCmd.PersistentFlags().String("context", "", "kube context (optional)")
 	rootCmd.PersistentFlags().String("kubeconfig", kubeConfigDefaultPath, "config path (optional)")
+	rootCmd.PersistentFlags().String("audit-user", "", "user recorded by audit records of every change (default: the kube context's user)")
+	rootCmd.PersistentFlags().String("audit-file", "", "json-lines file which audit records of every change are appended to (optional)")
 
 	rootCmd.AddCommand(trafficCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(controllerCmd)
+	rootCmd.AddCommand(serveCmd)
 	rootCmd.AddCommand(versionCmd)
 }
 
@@ -36,6 +44,46 @@ func clientSetup(kubeContext string, kubeConfigPath string) {
 	}
 	logger.Debug(fmt.Sprintf("Initialized client from context '%s' and kubeConfig '%s'", kubeContext, kubeConfigPath), "cmd")
 
+	trackingSetup()
+}
+
+// clustersSetup returns the clients of many kube contexts, to be operated all together
+func clustersSetup(kubeContexts []string, kubeConfigPath string) []client.Cluster {
+	clusters, err := client.NewClusters(kubeContexts, kubeConfigPath)
+	if err != nil {
+		logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+	}
+	logger.Debug(fmt.Sprintf("Initialized clients from contexts '%s' and kubeConfig '%s'", strings.Join(kubeContexts, ","), kubeConfigPath), "cmd")
+
+	trackingSetup()
+
+	return clusters
+}
+
+// auditOf returns the audit of changes made through a clientset, failing if the audit file can't be written
+func auditOf(set *client.Set) router.Audit {
+	auditUser, _ := rootCmd.Flags().GetString("audit-user")
+	auditFile, _ := rootCmd.Flags().GetString("audit-file")
+
+	if auditUser == "" {
+		auditUser = set.User
+	}
+
+	if auditFile != "" {
+		file, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("could not open audit file: %s", err), "cmd")
+		}
+		_ = file.Close()
+	}
+
+	return router.Audit{
+		User: auditUser,
+		File: auditFile,
+	}
+}
+
+func trackingSetup() {
 	// generate random uuid
 	tracking, err := uuid.NewUUID()
 	if err != nil {
@@ -45,6 +93,44 @@ func clientSetup(kubeContext string, kubeConfigPath string) {
 	trackingId = tracking.String()
 }
 
+// namespaces parses a comma-separated '--namespace' flag and the '--all-namespaces' one, returning the namespace
+// of routers and, when many namespaces are selected, the ones of the operator
+func namespaces(cmd *cobra.Command) (string, []string, bool) {
+	allNamespaces, _ := cmd.Flags().GetBool("all-namespaces")
+
+	var selected []string
+	for _, namespace := range strings.Split(cmd.Flag("namespace").Value.String(), ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" {
+			selected = append(selected, namespace)
+		}
+	}
+
+	if len(selected) == 0 {
+		return "default", nil, allNamespaces
+	}
+
+	if len(selected) == 1 {
+		return selected[0], nil, allNamespaces
+	}
+
+	return selected[0], selected, allNamespaces
+}
+
+// interrupted returns a channel which is closed once the process receives SIGINT or SIGTERM
+func interrupted() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		logger.Debug("Interrupted, stopping", trackingId)
+		close(stop)
+	}()
+
+	return stop
+}
+
 func operator(dr *router.DestinationRule, vs *router.VirtualService) istiOperator.Operator {
 	op := &istiOperator.Istiops{
 		DrRouter: dr,
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	serveCmd.PersistentFlags().String("address", "127.0.0.1:8080", "address which the API listens to, only loopback ones are served without TLS")
+	serveCmd.PersistentFlags().String("token", "", "bearer token of requests (defaults to the ISTIOPS_TOKEN environment variable)")
+	serveCmd.PersistentFlags().String("tls-cert", "", "certificate file which the API is served with over TLS")
+	serveCmd.PersistentFlags().String("tls-key", "", "private key file of the TLS certificate")
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves the operator's get, shift and clear over an authenticated REST API",
+	Run: func(cmd *cobra.Command, args []string) {
+		kubeContext, _ := rootCmd.Flags().GetString("context")
+		kubeConfigPath, _ := rootCmd.Flags().GetString("kubeconfig")
+		clientSetup(kubeContext, kubeConfigPath)
+
+		token := cmd.Flag("token").Value.String()
+		if token == "" {
+			token = os.Getenv("ISTIOPS_TOKEN")
+		}
+
+		s := &server.Server{
+			TrackingId: trackingId,
+			Token:      token,
+			Istio:      clients.Istio,
+			KubeClient: clients.Kubernetes,
+			Audit:      auditOf(clients),
+			TLSCert:    cmd.Flag("tls-cert").Value.String(),
+			TLSKey:     cmd.Flag("tls-key").Value.String(),
+		}
+
+		err := s.ListenAndServe(cmd.Flag("address").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+	},
+}
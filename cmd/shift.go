@@ -2,10 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
+	"github.com/gookit/color"
+	"github.com/pismo/istiops/pkg/client"
 	"github.com/pismo/istiops/pkg/logger"
+	istiOperator "github.com/pismo/istiops/pkg/operator"
 	"github.com/pismo/istiops/pkg/router"
 	"github.com/spf13/cobra"
 )
@@ -17,10 +21,27 @@ func init() {
 	shiftCmd.PersistentFlags().StringP("label-selector", "l", "", "* labels selector to filter istio' resources")
 	shiftCmd.PersistentFlags().StringP("headers", "H", "", "headers")
 	shiftCmd.PersistentFlags().StringP("pod-selector", "p", "", "* pod")
+	shiftCmd.PersistentFlags().String("uri-prefix", "", "uri prefix to be matched by the canary route (ex: '/v2')")
+	shiftCmd.PersistentFlags().String("uri-regex", "", "uri regex to be matched by the canary route (can't coexist with --uri-prefix flag)")
+	shiftCmd.PersistentFlags().String("method", "", "HTTP method to be matched by the canary route (ex: 'GET')")
+	shiftCmd.PersistentFlags().String("source-labels", "", "labels of the source workloads to be matched by the canary route (ex: 'app=frontend,version=v2')")
+	shiftCmd.PersistentFlags().StringSlice("gateways", []string{}, "comma separated gateways' names which the canary route is restricted to")
 	shiftCmd.PersistentFlags().Uint32P("weight", "w", 0, "* weight (percentage) of routing")
+	shiftCmd.PersistentFlags().String("weights", "", "split of master-route across many subsets, which must sum 100 (ex: 'api-1-default=50,api-2-default=30,api-3-default=20')")
+	shiftCmd.PersistentFlags().String("protocol", router.ProtocolHTTP, "routes to be shifted: 'http', 'tcp' or 'tls' (tcp & tls can only be shifted by weight)")
+	shiftCmd.PersistentFlags().Bool("mirror", false, "mirror the requests of the master-route to the new build, whose responses are discarded (can't coexist with --weight, --weights or --headers)")
+	shiftCmd.PersistentFlags().Uint32("mirror-percent", 0, "percent of requests to be mirrored, only 100 is supported by the istio API in use (default: 100)")
+	shiftCmd.PersistentFlags().String("master-route", router.MasterRouteRegex, "definition of the master-route: 'regex' (uri regex '.+'), 'prefix' (uri prefix '/') or 'catch-all' (no match)")
 	// boolean optional flags
 	shiftCmd.PersistentFlags().BoolP("exact", "e", true, "exact header value (default flag)")
 	shiftCmd.PersistentFlags().BoolP("regexp", "r", false, "regexp header value (can't coexist with --exact flag")
+	shiftCmd.PersistentFlags().Bool("dry-run", false, "print the diff of istio' resources instead of applying it")
+	shiftCmd.PersistentFlags().Int("retry-attempts", router.DefaultRetry.Attempts, "maximum of attempts to update a resource changed concurrently by another client")
+	shiftCmd.PersistentFlags().Int32("min-ready", 0, "minimum of ready replicas of the pod-selector's deployments to shift traffic to them (default: not checked)")
+	shiftCmd.PersistentFlags().Bool("wait", false, "wait for the pod-selector's deployments to be completely rolled out before shifting traffic to them")
+	shiftCmd.PersistentFlags().Duration("ready-timeout", 0, "time to wait for the --min-ready replicas to become ready, and for the --wait rollout (default: 10m), before refusing the shift")
+	shiftCmd.PersistentFlags().StringSlice("contexts", []string{}, "comma separated kube contexts to be shifted all together: if any of them fails, the ones already shifted are reverted")
+	shiftCmd.PersistentFlags().Duration("retry-backoff", router.DefaultRetry.Backoff, "pause before retrying a conflicting update, doubled at each attempt")
 
 	_ = shiftCmd.MarkPersistentFlagRequired("destination")
 	_ = shiftCmd.MarkPersistentFlagRequired("pod-selector")
@@ -34,7 +55,14 @@ var shiftCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		kubeContext, _ := rootCmd.Flags().GetString("context")
 		kubeConfigPath, _ := rootCmd.Flags().GetString("kubeconfig")
-		clientSetup(kubeContext, kubeConfigPath)
+		kubeContexts, _ := cmd.Flags().GetStringSlice("contexts")
+
+		var clusters []client.Cluster
+		if len(kubeContexts) > 0 {
+			clusters = clustersSetup(kubeContexts, kubeConfigPath)
+		} else {
+			clientSetup(kubeContext, kubeConfigPath)
+		}
 
 		namespace := cmd.Flag("namespace").Value.String()
 		if namespace == "" {
@@ -60,6 +88,11 @@ var shiftCmd = &cobra.Command{
 			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
 		}
 
+		masterRoute, err := router.ParseMasterRoute(cmd.Flag("master-route").Value.String())
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+		}
+
 		mappedPodSelector, err := router.Mapify(trackingId, cmd.Flag("pod-selector").Value.String())
 		if err != nil {
 			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
@@ -93,6 +126,33 @@ var shiftCmd = &cobra.Command{
 			}
 		}
 
+		var sourceLabels map[string]string
+		if cmd.Flag("source-labels").Value.String() != "" {
+			sourceLabels, err = router.Mapify(trackingId, cmd.Flag("source-labels").Value.String())
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+			}
+		}
+
+		gateways, _ := cmd.Flags().GetStringSlice("gateways")
+
+		var weights map[string]int32
+		if cmd.Flag("weights").Value.String() != "" {
+			mappedWeights, err := router.Mapify(trackingId, cmd.Flag("weights").Value.String())
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+			}
+
+			weights = map[string]int32{}
+			for subset, weight := range mappedWeights {
+				weightInt, err := strconv.ParseInt(weight, 10, 32)
+				if err != nil {
+					logger.Fatal(fmt.Sprintf("invalid weight '%s' for subset '%s': %s", weight, subset, err), "cmd")
+				}
+				weights[subset] = int32(weightInt)
+			}
+		}
+
 		var exact bool
 		var regexp bool
 
@@ -102,22 +162,59 @@ var shiftCmd = &cobra.Command{
 			exact = false
 		}
 
-		drR := router.DestinationRule{
-			TrackingId: trackingId,
-			Name:       destinationSplitted[0],
-			Namespace:  namespace,
-			Build:      uint32(buildInt),
-			Istio:      clients.Istio,
-			KubeClient: clients.Kubernetes,
+		mirror, _ := cmd.Flags().GetBool("mirror")
+		mirrorPercent, _ := cmd.Flags().GetUint32("mirror-percent")
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		retryAttempts, _ := cmd.Flags().GetInt("retry-attempts")
+		retryBackoff, _ := cmd.Flags().GetDuration("retry-backoff")
+		retry := router.Retry{
+			Attempts: retryAttempts,
+			Backoff:  retryBackoff,
+		}
+
+		minReady, _ := cmd.Flags().GetInt32("min-ready")
+		wait, _ := cmd.Flags().GetBool("wait")
+		readyTimeout, _ := cmd.Flags().GetDuration("ready-timeout")
+		if readyTimeout > 0 && minReady == 0 && !wait {
+			logger.Fatal("--ready-timeout requires --min-ready or --wait", "cmd")
 		}
+		readiness := router.Readiness{
+			MinReady: minReady,
+			Rollout:  wait,
+			Timeout:  readyTimeout,
+		}
+
+		routers := func(set *client.Set) (*router.DestinationRule, *router.VirtualService) {
+			drR := &router.DestinationRule{
+				TrackingId: trackingId,
+				Name:       destinationSplitted[0],
+				Namespace:  namespace,
+				Build:      uint32(buildInt),
+				Istio:      set.Istio,
+				KubeClient: set.Kubernetes,
+				Audit:      auditOf(set),
+				DryRun:     dryRun,
+				DiffOutput: os.Stdout,
+				Retry:      retry,
+			}
+
+			vsR := &router.VirtualService{
+				TrackingId:  trackingId,
+				Name:        destinationSplitted[0],
+				Namespace:   namespace,
+				Build:       uint32(buildInt),
+				Istio:       set.Istio,
+				KubeClient:  set.Kubernetes,
+				Audit:       auditOf(set),
+				DryRun:      dryRun,
+				DiffOutput:  os.Stdout,
+				Retry:       retry,
+				MasterRoute: masterRoute,
+			}
 
-		vsR := router.VirtualService{
-			TrackingId: trackingId,
-			Name:       destinationSplitted[0],
-			Namespace:  namespace,
-			Build:      uint32(buildInt),
-			Istio:      clients.Istio,
-			KubeClient: clients.Kubernetes,
+			return drR, vsR
 		}
 
 		shift := router.Shift{
@@ -129,14 +226,65 @@ var shiftCmd = &cobra.Command{
 				RequestHeaders: headers,
 				Exact:          exact,
 				Regexp:         regexp,
+				UriPrefix:      cmd.Flag("uri-prefix").Value.String(),
+				UriRegex:       cmd.Flag("uri-regex").Value.String(),
+				Method:         cmd.Flag("method").Value.String(),
+				SourceLabels:   sourceLabels,
+				Gateways:       gateways,
 				Weight:         int32(weightInt),
+				Weights:        weights,
+				Protocol:       cmd.Flag("protocol").Value.String(),
+				Mirror:         mirror,
+				MirrorPercent:  mirrorPercent,
 			},
 		}
 
-		op := operator(&drR, &vsR)
+		if len(clusters) > 0 {
+			multiCluster := &istiOperator.MultiCluster{TrackingId: trackingId}
+			for _, cluster := range clusters {
+				drR, vsR := routers(cluster.Set)
+				multiCluster.Clusters = append(multiCluster.Clusters, istiOperator.Cluster{
+					Name:     cluster.Context,
+					Operator: &istiOperator.Istiops{DrRouter: drR, VsRouter: vsR, DryRun: dryRun, Readiness: readiness},
+				})
+			}
+
+			results, err := multiCluster.Update(shift)
+			printClusterResults(results)
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("%s", err), "cmd")
+			}
+			return
+		}
+
+		drR, vsR := routers(clients)
+		op := &istiOperator.Istiops{
+			DrRouter:  drR,
+			VsRouter:  vsR,
+			DryRun:    dryRun,
+			Readiness: readiness,
+		}
 		err = op.Update(shift)
 		if err != nil {
 			logger.Fatal(fmt.Sprintf("%s", err), "cmd")
 		}
 	},
 }
+
+// printClusterResults prints the outcome of a multi-cluster shift at each cluster
+func printClusterResults(results []istiOperator.ClusterResult) {
+	for _, result := range results {
+		switch result.Status {
+		case istiOperator.ClusterUpdated:
+			color.Green.Println(fmt.Sprintf("%s: %s", result.Cluster, result.Status))
+		case istiOperator.ClusterFailed:
+			color.Red.Println(fmt.Sprintf("%s: %s (%s)", result.Cluster, result.Status, result.Error))
+		default:
+			if result.Error != "" {
+				color.LightYellow.Println(fmt.Sprintf("%s: %s (%s)", result.Cluster, result.Status, result.Error))
+				continue
+			}
+			color.LightYellow.Println(fmt.Sprintf("%s: %s", result.Cluster, result.Status))
+		}
+	}
+}
@@ -7,142 +7,24 @@ import (
 	"github.com/ghodss/yaml"
 	"github.com/gookit/color"
 	"github.com/pismo/istiops/pkg/logger"
+	istiOperator "github.com/pismo/istiops/pkg/operator"
 	"github.com/pismo/istiops/pkg/router"
+	"github.com/pismo/istiops/pkg/view"
 	"github.com/spf13/cobra"
-	"istio.io/api/networking/v1alpha3"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func init() {
-	showCmd.PersistentFlags().StringP("namespace", "n", "default", "kubernetes' cluster namespace")
+	showCmd.PersistentFlags().StringP("namespace", "n", "default", "kubernetes' cluster namespace, or many comma-separated ones")
+	showCmd.PersistentFlags().BoolP("all-namespaces", "A", false, "show routes of every namespace")
 	showCmd.PersistentFlags().StringP("label-selector", "l", "", "* labels selector to filter istio' resources")
 	showCmd.PersistentFlags().StringP("output", "o", "", "stdout format can be 'json', 'yaml' or 'pretty'")
+	showCmd.PersistentFlags().BoolP("watch", "w", false, "keep rendering (or emitting as json-lines) routes each time they change")
 
 	_ = showCmd.MarkPersistentFlagRequired("label-selector")
 }
 
-type Subset struct {
-	Name   string
-	Labels map[string]string
-}
-
-type Deployment struct {
-	Name      string
-	Namespace string
-	Pods      int32
-}
-
-type Destination struct {
-	Service    string
-	Weight     int32
-	Subset     Subset
-	Routable   bool
-	Deployment Deployment
-}
-
-type Routes struct {
-	Match        []*v1alpha3.HTTPMatchRequest
-	Destinations []Destination
-}
-
-type Resource struct {
-	Name      string
-	Namespace string
-	Hosts     []string
-	Routes    []*Routes
-}
-
-func structured(trackingId string, namespace string, irl router.IstioRouteList, kClient kubernetes.Interface) []Resource {
-	var r Resource
-	var resourceList []Resource
-
-	for _, vs := range irl.VList.Items {
-		r = Resource{}
-
-		r.Name = vs.Name
-		r.Namespace = vs.Namespace
-		r.Hosts = vs.Spec.Hosts
-
-		for _, httpValue := range vs.Spec.Http {
-			route := &Routes{}
-
-			for _, matchValue := range httpValue.Match {
-				route.Match = append(route.Match, matchValue)
-			}
-
-			// handle destination
-			var currentWeight int32
-			for _, httpRoute := range httpValue.Route {
-				jr := Destination{}
-				jr.Service = fmt.Sprintf("%s:%d", httpRoute.Destination.Host, httpRoute.Destination.Port.GetNumber())
-
-				if httpRoute.Weight == 0 {
-					currentWeight = 100
-				} else {
-					currentWeight = httpRoute.Weight
-				}
-
-				subsetExists := false
-				jr.Routable = true
-				for _, dr := range irl.DList.Items {
-
-					// validate if subset is valid and routable
-					for _, subset := range dr.Spec.Subsets {
-						js := Subset{}
-						js.Labels = map[string]string{}
-
-						if subset.Name == httpRoute.Destination.Subset {
-							subsetExists = true
-							js.Name = subset.Name
-
-							// append pod labels
-							for labelKey, labelValue := range subset.Labels {
-								js.Labels[labelKey] = labelValue
-							}
-
-							jr.Subset.Labels = js.Labels
-							jr.Subset.Name = js.Name
-						}
-					}
-
-					if !subsetExists {
-						jr.Subset.Name = httpRoute.Destination.Subset
-						jr.Routable = false
-					}
-
-					// validate if there are any pods to be routed
-					labelString, err := router.Stringify(trackingId, jr.Subset.Labels)
-					dep, err := kClient.AppsV1().Deployments(namespace).List(v1.ListOptions{
-						LabelSelector: labelString,
-					})
-					if err != nil {
-						return []Resource{}
-					}
-
-					if len(dep.Items) == 1 {
-						depItem := dep.Items[0]
-						jr.Deployment.Name = depItem.Name
-						jr.Deployment.Namespace = depItem.Namespace
-						jr.Deployment.Pods = depItem.Status.ReadyReplicas
-					}
-
-				}
-
-				jr.Weight = currentWeight
-				route.Destinations = append(route.Destinations, jr)
-			}
-
-			r.Routes = append(r.Routes, route)
-		}
-
-		resourceList = append(resourceList, r)
-	}
-
-	return resourceList
-}
-
-func jsonfy(resourceList []Resource) {
+func jsonfy(resourceList []view.Resource) {
 	var jsonData []byte
 	jsonData, err := json.Marshal(resourceList)
 	if err != nil {
@@ -153,7 +35,28 @@ func jsonfy(resourceList []Resource) {
 
 }
 
-func yamlfy(resourceList []Resource) {
+// watched renders each event of a watcher: pretty views are redrawn, json ones are emitted as json-lines
+// and yaml ones as documents of a stream
+func watched(output string, event view.Event) {
+	switch output {
+	case "pretty":
+		// clear the terminal before redrawing
+		fmt.Print("\033[H\033[2J")
+		fmt.Println("Every change of routes, at", event.Time.Format("15:04:05"))
+		beautified(event.Resources)
+	case "json":
+		jsonData, err := json.Marshal(event)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("%s", err), trackingId)
+		}
+		fmt.Println(string(jsonData))
+	case "yaml":
+		fmt.Println("---")
+		yamlfy(event.Resources)
+	}
+}
+
+func yamlfy(resourceList []view.Resource) {
 	var yamlData []byte
 	yamlData, err := yaml.Marshal(resourceList)
 	if err != nil {
@@ -163,14 +66,42 @@ func yamlfy(resourceList []Resource) {
 	fmt.Print(string(yamlData))
 }
 
-func beautified(resourceList []Resource) {
+func beautified(resourceList []view.Resource) {
+	// resources are already grouped by namespace, which are headed when there are many of them
+	grouped := false
 	for _, vs := range resourceList {
+		grouped = grouped || vs.Namespace != resourceList[0].Namespace
+	}
+
+	for i, vs := range resourceList {
+		if grouped && (i == 0 || vs.Namespace != resourceList[i-1].Namespace) {
+			fmt.Println("")
+			color.Bold.Println("Namespace", vs.Namespace)
+			fmt.Println("==")
+		}
+
 		fmt.Println("")
 		fmt.Println("Resource: ", vs.Name)
 		fmt.Println("Namespace: ", vs.Namespace)
 		fmt.Println("client -> request to -> ", vs.Hosts)
 
 		for _, route := range vs.Routes {
+			if route.Protocol == router.ProtocolTCP {
+				color.Green.Println("  \\_ TCP", route.TcpMatch)
+			}
+
+			if route.Protocol == router.ProtocolTLS {
+				color.Green.Println("  \\_ TLS", route.TlsMatch)
+			}
+
+			if route.Master {
+				color.Green.Println("  \\_ Master-route")
+			}
+
+			if route.Name != "" {
+				color.Green.Println("  \\_ Route", route.Name)
+			}
+
 			for _, httpMatch := range route.Match {
 				if httpMatch.Uri != nil {
 					color.Green.Println("  \\_", httpMatch.Uri)
@@ -193,35 +124,63 @@ func beautified(resourceList []Resource) {
 						color.Cyan.Println("      |- ", escapedHeaderValue)
 					}
 				}
-			}
-
-			// handle destinations
-			fmt.Println("       \\_ Destination [k8s service]")
-			for _, httpRoute := range route.Destinations {
-				fmt.Println(fmt.Sprintf("         - %s [%s]", httpRoute.Service, httpRoute.Deployment.Name))
 
-				if httpRoute.Deployment.Pods > 0 {
-					color.Green.Println("            |- active pods: ", httpRoute.Deployment.Pods)
-				} else {
-					color.Red.Println("            |- NON-EXISTENT ACTIVE PODS:", httpRoute.Deployment.Pods)
+				if httpMatch.Method != nil {
+					color.Cyan.Println("  \\_ Method", httpMatch.Method)
 				}
 
-				fmt.Println(fmt.Sprintf("            \\_ %d %% of requests for pods with labels", httpRoute.Weight))
-
-				for labelKey, labelValue := range httpRoute.Subset.Labels {
-					fmt.Println(fmt.Sprintf("               |- %s: %s", labelKey, labelValue))
+				if len(httpMatch.SourceLabels) > 0 {
+					color.Cyan.Println("  \\_ Source labels")
+					for labelKey, labelValue := range httpMatch.SourceLabels {
+						color.Cyan.Println(fmt.Sprintf("      |- %s: %s", labelKey, labelValue))
+					}
 				}
 
-				if !httpRoute.Routable {
-					color.LightYellow.Println("               |- NON-EXISTENT SUBSET", httpRoute.Subset.Name)
+				if len(httpMatch.Gateways) > 0 {
+					color.Cyan.Println("  \\_ Gateways", httpMatch.Gateways)
 				}
+			}
 
+			// handle destinations
+			fmt.Println("       \\_ Destination [k8s service]")
+			for _, httpRoute := range route.Destinations {
+				printDestination(httpRoute, "of requests for")
+			}
+
+			if route.Mirror != nil {
+				fmt.Println("       \\_ Mirror [k8s service]")
+				printDestination(*route.Mirror, "of requests mirrored to")
 			}
 		}
 		fmt.Println("--")
 	}
 }
 
+// printDestination prints a route destination with its workload, active pods and subset labels
+func printDestination(destination view.Destination, requests string) {
+	workload := destination.Deployment.Name
+	if destination.Deployment.Kind != "" {
+		workload = fmt.Sprintf("%s/%s", destination.Deployment.Kind, destination.Deployment.Name)
+	}
+	fmt.Println(fmt.Sprintf("         - %s [%s]", destination.Service, workload))
+
+	if destination.Deployment.Pods > 0 {
+		color.Green.Println("            |- active pods: ", destination.Deployment.Pods)
+	} else {
+		color.Red.Println("            |- NON-EXISTENT ACTIVE PODS:", destination.Deployment.Pods)
+	}
+
+	fmt.Println(fmt.Sprintf("            \\_ %d %% %s pods with labels", destination.Weight, requests))
+
+	for labelKey, labelValue := range destination.Subset.Labels {
+		fmt.Println(fmt.Sprintf("               |- %s: %s", labelKey, labelValue))
+	}
+
+	if !destination.Routable {
+		color.LightYellow.Println("               |- NON-EXISTENT SUBSET", destination.Subset.Name)
+	}
+}
+
 var showCmd = &cobra.Command{
 	Use:   "show",
 	Short: "Show current istio's traffic rules",
@@ -230,12 +189,7 @@ var showCmd = &cobra.Command{
 		kubeConfigPath, _ := rootCmd.Flags().GetString("kubeconfig")
 		clientSetup(kubeContext, kubeConfigPath)
 
-		namespace := cmd.Flag("namespace").Value.String()
-		if namespace == "" {
-			namespace = "default"
-		} else {
-			namespace = cmd.Flag("namespace").Value.String()
-		}
+		namespace, manyNamespaces, allNamespaces := namespaces(cmd)
 
 		output := fmt.Sprintf("%s", cmd.Flag("output").Value)
 		if output == "" {
@@ -269,14 +223,47 @@ var showCmd = &cobra.Command{
 			Selector: mappedLabelSelector,
 		}
 
-		op := operator(drR, vsR)
+		op := &istiOperator.Istiops{
+			DrRouter:      drR,
+			VsRouter:      vsR,
+			Namespaces:    manyNamespaces,
+			AllNamespaces: allNamespaces,
+		}
+
+		watch, _ := cmd.Flags().GetBool("watch")
+		if watch {
+			// many namespaces are watched as a whole, Get filters the selected ones
+			watchedNamespace := namespace
+			if allNamespaces || len(manyNamespaces) > 0 {
+				watchedNamespace = metav1.NamespaceAll
+			}
+
+			w := &view.Watcher{
+				TrackingId: trackingId,
+				Namespace:  watchedNamespace,
+				Selector:   shift.Selector,
+				Get:        op.Get,
+				Istio:      clients.Istio,
+				KubeClient: clients.Kubernetes,
+			}
+
+			err := w.Run(interrupted(), func(event view.Event) {
+				watched(output, event)
+			})
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("%s", err), trackingId)
+			}
+
+			return
+		}
+
 		irl, err := op.Get(shift.Selector)
 		if err != nil {
 			logger.Fatal(fmt.Sprintf("%s", err), trackingId)
 		}
 
 		logger.Debug("Listing all current active routing rules", trackingId)
-		resourceList := structured(trackingId, namespace, irl, clients.Kubernetes)
+		resourceList := view.Structured(trackingId, irl, clients.Kubernetes)
 
 		if output == "pretty" {
 			beautified(resourceList)
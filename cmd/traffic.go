@@ -10,6 +10,9 @@ func init() {
 	trafficCmd.AddCommand(showCmd)
 	trafficCmd.AddCommand(rulesClearCmd)
 	trafficCmd.AddCommand(shiftCmd)
+	trafficCmd.AddCommand(rolloutCmd)
+	trafficCmd.AddCommand(rollbackCmd)
+	trafficCmd.AddCommand(historyCmd)
 }
 
 var trafficCmd = &cobra.Command{
@@ -5,7 +5,7 @@ go 1.12
 require (
 	github.com/aspenmesh/istio-client-go v0.0.0-20190426173040-3e73c27b9ace
 	github.com/ghodss/yaml v0.0.0-20150909031657-73d445a93680
-	github.com/gogo/protobuf v1.2.1 // indirect
+	github.com/gogo/protobuf v1.2.1
 	github.com/golang/glog v0.0.0-20141105023935-44145f04b68c // indirect
 	github.com/google/gofuzz v0.0.0-20161122191042-44d81051d367 // indirect
 	github.com/google/uuid v1.1.1
@@ -0,0 +1,216 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultErrorRateQuery returns the ratio of 5xx responses served by a subset
+	DefaultErrorRateQuery = `sum(rate(istio_requests_total{destination_subset="{{ .Subset }}",response_code=~"5.*"}[{{ .Window }}])) / sum(rate(istio_requests_total{destination_subset="{{ .Subset }}"}[{{ .Window }}]))`
+	// DefaultLatencyQuery returns the 99th percentile of a subset's request duration in seconds
+	DefaultLatencyQuery = `histogram_quantile(0.99, sum(rate(istio_request_duration_seconds_bucket{destination_subset="{{ .Subset }}"}[{{ .Window }}])) by (le))`
+)
+
+// Queries are templates which can use both '{{ .Subset }}' and '{{ .Window }}' values
+type Queries struct {
+	ErrorRate string
+	Latency   string
+}
+
+// Thresholds which a canary subset must respect, zero values are not evaluated
+type Thresholds struct {
+	// MaxErrorRate is the ratio (0 - 1) of failed requests accepted for the canary
+	MaxErrorRate float64
+	// MaxLatency is the request duration accepted for the canary
+	MaxLatency time.Duration
+	// Tolerance is the ratio which the canary can be worse than the baseline (ex: 0.1 for 10%)
+	Tolerance float64
+}
+
+type Analysis struct {
+	TrackingId string
+	Provider   Provider
+	Queries    Queries
+	Thresholds Thresholds
+	Window     string
+	// AllowNoData turns a canary without metrics for a configured threshold into a healthy one, it is unhealthy by
+	// default as a canary which serves no requests can't be told apart from a broken one
+	AllowNoData bool
+}
+
+// Metrics of a single subset, nil values mean there was no data to be evaluated
+type Metrics struct {
+	Subset    string
+	ErrorRate *float64
+	Latency   *time.Duration
+}
+
+// Result holds the evaluated metrics and the reasons which turned a canary into an unhealthy one
+type Result struct {
+	Canary   Metrics
+	Baseline Metrics
+	Healthy  bool
+	Reasons  []string
+}
+
+type queryValues struct {
+	Subset string
+	Window string
+}
+
+func (a *Analysis) render(query string, subset string) (string, error) {
+	window := a.Window
+	if window == "" {
+		window = "1m"
+	}
+
+	t, err := template.New("query").Parse(query)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	err = t.Execute(&b, queryValues{Subset: subset, Window: window})
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+func (a *Analysis) query(query string, subset string) (*float64, error) {
+	rendered, err := a.render(query, subset)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := a.Provider.Query(rendered)
+	if err == ErrNoData {
+		logger.Warn(fmt.Sprintf("no data for subset '%s' with query '%s'", subset, rendered), a.TrackingId)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
+
+// Metrics queries both error rate and latency of a given subset
+func (a *Analysis) Metrics(subset string) (Metrics, error) {
+	m := Metrics{Subset: subset}
+
+	errorRateQuery := a.Queries.ErrorRate
+	if errorRateQuery == "" {
+		errorRateQuery = DefaultErrorRateQuery
+	}
+
+	latencyQuery := a.Queries.Latency
+	if latencyQuery == "" {
+		latencyQuery = DefaultLatencyQuery
+	}
+
+	errorRate, err := a.query(errorRateQuery, subset)
+	if err != nil {
+		return Metrics{}, err
+	}
+	m.ErrorRate = errorRate
+
+	latency, err := a.query(latencyQuery, subset)
+	if err != nil {
+		return Metrics{}, err
+	}
+	if latency != nil {
+		duration := time.Duration(*latency * float64(time.Second))
+		m.Latency = &duration
+	}
+
+	return m, nil
+}
+
+// Evaluate compares a canary subset against the configured thresholds and its baseline (master-route) subset
+func (a *Analysis) Evaluate(canary string, baseline string) (Result, error) {
+	if a.Provider == nil {
+		return Result{}, errors.New("nil metrics provider")
+	}
+
+	if canary == "" {
+		return Result{}, errors.New("empty canary subset")
+	}
+
+	r := Result{Healthy: true}
+
+	var err error
+	r.Canary, err = a.Metrics(canary)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if baseline != "" {
+		r.Baseline, err = a.Metrics(baseline)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	t := a.Thresholds
+	if r.Canary.ErrorRate != nil {
+		if t.MaxErrorRate > 0 && *r.Canary.ErrorRate > t.MaxErrorRate {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("error rate '%.4f' above threshold '%.4f'", *r.Canary.ErrorRate, t.MaxErrorRate))
+		}
+
+		if t.Tolerance > 0 && r.Baseline.ErrorRate != nil && *r.Canary.ErrorRate > *r.Baseline.ErrorRate*(1+t.Tolerance) {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("error rate '%.4f' above baseline's '%.4f'", *r.Canary.ErrorRate, *r.Baseline.ErrorRate))
+		}
+	}
+
+	if r.Canary.ErrorRate == nil && (t.MaxErrorRate > 0 || t.Tolerance > 0) && !a.AllowNoData {
+		r.Reasons = append(r.Reasons, "no error rate data")
+	}
+
+	if r.Canary.Latency == nil && (t.MaxLatency > 0 || t.Tolerance > 0) && !a.AllowNoData {
+		r.Reasons = append(r.Reasons, "no latency data")
+	}
+
+	if r.Canary.Latency != nil {
+		if t.MaxLatency > 0 && *r.Canary.Latency > t.MaxLatency {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("latency '%s' above threshold '%s'", *r.Canary.Latency, t.MaxLatency))
+		}
+
+		if t.Tolerance > 0 && r.Baseline.Latency != nil && float64(*r.Canary.Latency) > float64(*r.Baseline.Latency)*(1+t.Tolerance) {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("latency '%s' above baseline's '%s'", *r.Canary.Latency, *r.Baseline.Latency))
+		}
+	}
+
+	if len(r.Reasons) > 0 {
+		r.Healthy = false
+	}
+
+	return r, nil
+}
+
+// Analyze returns whether a canary subset is healthy enough to keep receiving traffic
+func (a *Analysis) Analyze(canary string, baseline string) (bool, error) {
+	logger.Info(fmt.Sprintf("Analyzing canary subset '%s' against baseline '%s'", canary, baseline), a.TrackingId)
+
+	r, err := a.Evaluate(canary, baseline)
+	if err != nil {
+		return false, err
+	}
+
+	if r.Canary.ErrorRate == nil && r.Canary.Latency == nil && a.AllowNoData {
+		logger.Warn(fmt.Sprintf("could not find any metrics for canary subset '%s', skipping analysis", canary), a.TrackingId)
+	}
+
+	for _, reason := range r.Reasons {
+		logger.Warn(fmt.Sprintf("canary subset '%s' is unhealthy: %s", canary, reason), a.TrackingId)
+	}
+
+	return r.Healthy, nil
+}
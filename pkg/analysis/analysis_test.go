@@ -0,0 +1,201 @@
+package analysis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// discard stdout logs if not being run with '-v' flag
+	log.SetOutput(ioutil.Discard)
+	result := m.Run()
+	os.Exit(result)
+}
+
+// fakePrometheus serves a vector sample for every query which contains one of the given keys
+func fakePrometheus(samples map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		for key, value := range samples {
+			if strings.Contains(query, key) {
+				_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1571324400.000,"%s"]}]}}`, value)
+				return
+			}
+		}
+
+		_, _ = fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	}))
+}
+
+func TestPrometheus_Query_Integrated(t *testing.T) {
+	server := fakePrometheus(map[string]string{"up": "0.25"})
+	defer server.Close()
+
+	p := &Prometheus{Address: server.URL}
+
+	value, err := p.Query("up")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, value)
+
+	_, err = p.Query("down")
+	assert.Equal(t, ErrNoData, err)
+}
+
+func TestPrometheus_Query_Integrated_NaN(t *testing.T) {
+	server := fakePrometheus(map[string]string{"up": "NaN"})
+	defer server.Close()
+
+	p := &Prometheus{Address: server.URL}
+
+	_, err := p.Query("up")
+	assert.Equal(t, ErrNoData, err)
+}
+
+func TestPrometheus_Query_Integrated_Scalar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"status":"success","data":{"resultType":"scalar","result":[1571324400.000,"2"]}}`)
+	}))
+	defer server.Close()
+
+	p := &Prometheus{Address: server.URL}
+
+	value, err := p.Query("scalar(2)")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), value)
+}
+
+func TestPrometheus_Query_Integrated_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+	}))
+	defer server.Close()
+
+	p := &Prometheus{Address: server.URL}
+
+	_, err := p.Query("sum(")
+	assert.EqualError(t, err, "prometheus query failed with 'bad_data': parse error")
+}
+
+func TestAnalysis_Evaluate_Integrated(t *testing.T) {
+	cases := []struct {
+		samples    map[string]string
+		thresholds Thresholds
+		healthy    bool
+		reasons    int
+	}{
+		{
+			// healthy canary
+			map[string]string{
+				`canary",response_code`:    "0.01",
+				`baseline",response_code`:  "0.01",
+				`canary"}[1m])) by (le)`:   "0.2",
+				`baseline"}[1m])) by (le)`: "0.2",
+			},
+			Thresholds{MaxErrorRate: 0.05, MaxLatency: 500 * time.Millisecond, Tolerance: 0.1},
+			true,
+			0,
+		},
+		{
+			// canary above absolute thresholds
+			map[string]string{
+				`canary",response_code`:  "0.1",
+				`canary"}[1m])) by (le)`: "0.9",
+			},
+			Thresholds{MaxErrorRate: 0.05, MaxLatency: 500 * time.Millisecond},
+			false,
+			2,
+		},
+		{
+			// canary worse than baseline
+			map[string]string{
+				`canary",response_code`:    "0.04",
+				`baseline",response_code`:  "0.01",
+				`canary"}[1m])) by (le)`:   "0.4",
+				`baseline"}[1m])) by (le)`: "0.2",
+			},
+			Thresholds{MaxErrorRate: 0.05, MaxLatency: 500 * time.Millisecond, Tolerance: 0.1},
+			false,
+			2,
+		},
+		{
+			// canary without any data
+			map[string]string{},
+			Thresholds{MaxErrorRate: 0.05, MaxLatency: 500 * time.Millisecond, Tolerance: 0.1},
+			false,
+			2,
+		},
+	}
+
+	for _, tt := range cases {
+		server := fakePrometheus(tt.samples)
+
+		a := &Analysis{
+			TrackingId: "unit-testing-uuid",
+			Provider:   &Prometheus{Address: server.URL},
+			Thresholds: tt.thresholds,
+		}
+
+		r, err := a.Evaluate("canary", "baseline")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.healthy, r.Healthy)
+		assert.Equal(t, tt.reasons, len(r.Reasons))
+
+		server.Close()
+	}
+}
+
+func TestAnalysis_Evaluate_Integrated_AllowNoData(t *testing.T) {
+	server := fakePrometheus(map[string]string{})
+	defer server.Close()
+
+	a := &Analysis{
+		TrackingId:  "unit-testing-uuid",
+		Provider:    &Prometheus{Address: server.URL},
+		Thresholds:  Thresholds{MaxErrorRate: 0.05, MaxLatency: 500 * time.Millisecond},
+		AllowNoData: true,
+	}
+
+	r, err := a.Evaluate("canary", "baseline")
+	assert.NoError(t, err)
+	assert.True(t, r.Healthy)
+	assert.Equal(t, 0, len(r.Reasons))
+}
+
+func TestAnalysis_Evaluate_Unit_CustomQueries(t *testing.T) {
+	server := fakePrometheus(map[string]string{"api-1-default@5m": "0.5"})
+	defer server.Close()
+
+	a := &Analysis{
+		TrackingId: "unit-testing-uuid",
+		Provider:   &Prometheus{Address: server.URL},
+		Queries: Queries{
+			ErrorRate: "{{ .Subset }}@{{ .Window }}",
+			Latency:   "latency",
+		},
+		Thresholds: Thresholds{MaxErrorRate: 0.1},
+		Window:     "5m",
+	}
+
+	r, err := a.Evaluate("api-1-default", "")
+	assert.NoError(t, err)
+	assert.False(t, r.Healthy)
+	assert.Equal(t, 0.5, *r.Canary.ErrorRate)
+	assert.Nil(t, r.Canary.Latency)
+}
+
+func TestAnalysis_Evaluate_Unit_EmptyCanary(t *testing.T) {
+	a := &Analysis{Provider: &Prometheus{}}
+
+	_, err := a.Evaluate("", "baseline")
+	assert.EqualError(t, err, "empty canary subset")
+}
@@ -0,0 +1,116 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoData is returned when a query has no samples to be evaluated (ex: a subset which did not receive any request)
+var ErrNoData = errors.New("query returned no data")
+
+// Provider returns a single value for a given metrics query
+type Provider interface {
+	Query(query string) (float64, error)
+}
+
+// Prometheus queries any Prometheus-compatible HTTP API
+type Prometheus struct {
+	Address string
+	Client  *http.Client
+}
+
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type prometheusSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+// Query returns the value of the first sample of an instant query
+func (p *Prometheus) Query(query string) (float64, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v1/query?query=%s", strings.TrimRight(p.Address, "/"), url.QueryEscape(query))
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	pr := prometheusResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&pr)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("could not decode prometheus response (status code '%d'): %s", resp.StatusCode, err))
+	}
+
+	if pr.Status != "success" {
+		return 0, errors.New(fmt.Sprintf("prometheus query failed with '%s': %s", pr.ErrorType, pr.Error))
+	}
+
+	var sample []interface{}
+	switch pr.Data.ResultType {
+	case "scalar":
+		err = json.Unmarshal(pr.Data.Result, &sample)
+		if err != nil {
+			return 0, err
+		}
+	case "vector":
+		var series []prometheusSeries
+		err = json.Unmarshal(pr.Data.Result, &series)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(series) == 0 {
+			return 0, ErrNoData
+		}
+		sample = series[0].Value
+	default:
+		return 0, errors.New(fmt.Sprintf("unsupported prometheus result type '%s'", pr.Data.ResultType))
+	}
+
+	return parseSample(sample)
+}
+
+// parseSample returns the value of a '[ <unix_time>, "<sample_value>" ]' pair
+func parseSample(sample []interface{}) (float64, error) {
+	if len(sample) != 2 {
+		return 0, errors.New("malformed prometheus sample")
+	}
+
+	raw, ok := sample[1].(string)
+	if !ok {
+		return 0, errors.New("malformed prometheus sample value")
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	// NaN is returned by prometheus when dividing by a subset without requests
+	if math.IsNaN(value) {
+		return 0, ErrNoData
+	}
+
+	return value, nil
+}
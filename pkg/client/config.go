@@ -1,8 +1,13 @@
 package client
 
 import (
+	"fmt"
+
 	"github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned"
 	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 
 	// in order to solve a gcp bug when trying to get the kubeconfig
@@ -15,6 +20,10 @@ import (
 type Set struct {
 	Kubernetes kubernetes.Interface
 	Istio      router.IstioClientInterface
+	// Dynamic is bound to istiops' own custom resources group ('istiops.io/v1alpha1')
+	Dynamic dynamic.Interface
+	// User is the name of the kube context's user, if any
+	User string
 }
 
 // ToRawKubeConfigLoader returns a ClientConfig with overrided attributes such as 'context'
@@ -43,7 +52,8 @@ func New(kubeContext string, kubeConfigPath string) (*Set, error) {
 	var config *rest.Config
 	var err error
 
-	config, err = ToRawKubeConfigLoader(kubeContext, kubeConfigPath).ClientConfig()
+	loader := ToRawKubeConfigLoader(kubeContext, kubeConfigPath)
+	config, err = loader.ClientConfig()
 	if err != nil {
 		return &Set{}, err
 	}
@@ -59,10 +69,67 @@ func New(kubeContext string, kubeConfigPath string) (*Set, error) {
 		return &Set{}, err
 	}
 
+	dynamicConfig := rest.CopyConfig(config)
+	dynamicConfig.GroupVersion = &schema.GroupVersion{Group: "istiops.io", Version: "v1alpha1"}
+	dynamicConfig.APIPath = "/apis"
+	dynamicClient, err := dynamic.NewClient(dynamicConfig)
+	if err != nil {
+		return &Set{}, err
+	}
+
 	client := &Set{
 		Kubernetes: kubeClient,
 		Istio:      istioClient,
+		Dynamic:    dynamicClient,
+		User:       contextUser(loader, kubeContext),
 	}
 
 	return client, nil
 }
+
+// contextUser returns the user of a kube context (or of the current one when empty) from the kubeconfig
+func contextUser(loader clientcmd.ClientConfig, kubeContext string) string {
+	rawConfig, err := loader.RawConfig()
+	if err != nil {
+		return ""
+	}
+
+	if kubeContext == "" {
+		kubeContext = rawConfig.CurrentContext
+	}
+
+	context, ok := rawConfig.Contexts[kubeContext]
+	if !ok {
+		return ""
+	}
+
+	return context.AuthInfo
+}
+
+// Cluster is the clientset of a kube context
+type Cluster struct {
+	Context string
+	*Set
+}
+
+// NewClusters will return the clientsets of many kube contexts, in the given order
+func NewClusters(kubeContexts []string, kubeConfigPath string) ([]Cluster, error) {
+	var clusters []Cluster
+	seen := map[string]bool{}
+
+	for _, kubeContext := range kubeContexts {
+		if seen[kubeContext] {
+			return nil, errors.New(fmt.Sprintf("context '%s' was given more than once", kubeContext))
+		}
+		seen[kubeContext] = true
+
+		set, err := New(kubeContext, kubeConfigPath)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("context '%s': %s", kubeContext, err))
+		}
+
+		clusters = append(clusters, Cluster{Context: kubeContext, Set: set})
+	}
+
+	return clusters, nil
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// TrafficShiftInterface lists, watches and records the status of TrafficShift custom resources
+type TrafficShiftInterface interface {
+	List(namespace string) ([]TrafficShift, error)
+	Watch(namespace string) (watch.Interface, error)
+	UpdateStatus(ts *TrafficShift) (*TrafficShift, error)
+}
+
+// DynamicTrafficShifts is a TrafficShiftInterface backed by a dynamic client of the 'istiops.io/v1alpha1' group
+type DynamicTrafficShifts struct {
+	Client dynamic.Interface
+}
+
+func (d *DynamicTrafficShifts) resource(name string, namespace string) dynamic.ResourceInterface {
+	return d.Client.Resource(&metav1.APIResource{Name: name, Namespaced: true, Kind: Kind}, namespace)
+}
+
+// List returns every TrafficShift of a namespace, empty meaning all namespaces
+func (d *DynamicTrafficShifts) List(namespace string) ([]TrafficShift, error) {
+	obj, err := d.resource(Resource, namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := obj.(*unstructured.UnstructuredList)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unexpected list of trafficShifts '%T'", obj))
+	}
+
+	var trafficShifts []TrafficShift
+	for i := range list.Items {
+		ts, err := FromUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		trafficShifts = append(trafficShifts, *ts)
+	}
+
+	return trafficShifts, nil
+}
+
+// Watch returns the changes of TrafficShifts of a namespace, empty meaning all namespaces
+func (d *DynamicTrafficShifts) Watch(namespace string) (watch.Interface, error) {
+	return d.resource(Resource, namespace).Watch(metav1.ListOptions{})
+}
+
+// UpdateStatus records the status of a TrafficShift through its status subresource
+func (d *DynamicTrafficShifts) UpdateStatus(ts *TrafficShift) (*TrafficShift, error) {
+	obj, err := ToUnstructured(ts)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := d.resource(Resource+"/status", ts.Namespace).Update(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromUnstructured(updated)
+}
+
+// FromUnstructured converts an unstructured object to a TrafficShift
+func FromUnstructured(obj *unstructured.Unstructured) (*TrafficShift, error) {
+	value, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &TrafficShift{}
+	err = json.Unmarshal(value, ts)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not parse trafficShift '%s': %s", obj.GetName(), err))
+	}
+
+	return ts, nil
+}
+
+// ToUnstructured converts a TrafficShift to an unstructured object
+func ToUnstructured(ts *TrafficShift) (*unstructured.Unstructured, error) {
+	ts.APIVersion = fmt.Sprintf("%s/%s", Group, Version)
+	ts.Kind = Kind
+
+	value, err := json.Marshal(ts)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &unstructured.Unstructured{}
+	err = json.Unmarshal(value, &obj.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
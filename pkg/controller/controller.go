@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/operator"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// DefaultResync is the period which every TrafficShift is applied again, correcting drifts of istio's resources
+const DefaultResync = 5 * time.Minute
+
+const (
+	reasonReconciling = "Reconciling"
+	reasonReconciled  = "Reconciled"
+	reasonFailed      = "Failed"
+	reasonInvalidSpec = "InvalidSpec"
+	reasonShiftFailed = "ShiftFailed"
+	reasonClearFailed = "ClearFailed"
+	reasonConverged   = "Converged"
+)
+
+// Controller converges istio's resources to TrafficShift custom resources
+type Controller struct {
+	TrackingId string
+	// Namespace of the watched TrafficShifts, empty meaning all namespaces
+	Namespace     string
+	TrafficShifts TrafficShiftInterface
+	Istio         router.IstioClientInterface
+	KubeClient    router.KubeClientInterface
+	// Resync period of TrafficShifts, DefaultResync is used when empty
+	Resync time.Duration
+	// Audit of the changes made by reconciling TrafficShifts
+	Audit router.Audit
+}
+
+// Run reconciles every TrafficShift at start, on each change and on every resync period until stop is closed
+func (c *Controller) Run(stop <-chan struct{}) error {
+	resync := c.Resync
+	if resync == 0 {
+		resync = DefaultResync
+	}
+
+	c.resync()
+
+	w, err := c.TrafficShifts.Watch(c.Namespace)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(resync)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			w.Stop()
+			return nil
+		case <-ticker.C:
+			c.resync()
+		case event, ok := <-w.ResultChan():
+			// watches are closed by the api-server from time to time
+			if !ok {
+				logger.Debug("Watch of trafficShifts closed, watching again", c.TrackingId)
+				w, err = c.TrafficShifts.Watch(c.Namespace)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			c.handle(event)
+		}
+	}
+}
+
+// handle reconciles a TrafficShift which spec was added or changed. Deleted TrafficShifts are not handled: istio's
+// resources are kept as they were last converged, until they're cleared by 'istiops traffic clear'
+func (c *Controller) handle(event watch.Event) {
+	if event.Type == watch.Deleted {
+		if obj, ok := event.Object.(*unstructured.Unstructured); ok {
+			logger.Info(fmt.Sprintf("TrafficShift '%s/%s' deleted, keeping its routes", obj.GetNamespace(), obj.GetName()), c.TrackingId)
+		}
+		return
+	}
+
+	if event.Type != watch.Added && event.Type != watch.Modified {
+		return
+	}
+
+	obj, ok := event.Object.(*unstructured.Unstructured)
+	if !ok {
+		logger.Warn(fmt.Sprintf("unexpected trafficShift object '%T'", event.Object), c.TrackingId)
+		return
+	}
+
+	ts, err := FromUnstructured(obj)
+	if err != nil {
+		logger.Error(fmt.Sprintf("%s", err), c.TrackingId)
+		return
+	}
+
+	// status updates are changes as well, but only spec changes must be applied
+	if ts.Status.ObservedGeneration == ts.Generation {
+		return
+	}
+
+	err = c.Reconcile(ts)
+	if err != nil {
+		logger.Error(fmt.Sprintf("%s", err), c.TrackingId)
+	}
+}
+
+func (c *Controller) resync() {
+	trafficShifts, err := c.TrafficShifts.List(c.Namespace)
+	if err != nil {
+		logger.Error(fmt.Sprintf("could not list trafficShifts: %s", err), c.TrackingId)
+		return
+	}
+
+	for i := range trafficShifts {
+		err := c.Reconcile(&trafficShifts[i])
+		if err != nil {
+			logger.Error(fmt.Sprintf("%s", err), c.TrackingId)
+		}
+	}
+}
+
+// Reconcile applies a TrafficShift to istio's resources, recording the outcome at its status conditions. Converged
+// TrafficShifts are skipped while neither their spec nor istio's resources change
+func (c *Controller) Reconcile(ts *TrafficShift) error {
+	if c.unchanged(ts) {
+		logger.Debug(fmt.Sprintf("TrafficShift '%s/%s' has not changed since converged, skipping", ts.Namespace, ts.Name), c.TrackingId)
+		return nil
+	}
+
+	logger.Info(fmt.Sprintf("Reconciling trafficShift '%s/%s'", ts.Namespace, ts.Name), c.TrackingId)
+
+	// a new spec is being applied
+	if ts.Status.ObservedGeneration != ts.Generation {
+		ts.Status.SetCondition(Condition{Type: ConditionProgressing, Status: "True", Reason: reasonReconciling})
+		updated, err := c.TrafficShifts.UpdateStatus(ts)
+		if err != nil {
+			return errors.New(fmt.Sprintf("could not update status of trafficShift '%s/%s': %s", ts.Namespace, ts.Name, err))
+		}
+		ts = updated
+	}
+
+	previous := TrafficShiftStatus{
+		ObservedGeneration: ts.Status.ObservedGeneration,
+		Conditions:         append([]Condition(nil), ts.Status.Conditions...),
+		ResourcesHash:      ts.Status.ResourcesHash,
+	}
+
+	reason, hash, applyErr := c.apply(ts)
+	ts.Status.ResourcesHash = hash
+
+	ts.Status.ObservedGeneration = ts.Generation
+	if applyErr != nil {
+		ts.Status.SetCondition(Condition{Type: ConditionProgressing, Status: "False", Reason: reasonFailed})
+		ts.Status.SetCondition(Condition{Type: ConditionReady, Status: "False", Reason: reason, Message: fmt.Sprintf("%s", applyErr)})
+	} else {
+		ts.Status.SetCondition(Condition{Type: ConditionProgressing, Status: "False", Reason: reasonReconciled})
+		ts.Status.SetCondition(Condition{Type: ConditionReady, Status: "True", Reason: reasonConverged})
+	}
+
+	// resyncs of converged trafficShifts don't change their status
+	if !reflect.DeepEqual(previous, ts.Status) {
+		_, err := c.TrafficShifts.UpdateStatus(ts)
+		if err != nil {
+			return errors.New(fmt.Sprintf("could not update status of trafficShift '%s/%s': %s", ts.Namespace, ts.Name, err))
+		}
+	}
+
+	if applyErr != nil {
+		return errors.New(fmt.Sprintf("could not reconcile trafficShift '%s/%s': %s", ts.Namespace, ts.Name, applyErr))
+	}
+
+	return nil
+}
+
+// unchanged returns whether a TrafficShift has converged and neither its spec nor istio's resources changed since then.
+// Soft clears depend on pods as well, so those TrafficShifts are always reconciled
+func (c *Controller) unchanged(ts *TrafficShift) bool {
+	ready := ts.Status.Condition(ConditionReady)
+	if ts.Status.ObservedGeneration != ts.Generation || ready == nil || ready.Status != "True" || ts.Status.ResourcesHash == "" || ts.Spec.Clear == "soft" {
+		return false
+	}
+
+	op, shift, _, err := c.operator(ts)
+	if err != nil {
+		return false
+	}
+
+	hash, err := resourcesHash(op, shift.Selector)
+	if err != nil {
+		return false
+	}
+
+	return hash == ts.Status.ResourcesHash
+}
+
+// operator returns the operator and shift of a TrafficShift, along with the reason of an invalid spec
+func (c *Controller) operator(ts *TrafficShift) (*operator.Istiops, router.Shift, string, error) {
+	err := ts.Spec.Validate()
+	if err != nil {
+		return nil, router.Shift{}, reasonInvalidSpec, err
+	}
+
+	if ts.Spec.Clear != "" && ts.Spec.Clear != "soft" && ts.Spec.Clear != "hard" {
+		return nil, router.Shift{}, reasonInvalidSpec, errors.New(fmt.Sprintf("clear mode '%s' must be 'soft' or 'hard'", ts.Spec.Clear))
+	}
+
+	shift, err := ts.Spec.Shift()
+	if err != nil {
+		return nil, router.Shift{}, reasonInvalidSpec, err
+	}
+
+	masterRoute, err := router.ParseMasterRoute(ts.Spec.MasterRoute)
+	if err != nil {
+		return nil, router.Shift{}, reasonInvalidSpec, err
+	}
+
+	namespace := ts.Spec.Namespace
+	if namespace == "" {
+		namespace = ts.Namespace
+	}
+
+	op := &operator.Istiops{
+		DrRouter: &router.DestinationRule{
+			TrackingId: c.TrackingId,
+			Name:       shift.Hostname,
+			Namespace:  namespace,
+			Build:      ts.Spec.Build,
+			Istio:      c.Istio,
+			KubeClient: c.KubeClient,
+			Audit:      c.Audit,
+		},
+		VsRouter: &router.VirtualService{
+			TrackingId:  c.TrackingId,
+			Name:        shift.Hostname,
+			Namespace:   namespace,
+			Build:       ts.Spec.Build,
+			Istio:       c.Istio,
+			KubeClient:  c.KubeClient,
+			Audit:       c.Audit,
+			MasterRoute: masterRoute,
+		},
+	}
+
+	return op, shift, "", nil
+}
+
+// apply shifts (and clears) istio's resources of a TrafficShift, returning the hash of the converged resources or the
+// reason of a failure
+func (c *Controller) apply(ts *TrafficShift) (string, string, error) {
+	op, shift, reason, err := c.operator(ts)
+	if err != nil {
+		return reason, "", err
+	}
+
+	err = op.Update(shift)
+	if err != nil {
+		return reasonShiftFailed, "", err
+	}
+
+	if ts.Spec.Clear != "" {
+		err = op.Clear(router.Shift{Selector: shift.Selector}, ts.Spec.Clear)
+		if err != nil {
+			return reasonClearFailed, "", err
+		}
+	}
+
+	hash, err := resourcesHash(op, shift.Selector)
+	if err != nil {
+		// resources are converged anyway, they're only reconciled again at the next resync
+		logger.Warn(fmt.Sprintf("could not hash resources of trafficShift '%s/%s': %s", ts.Namespace, ts.Name, err), c.TrackingId)
+		return "", "", nil
+	}
+
+	return "", hash, nil
+}
+
+// resourcesHash returns the hash of the specs of virtualServices and destinationRules matched by a selector
+func resourcesHash(op *operator.Istiops, selector map[string]string) (string, error) {
+	irl, err := op.Get(selector)
+	if err != nil {
+		return "", err
+	}
+
+	var specs []string
+	for i := range irl.VList.Items {
+		vs := irl.VList.Items[i]
+		text, err := router.SpecText(&vs.Spec.VirtualService)
+		if err != nil {
+			return "", err
+		}
+		specs = append(specs, fmt.Sprintf("VirtualService/%s/%s\n%s", vs.Namespace, vs.Name, text))
+	}
+
+	for i := range irl.DList.Items {
+		dr := irl.DList.Items[i]
+		text, err := router.SpecText(&dr.Spec.DestinationRule)
+		if err != nil {
+			return "", err
+		}
+		specs = append(specs, fmt.Sprintf("DestinationRule/%s/%s\n%s", dr.Namespace, dr.Name, text))
+	}
+	sort.Strings(specs)
+
+	sum := sha256.Sum256([]byte(strings.Join(specs, "")))
+
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/pismo/istiops/pkg/spec"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func TestMain(m *testing.M) {
+	// discard stdout logs if not being run with '-v' flag
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeTrafficShifts keeps TrafficShifts in memory
+type fakeTrafficShifts struct {
+	sync.Mutex
+	items   []TrafficShift
+	updates []TrafficShift
+	watcher *watch.FakeWatcher
+}
+
+func (f *fakeTrafficShifts) List(namespace string) ([]TrafficShift, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	return append([]TrafficShift(nil), f.items...), nil
+}
+
+func (f *fakeTrafficShifts) Watch(namespace string) (watch.Interface, error) {
+	return f.watcher, nil
+}
+
+func (f *fakeTrafficShifts) UpdateStatus(ts *TrafficShift) (*TrafficShift, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.updates = append(f.updates, *ts)
+	updated := *ts
+
+	return &updated, nil
+}
+
+func (f *fakeTrafficShifts) lastUpdate() (TrafficShift, int) {
+	f.Lock()
+	defer f.Unlock()
+
+	if len(f.updates) == 0 {
+		return TrafficShift{}, 0
+	}
+
+	return f.updates[len(f.updates)-1], len(f.updates)
+}
+
+func trafficShift(build uint32) TrafficShift {
+	ts := TrafficShift{
+		Spec: TrafficShiftSpec{
+			ShiftSpec: spec.ShiftSpec{
+				Destination:   "api-service:5000",
+				Build:         build,
+				LabelSelector: map[string]string{"environment": "integration-tests"},
+				PodSelector:   map[string]string{"app": "api", "build": "2"},
+				Match:         &spec.MatchSpec{Headers: map[string]string{"x-version": "2"}},
+			},
+		},
+	}
+	ts.Name = "api-shift"
+	ts.Namespace = "integration"
+	ts.Generation = 1
+
+	return ts
+}
+
+func fakeController() (*Controller, *istioFake.Clientset) {
+	istioClient := istioFake.NewSimpleClientset()
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = "integration"
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-service-1-integration"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = "integration"
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-service-1-integration", Labels: map[string]string{"app": "api", "build": "1"}},
+	}
+
+	_, _ = istioClient.NetworkingV1alpha3().VirtualServices(v.Namespace).Create(&v)
+	_, _ = istioClient.NetworkingV1alpha3().DestinationRules(d.Namespace).Create(&d)
+
+	c := &Controller{
+		TrackingId:    "unit-testing-uuid",
+		TrafficShifts: &fakeTrafficShifts{watcher: watch.NewFake()},
+		Istio:         istioClient,
+		KubeClient:    kubeFake.NewSimpleClientset(),
+	}
+
+	return c, istioClient
+}
+
+func TestTrafficShiftStatus_Unit_SetCondition(t *testing.T) {
+	status := TrafficShiftStatus{}
+
+	transition := metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	status.SetCondition(Condition{Type: ConditionReady, Status: "True", LastTransitionTime: transition})
+	assert.Equal(t, 1, len(status.Conditions))
+
+	// same status keeps its transition time
+	status.SetCondition(Condition{Type: ConditionReady, Status: "True", Reason: reasonConverged})
+	assert.Equal(t, transition, status.Condition(ConditionReady).LastTransitionTime)
+	assert.Equal(t, reasonConverged, status.Condition(ConditionReady).Reason)
+
+	status.SetCondition(Condition{Type: ConditionReady, Status: "False"})
+	assert.Equal(t, 1, len(status.Conditions))
+	assert.NotEqual(t, transition, status.Condition(ConditionReady).LastTransitionTime)
+
+	assert.Nil(t, status.Condition(ConditionProgressing))
+}
+
+func TestController_Reconcile_Integrated(t *testing.T) {
+	c, istioClient := fakeController()
+	ts := trafficShift(2)
+
+	err := c.Reconcile(&ts)
+	assert.NoError(t, err)
+
+	re, _ := istioClient.NetworkingV1alpha3().VirtualServices("integration").Get("integration-test-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, 2, len(re.Spec.Http))
+	assert.Equal(t, "api-service-2-integration", re.Spec.Http[0].Route[0].Destination.Subset)
+	assert.Equal(t, "2", re.Spec.Http[0].Match[0].Headers["x-version"].GetExact())
+
+	fake := c.TrafficShifts.(*fakeTrafficShifts)
+	updated, updates := fake.lastUpdate()
+	// progressing & converged states
+	assert.Equal(t, 2, updates)
+	assert.Equal(t, int64(1), updated.Status.ObservedGeneration)
+	assert.Equal(t, "True", updated.Status.Condition(ConditionReady).Status)
+	assert.Equal(t, reasonConverged, updated.Status.Condition(ConditionReady).Reason)
+	assert.Equal(t, "False", updated.Status.Condition(ConditionProgressing).Status)
+
+	assert.NotEmpty(t, updated.Status.ResourcesHash)
+
+	// a resync of a converged trafficShift does not change its status
+	err = c.Reconcile(&updated)
+	assert.NoError(t, err)
+	_, updates = fake.lastUpdate()
+	assert.Equal(t, 2, updates)
+}
+
+func TestController_Reconcile_Integrated_Unchanged(t *testing.T) {
+	c, istioClient := fakeController()
+	ts := trafficShift(2)
+
+	assert.NoError(t, c.Reconcile(&ts))
+	converged, _ := c.TrafficShifts.(*fakeTrafficShifts).lastUpdate()
+
+	// converged trafficShifts aren't applied again while istio's resources are unchanged
+	istioClient.ClearActions()
+	assert.NoError(t, c.Reconcile(&converged))
+	for _, action := range istioClient.Actions() {
+		assert.NotEqual(t, "update", action.GetVerb())
+	}
+
+	// resources which drifted are applied again
+	re, _ := istioClient.NetworkingV1alpha3().VirtualServices("integration").Get("integration-test-virtualservice", metav1.GetOptions{})
+	re.Spec.Http = re.Spec.Http[1:]
+	_, _ = istioClient.NetworkingV1alpha3().VirtualServices("integration").Update(re)
+
+	assert.NoError(t, c.Reconcile(&converged))
+	re, _ = istioClient.NetworkingV1alpha3().VirtualServices("integration").Get("integration-test-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, 2, len(re.Spec.Http))
+}
+
+func TestController_Reconcile_Integrated_ErrorCases(t *testing.T) {
+	failureCases := []struct {
+		ts     func() TrafficShift
+		reason string
+		err    string
+	}{
+		{
+			func() TrafficShift {
+				ts := trafficShift(0)
+				return ts
+			},
+			reasonInvalidSpec,
+			"could not reconcile trafficShift 'integration/api-shift': empty build",
+		},
+		{
+			func() TrafficShift {
+				ts := trafficShift(2)
+				ts.Spec.Clear = "all"
+				return ts
+			},
+			reasonInvalidSpec,
+			"could not reconcile trafficShift 'integration/api-shift': clear mode 'all' must be 'soft' or 'hard'",
+		},
+		{
+			func() TrafficShift {
+				ts := trafficShift(2)
+				ts.Spec.LabelSelector = map[string]string{"environment": "nonexistent"}
+				return ts
+			},
+			reasonShiftFailed,
+			"could not reconcile trafficShift 'integration/api-shift': could not find any destinationRules which matched label-selector 'environment=nonexistent'",
+		},
+	}
+
+	for _, tt := range failureCases {
+		c, _ := fakeController()
+		ts := tt.ts()
+
+		err := c.Reconcile(&ts)
+		assert.EqualError(t, err, tt.err)
+
+		updated, _ := c.TrafficShifts.(*fakeTrafficShifts).lastUpdate()
+		assert.Equal(t, "False", updated.Status.Condition(ConditionReady).Status)
+		assert.Equal(t, tt.reason, updated.Status.Condition(ConditionReady).Reason)
+	}
+}
+
+func TestController_Run_Integrated(t *testing.T) {
+	c, istioClient := fakeController()
+	fake := c.TrafficShifts.(*fakeTrafficShifts)
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- c.Run(stop)
+	}()
+
+	ts := trafficShift(2)
+	obj, err := ToUnstructured(&ts)
+	assert.NoError(t, err)
+	fake.watcher.Add(obj)
+
+	for i := 0; i < 100; i++ {
+		if updated, _ := fake.lastUpdate(); updated.Status.Condition(ConditionReady) != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stop)
+	assert.NoError(t, <-done)
+
+	updated, _ := fake.lastUpdate()
+	assert.Equal(t, "True", updated.Status.Condition(ConditionReady).Status)
+
+	re, _ := istioClient.NetworkingV1alpha3().VirtualServices("integration").Get("integration-test-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, "api-service-2-integration", re.Spec.Http[0].Route[0].Destination.Subset)
+}
+
+func TestDynamicTrafficShifts_Unit(t *testing.T) {
+	ts := trafficShift(2)
+	ts.Spec.Clear = "soft"
+	obj, err := ToUnstructured(&ts)
+	assert.NoError(t, err)
+	assert.Equal(t, "istiops.io/v1alpha1", obj.GetAPIVersion())
+	assert.Equal(t, "TrafficShift", obj.GetKind())
+
+	fake := &k8sTesting.Fake{}
+	fake.AddReactor("list", "trafficshifts", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, &unstructured.UnstructuredList{Items: []unstructured.Unstructured{*obj}}, nil
+	})
+
+	var updatedResource string
+	fake.AddReactor("update", "*", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		updatedResource = action.GetResource().Resource
+		return true, action.(k8sTesting.UpdateAction).GetObject(), nil
+	})
+
+	d := &DynamicTrafficShifts{
+		Client: &dynamicFake.FakeClient{GroupVersion: schema.GroupVersion{Group: Group, Version: Version}, Fake: fake},
+	}
+
+	trafficShifts, err := d.List("integration")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(trafficShifts))
+	assert.Equal(t, "api-service:5000", trafficShifts[0].Spec.Destination)
+	assert.Equal(t, "soft", trafficShifts[0].Spec.Clear)
+	assert.Equal(t, "2", trafficShifts[0].Spec.Match.Headers["x-version"])
+
+	trafficShifts[0].Status.SetCondition(Condition{Type: ConditionReady, Status: "True"})
+	updated, err := d.UpdateStatus(&trafficShifts[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "trafficshifts/status", updatedResource)
+	assert.Equal(t, "True", updated.Status.Condition(ConditionReady).Status)
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"github.com/pismo/istiops/pkg/spec"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Group of istiops' custom resources
+	Group = "istiops.io"
+	// Version of istiops' custom resources
+	Version = "v1alpha1"
+	// Kind of the TrafficShift custom resource
+	Kind = "TrafficShift"
+	// Resource is the plural name of the TrafficShift custom resource
+	Resource = "trafficshifts"
+)
+
+const (
+	// ConditionReady tells whether istio's resources have converged to the TrafficShift
+	ConditionReady = "Ready"
+	// ConditionProgressing tells whether the TrafficShift is being applied
+	ConditionProgressing = "Progressing"
+)
+
+// TrafficShift is the desired traffic of a destination, continuously applied by the controller
+type TrafficShift struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TrafficShiftSpec   `json:"spec"`
+	Status TrafficShiftStatus `json:"status,omitempty"`
+}
+
+// TrafficShiftSpec is a shift of a traffic spec file, which namespace defaults to the TrafficShift one
+type TrafficShiftSpec struct {
+	spec.ShiftSpec
+	// Clear removes routes after each shift: 'soft', 'hard' or empty for none
+	Clear string `json:"clear,omitempty"`
+}
+
+// TrafficShiftStatus is the outcome of the last reconciliation of a TrafficShift
+type TrafficShiftStatus struct {
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	Conditions         []Condition `json:"conditions,omitempty"`
+	// ResourcesHash is the hash of istio's resources specs once converged, which tells whether they drifted since then
+	ResourcesHash string `json:"resourcesHash,omitempty"`
+}
+
+// Condition is the state of an aspect of a TrafficShift
+type Condition struct {
+	Type               string      `json:"type"`
+	Status             string      `json:"status"`
+	Reason             string      `json:"reason,omitempty"`
+	Message            string      `json:"message,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// Condition returns the condition of a given type, nil when it was never set
+func (s *TrafficShiftStatus) Condition(conditionType string) *Condition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// SetCondition adds or replaces a condition, keeping its transition time while its status does not change
+func (s *TrafficShiftStatus) SetCondition(c Condition) {
+	current := s.Condition(c.Type)
+	if current == nil {
+		if c.LastTransitionTime.IsZero() {
+			c.LastTransitionTime = metav1.Now()
+		}
+		s.Conditions = append(s.Conditions, c)
+		return
+	}
+
+	if current.Status == c.Status {
+		c.LastTransitionTime = current.LastTransitionTime
+	} else if c.LastTransitionTime.IsZero() {
+		c.LastTransitionTime = metav1.Now()
+	}
+	*current = c
+}
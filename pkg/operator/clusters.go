@@ -0,0 +1,115 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ClusterUpdated is the result of a cluster which has been shifted
+	ClusterUpdated = "updated"
+	// ClusterFailed is the result of the cluster which could not be shifted, having its own changes reverted
+	ClusterFailed = "failed"
+	// ClusterReverted is the result of a cluster shifted before another one failed, put back to its previous state
+	ClusterReverted = "reverted"
+	// ClusterSkipped is the result of a cluster which was not touched, as a previous one failed
+	ClusterSkipped = "skipped"
+)
+
+// Cluster is an operator bound to the clients of a kube context
+type Cluster struct {
+	Name     string
+	Operator *Istiops
+}
+
+// ClusterResult is the outcome of a shift at a cluster
+type ClusterResult struct {
+	Cluster string
+	Status  string
+	Error   string `json:",omitempty"`
+}
+
+// MultiCluster shifts the traffic of the same service at many clusters
+type MultiCluster struct {
+	TrackingId string
+	Clusters   []Cluster
+}
+
+// Update applies a shift to every cluster, in order, with all-or-nothing semantics: once a cluster fails, clusters
+// already shifted are reverted to their previous state and the remaining ones are skipped
+func (m *MultiCluster) Update(shift router.Shift) ([]ClusterResult, error) {
+	if len(m.Clusters) == 0 {
+		return nil, errors.New("at least one cluster must be given")
+	}
+
+	// every cluster must be able to be reverted before any of them is touched
+	for _, cluster := range m.Clusters {
+		if !cluster.Operator.DryRun && !cluster.Operator.revertible() {
+			return nil, errors.New(fmt.Sprintf("cluster '%s': router is not able to revert resources", cluster.Name))
+		}
+	}
+
+	results := make([]ClusterResult, len(m.Clusters))
+	snapshots := make([]*router.IstioRouteList, len(m.Clusters))
+	for i, cluster := range m.Clusters {
+		results[i] = ClusterResult{Cluster: cluster.Name, Status: ClusterSkipped}
+	}
+
+	for i, cluster := range m.Clusters {
+		op := cluster.Operator
+
+		if !op.DryRun {
+			snapshot, err := op.snapshot(shift.Selector)
+			if err != nil {
+				results[i].Status = ClusterFailed
+				results[i].Error = err.Error()
+				return results, m.rollback(results, snapshots, i, cluster.Name, err)
+			}
+			snapshots[i] = snapshot
+		}
+
+		logger.Info(fmt.Sprintf("Shifting cluster '%s'", cluster.Name), m.TrackingId)
+		err := op.Update(shift)
+		if err != nil {
+			results[i].Status = ClusterFailed
+			results[i].Error = err.Error()
+			return results, m.rollback(results, snapshots, i, cluster.Name, err)
+		}
+
+		results[i].Status = ClusterUpdated
+	}
+
+	return results, nil
+}
+
+// rollback reverts the clusters shifted before the failed one, returning the failure along with any revert error
+func (m *MultiCluster) rollback(results []ClusterResult, snapshots []*router.IstioRouteList, failed int, name string, cause error) error {
+	var revertErrors []string
+
+	for i := failed - 1; i >= 0; i-- {
+		cluster := m.Clusters[i]
+		if cluster.Operator.DryRun {
+			continue
+		}
+
+		logger.Warn(fmt.Sprintf("Reverting cluster '%s' as cluster '%s' failed", cluster.Name, name), m.TrackingId)
+		_, err := cluster.Operator.revert(snapshots[i])
+		if err != nil {
+			results[i].Error = fmt.Sprintf("could not revert resources due to error '%s'", err)
+			revertErrors = append(revertErrors, fmt.Sprintf("cluster '%s': %s", cluster.Name, results[i].Error))
+			continue
+		}
+
+		results[i].Status = ClusterReverted
+	}
+
+	if len(revertErrors) > 0 {
+		return errors.New(fmt.Sprintf("cluster '%s': %s; %s", name, cause, strings.Join(revertErrors, "; ")))
+	}
+
+	return errors.New(fmt.Sprintf("cluster '%s': %s", name, cause))
+}
@@ -0,0 +1,130 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMultiCluster_Unit_Update(t *testing.T) {
+	shift := router.Shift{
+		Selector: map[string]string{"app": "api"},
+		Traffic:  router.Traffic{PodSelector: map[string]string{"build": "1"}},
+	}
+
+	m := &MultiCluster{
+		TrackingId: "unit-testing-tracking-id",
+		Clusters: []Cluster{
+			{Name: "us-east-1", Operator: &Istiops{DrRouter: &MockedReverterResources{}, VsRouter: &MockedReverterResources{}}},
+			{Name: "eu-west-1", Operator: &Istiops{DrRouter: &MockedReverterResources{}, VsRouter: &MockedReverterResources{}}},
+		},
+	}
+
+	results, err := m.Update(shift)
+	assert.NoError(t, err)
+	assert.Equal(t, []ClusterResult{
+		{Cluster: "us-east-1", Status: ClusterUpdated},
+		{Cluster: "eu-west-1", Status: ClusterUpdated},
+	}, results)
+}
+
+func TestMultiCluster_Unit_UpdateFailed(t *testing.T) {
+	shift := router.Shift{
+		Selector: map[string]string{"app": "api"},
+		Traffic:  router.Traffic{PodSelector: map[string]string{"build": "1"}},
+	}
+
+	shifted := &MockedReverterResources{Reverted: []string{"virtualService 'api'"}}
+	m := &MultiCluster{
+		TrackingId: "unit-testing-tracking-id",
+		Clusters: []Cluster{
+			{Name: "us-east-1", Operator: &Istiops{DrRouter: &MockedReverterResources{}, VsRouter: shifted}},
+			{Name: "eu-west-1", Operator: &Istiops{DrRouter: &MockedReverterResources{}, VsRouter: &MockedReverterResources{UpdateErr: errors.New("forbidden")}}},
+			{Name: "sa-east-1", Operator: &Istiops{DrRouter: &MockedReverterResources{}, VsRouter: &MockedReverterResources{}}},
+		},
+	}
+
+	results, err := m.Update(shift)
+	assert.EqualError(t, err, "cluster 'eu-west-1': forbidden; reverted: none")
+	assert.Equal(t, []ClusterResult{
+		{Cluster: "us-east-1", Status: ClusterReverted},
+		{Cluster: "eu-west-1", Status: ClusterFailed, Error: "forbidden; reverted: none"},
+		{Cluster: "sa-east-1", Status: ClusterSkipped},
+	}, results)
+	assert.NotNil(t, shifted.Snapshot)
+}
+
+func TestMultiCluster_Unit_ErrorCases(t *testing.T) {
+	shift := router.Shift{
+		Selector: map[string]string{"app": "api"},
+		Traffic:  router.Traffic{PodSelector: map[string]string{"build": "1"}},
+	}
+
+	failureCases := []struct {
+		name     string
+		clusters []Cluster
+		err      string
+	}{
+		{"no clusters", nil, "at least one cluster must be given"},
+		{
+			"not revertible",
+			[]Cluster{{Name: "us-east-1", Operator: &Istiops{DrRouter: &MockedResources{}, VsRouter: &MockedResources{}}}},
+			"cluster 'us-east-1': router is not able to revert resources",
+		},
+		{
+			"revert failed",
+			[]Cluster{
+				{Name: "us-east-1", Operator: &Istiops{DrRouter: &MockedReverterResources{RevertErr: errors.New("timeout")}, VsRouter: &MockedReverterResources{}}},
+				{Name: "eu-west-1", Operator: &Istiops{DrRouter: &MockedReverterResources{UpdateErr: errors.New("forbidden")}, VsRouter: &MockedReverterResources{}}},
+			},
+			"cluster 'eu-west-1': forbidden; reverted: none; cluster 'us-east-1': could not revert resources due to error 'timeout'",
+		},
+	}
+
+	for _, tt := range failureCases {
+		m := &MultiCluster{TrackingId: "unit-testing-tracking-id", Clusters: tt.clusters}
+		_, err := m.Update(shift)
+		assert.EqualError(t, err, tt.err, tt.name)
+	}
+}
+
+func TestMultiCluster_Integrated_UpdateReverted(t *testing.T) {
+	// the second cluster has no resources at the shifted namespace
+	first, firstIstio := namespacedIstiops("default")
+	second, _ := namespacedIstiops("other")
+
+	for _, op := range []*Istiops{first, second} {
+		dr, vs := op.DrRouter.(*router.DestinationRule), op.VsRouter.(*router.VirtualService)
+		dr.Name, dr.Build = "api", 3
+		vs.Name, vs.Build = "api", 3
+	}
+
+	m := &MultiCluster{
+		TrackingId: "unit-testing-tracking-id",
+		Clusters:   []Cluster{{Name: "first", Operator: first}, {Name: "second", Operator: second}},
+	}
+
+	shift := router.Shift{
+		Port:     5000,
+		Hostname: "api",
+		Selector: map[string]string{"environment": "integration-tests"},
+		Traffic: router.Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "3"},
+			RequestHeaders: map[string]string{"x-version": "3"},
+			Exact:          true,
+		},
+	}
+
+	results, err := m.Update(shift)
+	assert.Error(t, err)
+	assert.Equal(t, ClusterReverted, results[0].Status)
+	assert.Equal(t, ClusterFailed, results[1].Status)
+
+	vs, _ := firstIstio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", v1.GetOptions{})
+	assert.Equal(t, 2, len(vs.Spec.Http))
+	dr, _ := firstIstio.NetworkingV1alpha3().DestinationRules("default").Get("api-destinationrule", v1.GetOptions{})
+	assert.Equal(t, 2, len(dr.Spec.Subsets))
+}
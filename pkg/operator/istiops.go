@@ -1,6 +1,9 @@
 package operator
 
 import (
+	"fmt"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
 	"github.com/pismo/istiops/pkg/router"
 	"github.com/pkg/errors"
 )
@@ -13,15 +16,93 @@ type Router interface {
 	List(selector map[string]string) (*router.IstioRouteList, error)
 }
 
+// RoutedLister is implemented by destinationRule routers which are able to list destinationRules of every namespace
+// which virtualServices are routed to
+type RoutedLister interface {
+	ListRouted(selector map[string]string, vsl *v1alpha32.VirtualServiceList) (*router.IstioRouteList, error)
+}
+
+// ReadinessGate is implemented by routers which are able to check the ready replicas of a shift's workloads
+type ReadinessGate interface {
+	AwaitReady(shift router.Shift, readiness router.Readiness) error
+}
+
+// DryRunner is implemented by routers which are able to print their changes instead of applying them
+type DryRunner interface {
+	SetDryRun(dryRun bool)
+}
+
 type Istiops struct {
 	DrRouter Router
 	VsRouter Router
+	// DryRun prints the diff of every resource which would be changed instead of applying it
+	DryRun bool
+	// Namespaces of Get and Clear, overriding the routers' one: results of each namespace are aggregated
+	Namespaces []string
+	// AllNamespaces selects every namespace with resources matched by the selector for Get and Clear
+	AllNamespaces bool
+	// Readiness refuses updates while the workloads of the pod-selector haven't enough ready replicas
+	Readiness router.Readiness
+}
+
+// dryRun propagates the dry-run option to every router able to handle it
+func (ips *Istiops) dryRun() error {
+	if !ips.DryRun {
+		return nil
+	}
+
+	for _, r := range []Router{ips.DrRouter, ips.VsRouter} {
+		dryRunner, ok := r.(DryRunner)
+		if !ok {
+			return errors.New("router is not able to run in dry-run mode")
+		}
+		dryRunner.SetDryRun(true)
+	}
+
+	return nil
+}
+
+// awaitReady gates an update on the ready replicas of the shift's workloads, when enabled
+func (ips *Istiops) awaitReady(shift router.Shift) error {
+	if !ips.Readiness.Enabled() {
+		return nil
+	}
+
+	gate, ok := ips.VsRouter.(ReadinessGate)
+	if !ok {
+		return errors.New("router is not able to check the readiness of workloads")
+	}
+
+	err := gate.AwaitReady(shift, ips.Readiness)
+	if err != nil {
+		return errors.New(fmt.Sprintf("refusing to shift traffic: %s", err))
+	}
+
+	return nil
 }
 
 // Get will return a list of istio resources: destinationRules & virtualServices
 func (ips *Istiops) Get(selector map[string]string) (router.IstioRouteList, error) {
+	if ips.manyNamespaces() {
+		return ips.getNamespaces(selector)
+	}
+
+	return ips.get(selector)
+}
+
+func (ips *Istiops) get(selector map[string]string) (router.IstioRouteList, error) {
+	VsRouter := ips.VsRouter
+	vsl, vsErr := VsRouter.List(selector)
+
+	// destinationRules of namespaces which virtualServices are routed to are listed as well, when supported
 	DrRouter := ips.DrRouter
-	dsl, err := DrRouter.List(selector)
+	var dsl *router.IstioRouteList
+	var err error
+	if routedLister, ok := DrRouter.(RoutedLister); ok && vsErr == nil {
+		dsl, err = routedLister.ListRouted(selector, vsl.VList)
+	} else {
+		dsl, err = DrRouter.List(selector)
+	}
 	if err != nil {
 		return router.IstioRouteList{}, err
 	}
@@ -31,10 +112,9 @@ func (ips *Istiops) Get(selector map[string]string) (router.IstioRouteList, erro
 		return router.IstioRouteList{}, err
 	}
 
-	VsRouter := ips.VsRouter
-	vsl, err := VsRouter.List(selector)
-	if err != nil {
-		return router.IstioRouteList{}, err
+	// missing destinationRules are reported before missing virtualServices
+	if vsErr != nil {
+		return router.IstioRouteList{}, vsErr
 	}
 
 	err = router.ValidateVirtualServiceList(vsl)
@@ -59,9 +139,13 @@ func (ips *Istiops) Update(shift router.Shift) error {
 		return errors.New("pod-selector must exists in need to find traffic destination")
 	}
 
+	err := ips.dryRun()
+	if err != nil {
+		return err
+	}
+
 	DrRouter := ips.DrRouter
 	VsRouter := ips.VsRouter
-	var err error
 
 	err = DrRouter.Validate(shift)
 	if err != nil {
@@ -72,24 +156,40 @@ func (ips *Istiops) Update(shift router.Shift) error {
 		return err
 	}
 
-	err = DrRouter.Update(shift)
+	// no resource is touched until the workloads are ready to receive traffic
+	err = ips.awaitReady(shift)
 	if err != nil {
 		return err
 	}
 
-	err = VsRouter.Update(shift)
-	if err != nil {
-		return err
-	}
+	// a failure at any step reverts resources already updated by the previous ones
+	return ips.transaction(shift.Selector, func() error {
+		err := DrRouter.Update(shift)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return VsRouter.Update(shift)
+	})
 }
 
 // ClearRules will remove any destination & virtualService route rules except the main one (provided by client).
 func (ips *Istiops) Clear(shift router.Shift, mode string) error {
+	if ips.manyNamespaces() {
+		return ips.clearNamespaces(shift, mode)
+	}
+
+	return ips.clear(shift, mode)
+}
+
+func (ips *Istiops) clear(shift router.Shift, mode string) error {
+	err := ips.dryRun()
+	if err != nil {
+		return err
+	}
+
 	DrRouter := ips.DrRouter
 	VsRouter := ips.VsRouter
-	var err error
 
 	// to bypass
 	shift.Traffic.RequestHeaders = map[string]string{"clear": "true"}
@@ -99,16 +199,13 @@ func (ips *Istiops) Clear(shift router.Shift, mode string) error {
 		return err
 	}
 
-	// in this scenario virtualService must be cleaned before the DestinationRule
-	err = VsRouter.Clear(shift, mode)
-	if err != nil {
-		return err
-	}
+	return ips.transaction(shift.Selector, func() error {
+		// in this scenario virtualService must be cleaned before the DestinationRule
+		err := VsRouter.Clear(shift, mode)
+		if err != nil {
+			return err
+		}
 
-	err = DrRouter.Clear(shift, mode)
-	if err != nil {
-		return err
-	}
-
-	return nil
+		return DrRouter.Clear(shift, mode)
+	})
 }
@@ -207,3 +207,86 @@ func TestUpdate_Unit_EmptyLabelSelector(t *testing.T) {
 	err := op.Update(shift)
 	assert.EqualError(t, err, "label-selector must exists in need to find resources")
 }
+
+type MockedDryRunResources struct {
+	MockedResources
+	DryRun bool
+}
+
+func (m *MockedDryRunResources) SetDryRun(dryRun bool) { m.DryRun = dryRun }
+
+func TestUpdate_Unit_DryRun(t *testing.T) {
+	dr := &MockedDryRunResources{}
+	vs := &MockedDryRunResources{}
+
+	op := &Istiops{
+		DrRouter: dr,
+		VsRouter: vs,
+		DryRun:   true,
+	}
+
+	shift := router.Shift{
+		Selector: map[string]string{"app": "api"},
+		Traffic:  router.Traffic{PodSelector: map[string]string{"build": "1"}},
+	}
+
+	err := op.Update(shift)
+	assert.NoError(t, err)
+	assert.True(t, dr.DryRun)
+	assert.True(t, vs.DryRun)
+}
+
+func TestClear_Unit_DryRunNotSupported(t *testing.T) {
+	op := &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: &MockedResources{},
+		DryRun:   true,
+	}
+
+	err := op.Clear(router.Shift{}, "hard")
+	assert.EqualError(t, err, "router is not able to run in dry-run mode")
+}
+
+func TestUpdate_Unit_ReadinessNotSupported(t *testing.T) {
+	op := &Istiops{
+		DrRouter:  &MockedResources{},
+		VsRouter:  &MockedResources{},
+		Readiness: router.Readiness{MinReady: 1},
+	}
+
+	shift := router.Shift{
+		Selector: map[string]string{"app": "api"},
+		Traffic:  router.Traffic{PodSelector: map[string]string{"build": "1"}},
+	}
+
+	err := op.Update(shift)
+	assert.EqualError(t, err, "router is not able to check the readiness of workloads")
+}
+
+func TestUpdate_Integrated_ReadinessRefused(t *testing.T) {
+	op, istioClient := namespacedIstiops("default")
+	op.Readiness = router.Readiness{MinReady: 1}
+	op.DrRouter.(*router.DestinationRule).Name, op.DrRouter.(*router.DestinationRule).Build = "api", 3
+	op.VsRouter.(*router.VirtualService).Name, op.VsRouter.(*router.VirtualService).Build = "api", 3
+
+	shift := router.Shift{
+		Port:     5000,
+		Hostname: "api",
+		Selector: map[string]string{"environment": "integration-tests"},
+		Traffic: router.Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "3"},
+			RequestHeaders: map[string]string{"x-version": "3"},
+			Exact:          true,
+		},
+	}
+
+	err := op.Update(shift)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "refusing to shift traffic: no deployments matched pod-selector")
+
+	// neither the subset nor the route were created
+	dr, _ := istioClient.NetworkingV1alpha3().DestinationRules("default").Get("api-destinationrule", v1.GetOptions{})
+	assert.Equal(t, 2, len(dr.Spec.Subsets))
+	vs, _ := istioClient.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", v1.GetOptions{})
+	assert.Equal(t, 2, len(vs.Spec.Http))
+}
@@ -0,0 +1,148 @@
+package operator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Namespaced is implemented by routers which are able to operate at other namespaces than their own one
+type Namespaced interface {
+	GetNamespace() string
+	SetNamespace(namespace string)
+}
+
+func (ips *Istiops) manyNamespaces() bool {
+	return ips.AllNamespaces || len(ips.Namespaces) > 0
+}
+
+// inNamespace runs fn with both routers bound to a namespace, binding them back to their own one afterwards
+func (ips *Istiops) inNamespace(namespace string, fn func() error) error {
+	var routers []Namespaced
+	for _, r := range []Router{ips.DrRouter, ips.VsRouter} {
+		namespaced, ok := r.(Namespaced)
+		if !ok {
+			return errors.New("router is not able to operate at many namespaces")
+		}
+		routers = append(routers, namespaced)
+	}
+
+	for _, namespaced := range routers {
+		defer namespaced.SetNamespace(namespaced.GetNamespace())
+		namespaced.SetNamespace(namespace)
+	}
+
+	return fn()
+}
+
+// getNamespaces aggregates the resources of every selected namespace
+func (ips *Istiops) getNamespaces(selector map[string]string) (router.IstioRouteList, error) {
+	if ips.AllNamespaces {
+		var irl router.IstioRouteList
+		err := ips.inNamespace(metav1.NamespaceAll, func() error {
+			var err error
+			irl, err = ips.get(selector)
+			return err
+		})
+
+		return irl, err
+	}
+
+	irl := router.IstioRouteList{
+		DList: &v1alpha32.DestinationRuleList{},
+		VList: &v1alpha32.VirtualServiceList{},
+	}
+
+	var notFound error
+	for _, namespace := range ips.Namespaces {
+		err := ips.inNamespace(namespace, func() error {
+			namespaceIrl, err := ips.get(selector)
+			if err != nil {
+				return err
+			}
+
+			irl.DList.Items = append(irl.DList.Items, namespaceIrl.DList.Items...)
+			irl.VList.Items = append(irl.VList.Items, namespaceIrl.VList.Items...)
+			return nil
+		})
+		// namespaces without any matched resources are skipped, as long as any other one has them
+		if router.IsNotFound(err) {
+			logger.Info(fmt.Sprintf("Skipping namespace '%s': %s", namespace, err), "operator")
+			notFound = errors.New(fmt.Sprintf("namespace '%s': %s", namespace, err))
+			continue
+		}
+		if err != nil {
+			return router.IstioRouteList{}, errors.New(fmt.Sprintf("namespace '%s': %s", namespace, err))
+		}
+	}
+
+	if len(irl.VList.Items) == 0 && notFound != nil {
+		return router.IstioRouteList{}, noneMatched(ips.Namespaces, notFound)
+	}
+
+	return irl, nil
+}
+
+// noneMatched returns the error of namespaces which have no resources matched, reporting the last one of them
+func noneMatched(namespaces []string, last error) error {
+	return errors.New(fmt.Sprintf("none of the namespaces '%s' have matched resources (%s)", strings.Join(namespaces, ","), last))
+}
+
+// clearNamespaces clears each selected namespace on its own, so a failure only reverts the namespace which failed
+func (ips *Istiops) clearNamespaces(shift router.Shift, mode string) error {
+	namespaces := ips.Namespaces
+
+	if ips.AllNamespaces {
+		irl, err := ips.getNamespaces(shift.Selector)
+		if err != nil {
+			return err
+		}
+
+		namespaces = namespacesOf(irl)
+	}
+
+	var notFound error
+	cleared := 0
+	for _, namespace := range namespaces {
+		err := ips.inNamespace(namespace, func() error {
+			return ips.clear(shift, mode)
+		})
+		// namespaces without any matched resources are skipped, as long as any other one has them
+		if router.IsNotFound(err) {
+			logger.Info(fmt.Sprintf("Skipping namespace '%s': %s", namespace, err), "operator")
+			notFound = errors.New(fmt.Sprintf("namespace '%s': %s", namespace, err))
+			continue
+		}
+		if err != nil {
+			return errors.New(fmt.Sprintf("namespace '%s': %s", namespace, err))
+		}
+		cleared++
+	}
+
+	if cleared == 0 && notFound != nil {
+		return noneMatched(namespaces, notFound)
+	}
+
+	return nil
+}
+
+// namespacesOf returns the sorted namespaces of the virtualServices of a list
+func namespacesOf(irl router.IstioRouteList) []string {
+	seen := map[string]bool{}
+	var namespaces []string
+	for _, vs := range irl.VList.Items {
+		if !seen[vs.Namespace] {
+			seen[vs.Namespace] = true
+			namespaces = append(namespaces, vs.Namespace)
+		}
+	}
+	sort.Strings(namespaces)
+
+	return namespaces
+}
@@ -0,0 +1,144 @@
+package operator
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+// namespacedIstiops returns an operator of virtualServices and destinationRules created at each given namespace,
+// which have a master-route of a build with pods and a canary route of a build without pods
+func namespacedIstiops(namespaces ...string) (*Istiops, *istioFake.Clientset) {
+	istioClient := istioFake.NewSimpleClientset()
+	kubeClient := kubeFake.NewSimpleClientset()
+	selector := map[string]string{"environment": "integration-tests"}
+
+	for _, namespace := range namespaces {
+		vs := v1alpha32.VirtualService{}
+		vs.Name = "api-virtualservice"
+		vs.Namespace = namespace
+		vs.Labels = selector
+		vs.Spec.Http = []*v1alpha3.HTTPRoute{
+			{
+				Match: []*v1alpha3.HTTPMatchRequest{
+					{Headers: map[string]*v1alpha3.StringMatch{"x-version": {MatchType: &v1alpha3.StringMatch_Exact{Exact: "2"}}}},
+				},
+				Route: []*v1alpha3.HTTPRouteDestination{
+					{Destination: &v1alpha3.Destination{Host: "api", Subset: "api-2-" + namespace}},
+				},
+			},
+			{
+				Match: []*v1alpha3.HTTPMatchRequest{
+					{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+				},
+				Route: []*v1alpha3.HTTPRouteDestination{
+					{Destination: &v1alpha3.Destination{Host: "api", Subset: "api-1-" + namespace}},
+				},
+			},
+		}
+
+		dr := v1alpha32.DestinationRule{}
+		dr.Name = "api-destinationrule"
+		dr.Namespace = namespace
+		dr.Labels = selector
+		dr.Spec.Subsets = []*v1alpha3.Subset{
+			{Name: "api-1-" + namespace, Labels: map[string]string{"app": "api", "build": "1"}},
+			{Name: "api-2-" + namespace, Labels: map[string]string{"app": "api", "build": "2"}},
+		}
+
+		pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "api-1", Namespace: namespace, Labels: map[string]string{"app": "api", "build": "1"}}}
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		_, _ = kubeClient.CoreV1().Pods(namespace).Create(pod)
+
+		_, _ = istioClient.NetworkingV1alpha3().VirtualServices(namespace).Create(&vs)
+		_, _ = istioClient.NetworkingV1alpha3().DestinationRules(namespace).Create(&dr)
+	}
+
+	op := &Istiops{
+		DrRouter: &router.DestinationRule{TrackingId: "unit-testing-tracking-id", Namespace: "default", Istio: istioClient, KubeClient: kubeClient},
+		VsRouter: &router.VirtualService{TrackingId: "unit-testing-tracking-id", Namespace: "default", Istio: istioClient, KubeClient: kubeClient},
+	}
+
+	return op, istioClient
+}
+
+func TestGet_Integrated_Namespaces(t *testing.T) {
+	op, _ := namespacedIstiops("team-a", "team-b", "team-c")
+	op.Namespaces = []string{"team-a", "team-c"}
+
+	irl, err := op.Get(map[string]string{"environment": "integration-tests"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(irl.VList.Items))
+	assert.Equal(t, "team-a", irl.VList.Items[0].Namespace)
+	assert.Equal(t, "team-c", irl.VList.Items[1].Namespace)
+	assert.Equal(t, 2, len(irl.DList.Items))
+
+	// routers are bound back to their own namespace
+	assert.Equal(t, "default", op.VsRouter.(*router.VirtualService).Namespace)
+	assert.Equal(t, "default", op.DrRouter.(*router.DestinationRule).Namespace)
+}
+
+func TestGet_Integrated_AllNamespaces(t *testing.T) {
+	op, _ := namespacedIstiops("team-a", "team-b")
+	op.AllNamespaces = true
+
+	irl, err := op.Get(map[string]string{"environment": "integration-tests"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(irl.VList.Items))
+	assert.Equal(t, []string{"team-a", "team-b"}, namespacesOf(irl))
+}
+
+func TestClear_Integrated_AllNamespaces(t *testing.T) {
+	op, istioClient := namespacedIstiops("team-a", "team-b")
+	op.AllNamespaces = true
+
+	err := op.Clear(router.Shift{Selector: map[string]string{"environment": "integration-tests"}}, "soft")
+	assert.NoError(t, err)
+
+	for _, namespace := range []string{"team-a", "team-b"} {
+		vs, _ := istioClient.NetworkingV1alpha3().VirtualServices(namespace).Get("api-virtualservice", v1.GetOptions{})
+		assert.Equal(t, 1, len(vs.Spec.Http))
+		assert.Equal(t, "api-1-"+namespace, vs.Spec.Http[0].Route[0].Destination.Subset)
+	}
+}
+
+func TestNamespaces_Integrated_Unmatched(t *testing.T) {
+	op, istioClient := namespacedIstiops("team-a")
+	op.Namespaces = []string{"team-a", "team-b"}
+
+	// namespaces without matched resources are skipped
+	irl, err := op.Get(map[string]string{"environment": "integration-tests"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(irl.VList.Items))
+	assert.Equal(t, "team-a", irl.VList.Items[0].Namespace)
+
+	err = op.Clear(router.Shift{Selector: map[string]string{"environment": "integration-tests"}}, "soft")
+	assert.NoError(t, err)
+
+	vs, _ := istioClient.NetworkingV1alpha3().VirtualServices("team-a").Get("api-virtualservice", v1.GetOptions{})
+	assert.Equal(t, 1, len(vs.Spec.Http))
+}
+
+func TestNamespaces_Integrated_ErrorCases(t *testing.T) {
+	op, _ := namespacedIstiops("team-a")
+	op.Namespaces = []string{"team-b", "team-c"}
+
+	_, err := op.Get(map[string]string{"environment": "integration-tests"})
+	assert.EqualError(t, err, "none of the namespaces 'team-b,team-c' have matched resources (namespace 'team-c': could not find any destinationRules which matched label-selector 'environment=integration-tests')")
+
+	err = op.Clear(router.Shift{Selector: map[string]string{"environment": "integration-tests"}}, "soft")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "none of the namespaces 'team-b,team-c' have matched resources")
+
+	// mocked routers can't be bound to other namespaces
+	mocked := &Istiops{DrRouter: &MockedResources{}, VsRouter: &MockedResources{}, Namespaces: []string{"team-a"}}
+	_, err = mocked.Get(map[string]string{"environment": "integration-tests"})
+	assert.EqualError(t, err, "namespace 'team-a': router is not able to operate at many namespaces")
+}
@@ -8,4 +8,8 @@ type Operator interface {
 	Get(selector map[string]string) (router.IstioRouteList, error)
 	Update(shift router.Shift) error
 	Clear(shift router.Shift, mode string) error
+	Rollout(shift router.Shift, rollout Rollout) error
+	AbortRollout(selector map[string]string) error
+	Rollback(selector map[string]string) error
+	Prune(shift router.Shift, keep []string, drain []string) error
 }
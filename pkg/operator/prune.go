@@ -0,0 +1,33 @@
+package operator
+
+import (
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+)
+
+// Pruner is implemented by routers which are able to remove the routes of builds which are no longer desired
+type Pruner interface {
+	Prune(shift router.Shift, keep []string, drain []string) error
+}
+
+// Prune removes the routes of every build of a shift's destination except the kept subsets, taking the drained ones
+// out of the master-route
+func (ips *Istiops) Prune(shift router.Shift, keep []string, drain []string) error {
+	if len(shift.Selector) == 0 {
+		return errors.New("label-selector must exists in need to find resources")
+	}
+
+	err := ips.dryRun()
+	if err != nil {
+		return err
+	}
+
+	pruner, ok := ips.VsRouter.(Pruner)
+	if !ok {
+		return errors.New("virtualService router is not able to prune routes")
+	}
+
+	return ips.transaction(shift.Selector, func() error {
+		return pruner.Prune(shift, keep, drain)
+	})
+}
@@ -0,0 +1,41 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/stretchr/testify/assert"
+)
+
+func (m *MockedTrackerResources) Prune(shift router.Shift, keep []string, drain []string) error {
+	m.Restored = "pruned"
+	return nil
+}
+
+func TestPrune_Unit(t *testing.T) {
+	vs := &MockedTrackerResources{}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	err := op.Prune(router.Shift{}, nil, nil)
+	assert.EqualError(t, err, "label-selector must exists in need to find resources")
+
+	err = op.Prune(router.Shift{Selector: map[string]string{"app": "api-domain"}}, []string{"api-domain-2-default"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "pruned", vs.Restored)
+}
+
+func TestPrune_Unit_NonPruner(t *testing.T) {
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: &MockedResources{},
+	}
+
+	err := op.Prune(router.Shift{Selector: map[string]string{"app": "api-domain"}}, nil, nil)
+	assert.EqualError(t, err, "virtualService router is not able to prune routes")
+}
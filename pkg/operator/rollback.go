@@ -0,0 +1,29 @@
+package operator
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Historian is implemented by routers which keep a history of previous route states
+type Historian interface {
+	Rollback(selector map[string]string) error
+}
+
+// Rollback restores the master-route of resources which matches a k8s labelSelector to its previous recorded state
+func (ips *Istiops) Rollback(selector map[string]string) error {
+	if len(selector) == 0 {
+		return errors.New("label-selector must exists in need to find resources")
+	}
+
+	err := ips.dryRun()
+	if err != nil {
+		return err
+	}
+
+	historian, ok := ips.VsRouter.(Historian)
+	if !ok {
+		return errors.New("virtualService router does not keep any route history")
+	}
+
+	return historian.Rollback(selector)
+}
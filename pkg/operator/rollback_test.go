@@ -0,0 +1,40 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (m *MockedTrackerResources) Rollback(selector map[string]string) error {
+	m.Restored = "previous"
+	return nil
+}
+
+func TestRollback_Unit(t *testing.T) {
+	vs := &MockedTrackerResources{}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	err := op.Rollback(map[string]string{})
+	assert.EqualError(t, err, "label-selector must exists in need to find resources")
+
+	err = op.Rollback(map[string]string{"app": "api-domain"})
+	assert.NoError(t, err)
+	assert.Equal(t, "previous", vs.Restored)
+}
+
+func TestRollback_Unit_NonHistorian(t *testing.T) {
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: &MockedResources{},
+	}
+
+	err := op.Rollback(map[string]string{"app": "api-domain"})
+	assert.EqualError(t, err, "virtualService router does not keep any route history")
+}
@@ -0,0 +1,226 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+)
+
+// Rollout describes a progressive traffic shift driven through a schedule of weights
+type Rollout struct {
+	Steps    []int32
+	Interval time.Duration
+	Resume   bool
+	// Force resumes a rollout which failed its canary analysis, without analyzing its resumed step
+	Force bool
+	// Gate is optional and when given every step is analyzed before moving on to the next one
+	Gate Gate
+}
+
+// Gate evaluates a canary subset against its baseline one, returning false when the canary must be rolled back
+type Gate interface {
+	Analyze(canary string, baseline string) (bool, error)
+}
+
+// Tracker is implemented by routers which are able to record a rollout progress
+type Tracker interface {
+	Progress(selector map[string]string) (*router.Progress, error)
+	SaveProgress(selector map[string]string, progress router.Progress) error
+	Restore(selector map[string]string, subset string) error
+}
+
+// Validate checks if Rollout steps are a crescent schedule of weights between 1 and 100, paused by an interval when
+// analyzed by a gate
+func (r Rollout) Validate() error {
+	if len(r.Steps) == 0 {
+		return errors.New("rollout needs at least one step")
+	}
+
+	var previous int32
+	for _, step := range r.Steps {
+		if step < 1 || step > 100 {
+			return errors.New(fmt.Sprintf("rollout step '%d' not in range 1 - 100", step))
+		}
+
+		if step <= previous {
+			return errors.New("rollout steps must be in crescent order")
+		}
+
+		previous = step
+	}
+
+	// a step must receive traffic for a while before its metrics can be analyzed
+	if r.Gate != nil && r.Interval <= 0 {
+		return errors.New("canary analysis needs a non-zero interval between steps")
+	}
+
+	return nil
+}
+
+func (ips *Istiops) tracker() (Tracker, error) {
+	tracker, ok := ips.VsRouter.(Tracker)
+	if !ok {
+		return nil, errors.New("virtualService router is not able to track rollouts")
+	}
+
+	return tracker, nil
+}
+
+// Rollout will shift traffic through each weight step, recording its progress to be posterior resumed or aborted
+func (ips *Istiops) Rollout(shift router.Shift, rollout Rollout) error {
+	tracker, err := ips.tracker()
+	if err != nil {
+		return err
+	}
+
+	forced := false
+	progress := router.Progress{
+		Steps:  rollout.Steps,
+		Step:   -1,
+		Status: router.RolloutRunning,
+	}
+
+	if rollout.Resume {
+		recorded, err := tracker.Progress(shift.Selector)
+		if err != nil {
+			return err
+		}
+
+		if recorded == nil {
+			return errors.New("could not find any rollout to be resumed")
+		}
+
+		if recorded.Status == router.RolloutCompleted {
+			return errors.New("rollout already completed, refusing to resume it")
+		}
+
+		if recorded.Status == router.RolloutFailed && !rollout.Force {
+			return errors.New("rollout failed its canary analysis, refusing to resume it without 'force'")
+		}
+
+		forced = recorded.Status == router.RolloutFailed
+		progress = *recorded
+	}
+
+	err = Rollout{Steps: progress.Steps, Interval: rollout.Interval, Gate: rollout.Gate}.Validate()
+	if err != nil {
+		return err
+	}
+
+	if rollout.Resume {
+		logger.Info(fmt.Sprintf("Resuming rollout from step '%d/%d'", progress.Step+2, len(progress.Steps)), "operator")
+		progress.Status = router.RolloutRunning
+		err = tracker.SaveProgress(shift.Selector, progress)
+		if err != nil {
+			return err
+		}
+	}
+
+	first := progress.Step + 1
+	for i := first; i < len(progress.Steps); i++ {
+		// only wait between steps, the first one is applied right away
+		if i > first {
+			logger.Info(fmt.Sprintf("Waiting '%s' before next rollout step", rollout.Interval), "operator")
+			time.Sleep(rollout.Interval)
+
+			recorded, err := tracker.Progress(shift.Selector)
+			if err != nil {
+				return err
+			}
+
+			if recorded != nil && recorded.Status == router.RolloutAborted {
+				return errors.New(fmt.Sprintf("rollout aborted at step '%d/%d' with '%d%%' of traffic", progress.Step+1, len(progress.Steps), progress.Steps[progress.Step]))
+			}
+
+			if recorded != nil {
+				progress.Subset = recorded.Subset
+				progress.Baseline = recorded.Baseline
+			}
+		}
+
+		// every applied step is analyzed before moving on, including the last one of a resumed rollout, unless a
+		// failed rollout is forced to be resumed
+		if rollout.Gate != nil && i > 0 && !(i == first && forced) {
+			err = ips.analyze(tracker, shift.Selector, rollout.Gate, progress)
+			if err != nil {
+				return err
+			}
+		}
+
+		logger.Info(fmt.Sprintf("Applying rollout step '%d/%d' with '%d%%' of traffic", i+1, len(progress.Steps), progress.Steps[i]), "operator")
+		shift.Traffic.Weight = progress.Steps[i]
+		err = ips.Update(shift)
+		if err != nil {
+			return err
+		}
+
+		progress.Step = i
+		if i == len(progress.Steps)-1 {
+			progress.Status = router.RolloutCompleted
+		}
+
+		err = tracker.SaveProgress(shift.Selector, progress)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// analyze rolls back the master-route to the baseline subset when the canary one is not healthy
+func (ips *Istiops) analyze(tracker Tracker, selector map[string]string, gate Gate, progress router.Progress) error {
+	healthy, err := gate.Analyze(progress.Subset, progress.Baseline)
+	if err != nil {
+		return err
+	}
+
+	if healthy {
+		return nil
+	}
+
+	logger.Warn(fmt.Sprintf("Canary analysis failed for subset '%s', rolling back to '%s'", progress.Subset, progress.Baseline), "operator")
+	err = tracker.Restore(selector, progress.Baseline)
+	if err != nil {
+		return err
+	}
+
+	progress.Status = router.RolloutFailed
+	err = tracker.SaveProgress(selector, progress)
+	if err != nil {
+		return err
+	}
+
+	return errors.New(fmt.Sprintf("canary analysis failed at step '%d/%d', traffic rolled back to subset '%s'", progress.Step+1, len(progress.Steps), progress.Baseline))
+}
+
+// AbortRollout marks a running rollout as aborted, so no further step will be applied to it
+func (ips *Istiops) AbortRollout(selector map[string]string) error {
+	if len(selector) == 0 {
+		return errors.New("label-selector must exists in need to find resources")
+	}
+
+	tracker, err := ips.tracker()
+	if err != nil {
+		return err
+	}
+
+	progress, err := tracker.Progress(selector)
+	if err != nil {
+		return err
+	}
+
+	if progress == nil {
+		return errors.New("could not find any rollout to be aborted")
+	}
+
+	if progress.Status != router.RolloutRunning {
+		return errors.New(fmt.Sprintf("could not abort a rollout with status '%s'", progress.Status))
+	}
+
+	progress.Status = router.RolloutAborted
+	return tracker.SaveProgress(selector, *progress)
+}
@@ -0,0 +1,267 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockedTrackerResources struct {
+	MockedResources
+	Weights  []int32
+	Recorded *router.Progress
+	Saved    []router.Progress
+	Restored string
+}
+
+func (m *MockedTrackerResources) Update(shift router.Shift) error {
+	m.Weights = append(m.Weights, shift.Traffic.Weight)
+	return nil
+}
+
+func (m *MockedTrackerResources) Progress(selector map[string]string) (*router.Progress, error) {
+	return m.Recorded, nil
+}
+
+func (m *MockedTrackerResources) SaveProgress(selector map[string]string, progress router.Progress) error {
+	// as the router does, subsets are stamped when saving
+	if progress.Subset == "" {
+		progress.Subset = "api-2-default"
+	}
+	if progress.Baseline == "" {
+		progress.Baseline = "api-1-default"
+	}
+
+	m.Recorded = &progress
+	m.Saved = append(m.Saved, progress)
+	return nil
+}
+
+func (m *MockedTrackerResources) Restore(selector map[string]string, subset string) error {
+	m.Restored = subset
+	return nil
+}
+
+type MockedGate struct {
+	Healthy  bool
+	Analyzed []string
+}
+
+func (g *MockedGate) Analyze(canary string, baseline string) (bool, error) {
+	g.Analyzed = append(g.Analyzed, canary)
+	return g.Healthy, nil
+}
+
+func rolloutShift() router.Shift {
+	return router.Shift{
+		Selector: map[string]string{
+			"app": "api-domain",
+		},
+		Traffic: router.Traffic{
+			PodSelector: map[string]string{
+				"version": "2.1.3",
+			},
+		},
+	}
+}
+
+func TestRollout_Validate_Unit(t *testing.T) {
+	cases := []struct {
+		rollout Rollout
+		want    string
+	}{
+		{Rollout{}, "rollout needs at least one step"},
+		{Rollout{Steps: []int32{0, 50}}, "rollout step '0' not in range 1 - 100"},
+		{Rollout{Steps: []int32{10, 101}}, "rollout step '101' not in range 1 - 100"},
+		{Rollout{Steps: []int32{50, 25}}, "rollout steps must be in crescent order"},
+		{Rollout{Steps: []int32{50, 100}, Gate: &MockedGate{}}, "canary analysis needs a non-zero interval between steps"},
+	}
+
+	for _, tt := range cases {
+		assert.EqualError(t, tt.rollout.Validate(), tt.want)
+	}
+
+	assert.NoError(t, Rollout{Steps: []int32{10, 25, 50, 100}}.Validate())
+}
+
+func TestRollout_Unit(t *testing.T) {
+	vs := &MockedTrackerResources{}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	err := op.Rollout(rolloutShift(), Rollout{Steps: []int32{10, 50, 100}})
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{10, 50, 100}, vs.Weights)
+	assert.Equal(t, 3, len(vs.Saved))
+	assert.Equal(t, router.RolloutRunning, vs.Saved[0].Status)
+	assert.Equal(t, 2, vs.Recorded.Step)
+	assert.Equal(t, router.RolloutCompleted, vs.Recorded.Status)
+}
+
+func TestRollout_Unit_Resume(t *testing.T) {
+	vs := &MockedTrackerResources{
+		Recorded: &router.Progress{
+			Steps:  []int32{10, 50, 100},
+			Step:   0,
+			Status: router.RolloutAborted,
+		},
+	}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	err := op.Rollout(rolloutShift(), Rollout{Resume: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{50, 100}, vs.Weights)
+	assert.Equal(t, router.RolloutCompleted, vs.Recorded.Status)
+}
+
+func TestRollout_Unit_ResumeCompleted(t *testing.T) {
+	vs := &MockedTrackerResources{
+		Recorded: &router.Progress{
+			Steps:  []int32{10, 100},
+			Step:   1,
+			Status: router.RolloutCompleted,
+		},
+	}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	err := op.Rollout(rolloutShift(), Rollout{Resume: true})
+	assert.EqualError(t, err, "rollout already completed, refusing to resume it")
+	assert.Equal(t, 0, len(vs.Weights))
+}
+
+func TestRollout_Unit_ResumeFailed(t *testing.T) {
+	vs := &MockedTrackerResources{
+		Recorded: &router.Progress{
+			Steps:  []int32{10, 50, 100},
+			Step:   0,
+			Status: router.RolloutFailed,
+		},
+	}
+	gate := &MockedGate{Healthy: false}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	err := op.Rollout(rolloutShift(), Rollout{Resume: true, Interval: time.Nanosecond, Gate: gate})
+	assert.EqualError(t, err, "rollout failed its canary analysis, refusing to resume it without 'force'")
+	assert.Equal(t, 0, len(vs.Weights))
+
+	// a forced rollout skips the analysis of its resumed step only
+	err = op.Rollout(rolloutShift(), Rollout{Resume: true, Force: true, Interval: time.Nanosecond, Gate: gate})
+	assert.EqualError(t, err, "canary analysis failed at step '2/3', traffic rolled back to subset 'api-1-default'")
+	assert.Equal(t, []int32{50}, vs.Weights)
+	assert.Equal(t, 1, len(gate.Analyzed))
+}
+
+func TestRollout_Unit_ResumeAnalyzed(t *testing.T) {
+	vs := &MockedTrackerResources{
+		Recorded: &router.Progress{
+			Steps:    []int32{10, 50, 100},
+			Step:     0,
+			Status:   router.RolloutAborted,
+			Subset:   "api-2-default",
+			Baseline: "api-1-default",
+		},
+	}
+	gate := &MockedGate{Healthy: false}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	// the step applied before the rollout was aborted is analyzed before resuming it
+	err := op.Rollout(rolloutShift(), Rollout{Resume: true, Interval: time.Nanosecond, Gate: gate})
+	assert.EqualError(t, err, "canary analysis failed at step '1/3', traffic rolled back to subset 'api-1-default'")
+	assert.Equal(t, 0, len(vs.Weights))
+	assert.Equal(t, []string{"api-2-default"}, gate.Analyzed)
+}
+
+func TestRollout_Unit_NonTracker(t *testing.T) {
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: &MockedResources{},
+	}
+
+	err := op.Rollout(rolloutShift(), Rollout{Steps: []int32{100}})
+	assert.EqualError(t, err, "virtualService router is not able to track rollouts")
+}
+
+func TestAbortRollout_Unit(t *testing.T) {
+	vs := &MockedTrackerResources{
+		Recorded: &router.Progress{
+			Steps:  []int32{10, 50, 100},
+			Step:   1,
+			Status: router.RolloutRunning,
+		},
+	}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	err := op.AbortRollout(map[string]string{"app": "api-domain"})
+	assert.NoError(t, err)
+	assert.Equal(t, router.RolloutAborted, vs.Recorded.Status)
+
+	err = op.AbortRollout(map[string]string{"app": "api-domain"})
+	assert.EqualError(t, err, "could not abort a rollout with status 'aborted'")
+}
+
+func TestRollout_Unit_HealthyGate(t *testing.T) {
+	vs := &MockedTrackerResources{}
+	gate := &MockedGate{Healthy: true}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	err := op.Rollout(rolloutShift(), Rollout{Steps: []int32{10, 50, 100}, Interval: time.Nanosecond, Gate: gate})
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{10, 50, 100}, vs.Weights)
+	// the last step is not analyzed, there is no baseline left to compare to
+	assert.Equal(t, 2, len(gate.Analyzed))
+	assert.Equal(t, "", vs.Restored)
+}
+
+func TestRollout_Unit_UnhealthyGate(t *testing.T) {
+	vs := &MockedTrackerResources{}
+	gate := &MockedGate{Healthy: false}
+
+	var op Operator
+	op = &Istiops{
+		DrRouter: &MockedResources{},
+		VsRouter: vs,
+	}
+
+	err := op.Rollout(rolloutShift(), Rollout{Steps: []int32{10, 50, 100}, Interval: time.Nanosecond, Gate: gate})
+	assert.EqualError(t, err, "canary analysis failed at step '1/3', traffic rolled back to subset 'api-1-default'")
+	assert.Equal(t, []int32{10}, vs.Weights)
+	assert.Equal(t, "api-1-default", vs.Restored)
+	assert.Equal(t, router.RolloutFailed, vs.Recorded.Status)
+}
@@ -0,0 +1,88 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+)
+
+// Reverter is implemented by routers which are able to put resources back to a previous snapshot
+type Reverter interface {
+	Revert(snapshot *router.IstioRouteList) ([]string, error)
+}
+
+// transaction runs fn and, if it fails, reverts every resource which matches a k8s labelSelector to its state before fn
+func (ips *Istiops) transaction(selector map[string]string, fn func() error) error {
+	// nothing is applied in dry-run mode, so there is nothing to be reverted either
+	if !ips.revertible() || ips.DryRun {
+		return fn()
+	}
+
+	snapshot, err := ips.snapshot(selector)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err == nil {
+		return nil
+	}
+
+	reverted, revertErr := ips.revert(snapshot)
+	if revertErr != nil {
+		return errors.New(fmt.Sprintf("%s; could not revert resources due to error '%s' (reverted: %s)", err, revertErr, describe(reverted)))
+	}
+
+	return errors.New(fmt.Sprintf("%s; reverted: %s", err, describe(reverted)))
+}
+
+// revertible returns whether both routers are able to put resources back to a snapshot
+func (ips *Istiops) revertible() bool {
+	_, drOk := ips.DrRouter.(Reverter)
+	_, vsOk := ips.VsRouter.(Reverter)
+
+	return drOk && vsOk
+}
+
+// snapshot lists every resource which matches a k8s labelSelector
+func (ips *Istiops) snapshot(selector map[string]string) (*router.IstioRouteList, error) {
+	dsl, err := ips.DrRouter.List(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	vsl, err := ips.VsRouter.List(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	return &router.IstioRouteList{
+		DList: dsl.DList,
+		VList: vsl.VList,
+	}, nil
+}
+
+// revert puts resources back to a snapshot, returning the reverted ones
+func (ips *Istiops) revert(snapshot *router.IstioRouteList) ([]string, error) {
+	// virtualServices must be reverted before destinationRules, so routes never point to inexistent subsets
+	var reverted []string
+	for _, r := range []Router{ips.VsRouter, ips.DrRouter} {
+		revertedResources, err := r.(Reverter).Revert(snapshot)
+		reverted = append(reverted, revertedResources...)
+		if err != nil {
+			return reverted, err
+		}
+	}
+
+	return reverted, nil
+}
+
+func describe(resources []string) string {
+	if len(resources) == 0 {
+		return "none"
+	}
+
+	return strings.Join(resources, ", ")
+}
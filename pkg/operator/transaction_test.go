@@ -0,0 +1,116 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockedReverterResources struct {
+	MockedResources
+	UpdateErr error
+	Reverted  []string
+	RevertErr error
+	Snapshot  *router.IstioRouteList
+}
+
+func (m *MockedReverterResources) Update(shift router.Shift) error { return m.UpdateErr }
+
+func (m *MockedReverterResources) Revert(snapshot *router.IstioRouteList) ([]string, error) {
+	m.Snapshot = snapshot
+	return m.Reverted, m.RevertErr
+}
+
+func TestUpdate_Unit_Transaction(t *testing.T) {
+	dr := &MockedReverterResources{Reverted: []string{"destinationRule 'api'"}}
+	vs := &MockedReverterResources{UpdateErr: errors.New("could not update virtualService 'api'")}
+
+	op := &Istiops{
+		DrRouter: dr,
+		VsRouter: vs,
+	}
+
+	shift := router.Shift{
+		Selector: map[string]string{"app": "api"},
+		Traffic:  router.Traffic{PodSelector: map[string]string{"build": "1"}},
+	}
+
+	err := op.Update(shift)
+	assert.EqualError(t, err, "could not update virtualService 'api'; reverted: destinationRule 'api'")
+	assert.NotNil(t, dr.Snapshot)
+	assert.Equal(t, 1, len(dr.Snapshot.DList.Items))
+	assert.Equal(t, 1, len(vs.Snapshot.VList.Items))
+}
+
+func TestUpdate_Unit_TransactionSucceeded(t *testing.T) {
+	dr := &MockedReverterResources{}
+	vs := &MockedReverterResources{}
+
+	op := &Istiops{
+		DrRouter: dr,
+		VsRouter: vs,
+	}
+
+	shift := router.Shift{
+		Selector: map[string]string{"app": "api"},
+		Traffic:  router.Traffic{PodSelector: map[string]string{"build": "1"}},
+	}
+
+	err := op.Update(shift)
+	assert.NoError(t, err)
+	assert.Nil(t, dr.Snapshot)
+	assert.Nil(t, vs.Snapshot)
+}
+
+func TestUpdate_Unit_TransactionRevertFailed(t *testing.T) {
+	dr := &MockedReverterResources{
+		UpdateErr: errors.New("could not update destinationRule 'api'"),
+		RevertErr: errors.New("forbidden"),
+	}
+	vs := &MockedReverterResources{Reverted: []string{"virtualService 'api'"}}
+
+	op := &Istiops{
+		DrRouter: dr,
+		VsRouter: vs,
+	}
+
+	shift := router.Shift{
+		Selector: map[string]string{"app": "api"},
+		Traffic:  router.Traffic{PodSelector: map[string]string{"build": "1"}},
+	}
+
+	err := op.Update(shift)
+	assert.EqualError(t, err, "could not update destinationRule 'api'; could not revert resources due to error 'forbidden' (reverted: virtualService 'api')")
+}
+
+type MockedDryRunReverterResources struct {
+	MockedReverterResources
+	DryRun bool
+}
+
+func (m *MockedDryRunReverterResources) SetDryRun(dryRun bool) { m.DryRun = dryRun }
+
+func TestUpdate_Unit_TransactionDryRun(t *testing.T) {
+	dr := &MockedDryRunReverterResources{}
+	vs := &MockedDryRunReverterResources{MockedReverterResources: MockedReverterResources{UpdateErr: errors.New("could not update virtualService 'api'")}}
+
+	op := &Istiops{
+		DrRouter: dr,
+		VsRouter: vs,
+		DryRun:   true,
+	}
+
+	shift := router.Shift{
+		Selector: map[string]string{"app": "api"},
+		Traffic:  router.Traffic{PodSelector: map[string]string{"build": "1"}},
+	}
+
+	// nothing is applied in dry-run mode, so nothing is snapshotted nor reverted
+	err := op.Update(shift)
+	assert.EqualError(t, err, "could not update virtualService 'api'")
+	assert.True(t, vs.DryRun)
+	assert.Nil(t, dr.Snapshot)
+	assert.Nil(t, vs.Snapshot)
+}
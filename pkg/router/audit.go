@@ -0,0 +1,351 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// HistoryAnnotation is the annotation of virtualServices and destinationRules which keeps their latest audit
+	// records, rollbacks restore master-routes from them
+	HistoryAnnotation = "istiops.io/history"
+	// HistoryLimit is the maximum of audit records kept at each resource's annotation
+	HistoryLimit = 10
+	// AuditMaxBytes is the maximum size of the history annotation, the oldest records are dropped beyond it
+	AuditMaxBytes = 32 * 1024
+	// AuditDiffLimit is the maximum size of the diff kept by each audit record, longer ones are truncated
+	AuditDiffLimit = 8 * 1024
+
+	// operations recorded by audit records
+	OperationShift    = "shift"
+	OperationClear    = "clear"
+	OperationRollback = "rollback"
+	OperationRollout  = "rollout"
+	OperationRevert   = "revert"
+)
+
+// Audit identifies who changes istio's resources and where their audit records are written besides annotations
+type Audit struct {
+	// User who requests the changes, the OS user when empty
+	User string
+	// File receives every audit record as a json line when given
+	File string
+}
+
+// AuditRecord is a change of a virtualService or destinationRule, with the diff of its spec
+type AuditRecord struct {
+	// Revision numbers the records of each resource, increasing by one at each change
+	Revision   int       `json:"revision"`
+	Timestamp  time.Time `json:"timestamp"`
+	User       string    `json:"user"`
+	TrackingId string    `json:"trackingId"`
+	Operation  string    `json:"operation,omitempty"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	Shift      *Shift    `json:"shift,omitempty"`
+	Build      uint32    `json:"build,omitempty"`
+	// Summary is the resource after the change: the weights of each route's destinations of virtualServices or the
+	// subsets of destinationRules
+	Summary []string `json:"summary,omitempty"`
+	// Diff is the unified diff of the resource's spec, as istio's indented json
+	Diff string `json:"diff,omitempty"`
+	// Truncated tells the diff was cut at AuditDiffLimit, so the spec before the change can't be restored from it
+	Truncated bool `json:"truncated,omitempty"`
+	// Destinations is the master-route of a virtualService before the change, with the labels of its subsets, when
+	// the change replaced it. A rollback restores them
+	Destinations []RouteDestination `json:"destinations,omitempty"`
+	// RolledBack is the revision whose master-route a rollback restored, which is not restored by any later one
+	RolledBack int `json:"rolledBack,omitempty"`
+}
+
+// auditContext is the operation which routers are running, recorded along with their changes
+type auditContext struct {
+	operation string
+	shift     *Shift
+	build     uint32
+	// destinations is the master-route which the next change of a virtualService replaces
+	destinations []RouteDestination
+	// rolledBack is the revision which the next change of a virtualService restores
+	rolledBack int
+}
+
+// AuditTrail returns the audit records kept at a resource's annotation, the newest one being the last element
+func AuditTrail(meta metav1.ObjectMeta) ([]AuditRecord, error) {
+	var records []AuditRecord
+
+	value, ok := meta.Annotations[HistoryAnnotation]
+	if !ok || value == "" {
+		return records, nil
+	}
+
+	err := json.Unmarshal([]byte(value), &records)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not parse audit records of '%s': %s", meta.Name, err))
+	}
+
+	// master-route states recorded before the audit trail have no revision, they are numbered as the oldest records
+	for i := range records {
+		if records[i].Revision == 0 {
+			records[i].Revision = i + 1
+		}
+	}
+
+	return records, nil
+}
+
+// user returns who requests the changes: the given user or the OS one
+func (a Audit) user() string {
+	if a.User != "" {
+		return a.User
+	}
+
+	current, err := user.Current()
+	if err == nil && current.Username != "" {
+		return current.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+// SpecText returns the text of an istio's spec which audit diffs are computed from
+func SpecText(spec proto.Message) (string, error) {
+	text, err := (&jsonpb.Marshaler{Indent: "  "}).MarshalToString(spec)
+	if err != nil {
+		return "", err
+	}
+
+	return text + "\n", nil
+}
+
+// unchanged returns whether an update leaves a resource as it is, apart from its audit records
+func unchanged(current metav1.ObjectMeta, changed metav1.ObjectMeta, before proto.Message, after proto.Message) bool {
+	if !proto.Equal(before, after) || len(current.Labels) != len(changed.Labels) {
+		return false
+	}
+
+	for key, value := range current.Labels {
+		if changedValue, ok := changed.Labels[key]; !ok || changedValue != value {
+			return false
+		}
+	}
+
+	annotations := func(meta metav1.ObjectMeta) map[string]string {
+		unaudited := map[string]string{}
+		for key, value := range meta.Annotations {
+			if key != HistoryAnnotation {
+				unaudited[key] = value
+			}
+		}
+		return unaudited
+	}
+
+	currentAnnotations, changedAnnotations := annotations(current), annotations(changed)
+	if len(currentAnnotations) != len(changedAnnotations) {
+		return false
+	}
+
+	for key, value := range currentAnnotations {
+		if changedValue, ok := changedAnnotations[key]; !ok || changedValue != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RouteWeights renders the destinations of every http, tcp and tls route of a spec with their weights
+// (ex: 'api-1-default=80,api-2-default=20')
+func RouteWeights(spec *v1alpha3.VirtualService) []string {
+	var routes []string
+
+	render := func(subsets []string, weights []int32) {
+		var destinations []string
+		for i, subset := range subsets {
+			weight := weights[i]
+			// a single destination without weight receives the whole traffic
+			if weight == 0 && len(subsets) == 1 {
+				weight = 100
+			}
+			destinations = append(destinations, fmt.Sprintf("%s=%d", subset, weight))
+		}
+		routes = append(routes, strings.Join(destinations, ","))
+	}
+
+	for _, httpRoute := range spec.Http {
+		var subsets []string
+		var weights []int32
+		for _, route := range httpRoute.Route {
+			subsets = append(subsets, route.GetDestination().GetSubset())
+			weights = append(weights, route.Weight)
+		}
+		render(subsets, weights)
+	}
+
+	for _, tcpRoute := range spec.Tcp {
+		var subsets []string
+		var weights []int32
+		for _, route := range tcpRoute.Route {
+			subsets = append(subsets, route.GetDestination().GetSubset())
+			weights = append(weights, route.Weight)
+		}
+		render(subsets, weights)
+	}
+
+	for _, tlsRoute := range spec.Tls {
+		var subsets []string
+		var weights []int32
+		for _, route := range tlsRoute.Route {
+			subsets = append(subsets, route.GetDestination().GetSubset())
+			weights = append(weights, route.Weight)
+		}
+		render(subsets, weights)
+	}
+
+	return routes
+}
+
+// subsetNames returns the names of a destinationRule's subsets
+func subsetNames(spec *v1alpha3.DestinationRule) []string {
+	var names []string
+	for _, subset := range spec.Subsets {
+		names = append(names, subset.GetName())
+	}
+
+	return names
+}
+
+// record appends an audit record of a change to the annotation of the changed resource, keeping the records of
+// its current state so they are never lost by restoring a resource to a previous one. The annotation is bounded
+// by HistoryLimit records and AuditMaxBytes
+func (a Audit) record(trackingId string, ctx auditContext, kind string, current metav1.ObjectMeta, changed *metav1.ObjectMeta, before proto.Message, after proto.Message, summary []string) (*AuditRecord, error) {
+	beforeText, err := SpecText(before)
+	if err != nil {
+		return nil, err
+	}
+
+	afterText, err := SpecText(after)
+	if err != nil {
+		return nil, err
+	}
+
+	record := AuditRecord{
+		Timestamp:  time.Now().UTC(),
+		User:       a.user(),
+		TrackingId: trackingId,
+		Operation:  ctx.operation,
+		Kind:       kind,
+		Namespace:  changed.Namespace,
+		Name:       changed.Name,
+		Shift:      ctx.shift,
+		Build:      ctx.build,
+		Summary:    summary,
+		Diff:       UnifiedDiff("spec", beforeText, afterText),
+		// the master-route state is only kept by the change which replaces it
+		Destinations: ctx.destinations,
+		RolledBack:   ctx.rolledBack,
+	}
+
+	if len(record.Diff) > AuditDiffLimit {
+		record.Diff = record.Diff[:AuditDiffLimit]
+		record.Truncated = true
+	}
+
+	records, err := AuditTrail(current)
+	if err != nil {
+		// an unparseable trail must not block traffic changes, so a new one is started
+		logger.Warn(fmt.Sprintf("%s, starting a new audit trail", err), trackingId)
+		records = nil
+	}
+
+	record.Revision = 1
+	if len(records) > 0 {
+		record.Revision = records[len(records)-1].Revision + 1
+	}
+
+	records = append(records, record)
+	if len(records) > HistoryLimit {
+		records = records[len(records)-HistoryLimit:]
+	}
+
+	value, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+
+	for len(value) > AuditMaxBytes && len(records) > 1 {
+		records = records[1:]
+		value, err = json.Marshal(records)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if changed.Annotations == nil {
+		changed.Annotations = map[string]string{}
+	}
+	changed.Annotations[HistoryAnnotation] = string(value)
+
+	return &record, nil
+}
+
+// write appends an applied audit record to the audit file, if any. The change is already applied at this point,
+// so a failure is only logged
+func (a Audit) write(trackingId string, record *AuditRecord) {
+	if a.File == "" {
+		return
+	}
+
+	err := AppendAuditFile(a.File, record)
+	if err != nil {
+		logger.Error(fmt.Sprintf("could not write audit record of %s '%s' due to error '%s'", record.Kind, record.Name, err), trackingId)
+	}
+}
+
+// AppendAuditFile appends an audit record to a json-lines file, creating it if it does not exist
+func AppendAuditFile(path string, record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// auditing records the operation which the router runs until the returned function is called
+func (v *VirtualService) auditing(operation string, s *Shift) func() {
+	previous := v.audited
+	v.audited = auditContext{operation: operation, shift: s, build: v.Build}
+
+	return func() { v.audited = previous }
+}
+
+// auditing records the operation which the router runs until the returned function is called
+func (d *DestinationRule) auditing(operation string, s *Shift) func() {
+	previous := d.audited
+	d.audited = auditContext{operation: operation, shift: s, build: d.Build}
+
+	return func() { d.audited = previous }
+}
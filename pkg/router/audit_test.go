@@ -0,0 +1,240 @@
+package router
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func auditedResources() (*istioFake.Clientset, map[string]string) {
+	istioClient := istioFake.NewSimpleClientset()
+	selector := map[string]string{"app": "api"}
+
+	vs := v1alpha32.VirtualService{}
+	vs.Name = "api-virtualservice"
+	vs.Namespace = "default"
+	vs.Labels = selector
+	vs.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api", Subset: "api-1-default"}},
+			},
+		},
+	}
+
+	dr := v1alpha32.DestinationRule{}
+	dr.Name = "api-destinationrule"
+	dr.Namespace = "default"
+	dr.Labels = selector
+	dr.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-1-default", Labels: map[string]string{"app": "api", "build": "1"}},
+	}
+
+	_, _ = istioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&vs)
+	_, _ = istioClient.NetworkingV1alpha3().DestinationRules(dr.Namespace).Create(&dr)
+
+	return istioClient, selector
+}
+
+func TestAudit_Integrated_Update(t *testing.T) {
+	dir, err := ioutil.TempDir("", "istiops-audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	auditFile := filepath.Join(dir, "audit.jsonl")
+
+	istioClient, selector := auditedResources()
+	audit := Audit{User: "jane", File: auditFile}
+
+	drR := &DestinationRule{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeFake.NewSimpleClientset(), Audit: audit}
+	vsR := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeFake.NewSimpleClientset(), Audit: audit}
+
+	shift := Shift{
+		Port:     5000,
+		Hostname: "api",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "2"},
+			RequestHeaders: map[string]string{"x-version": "2"},
+			Exact:          true,
+		},
+	}
+
+	assert.NoError(t, drR.Update(shift))
+	assert.NoError(t, vsR.Update(shift))
+
+	vs, _ := istioClient.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	records, err := AuditTrail(vs.ObjectMeta)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "jane", records[0].User)
+	assert.Equal(t, "unit-testing-uuid", records[0].TrackingId)
+	assert.Equal(t, OperationShift, records[0].Operation)
+	assert.Equal(t, "VirtualService", records[0].Kind)
+	assert.Equal(t, "default", records[0].Namespace)
+	assert.Equal(t, "api-virtualservice", records[0].Name)
+	assert.Equal(t, map[string]string{"x-version": "2"}, records[0].Shift.Traffic.RequestHeaders)
+	assert.False(t, records[0].Timestamp.IsZero())
+
+	// changes are recorded as a summary of the routes and the diff of the spec
+	assert.Equal(t, []string{"api-2-default=100", "api-1-default=100"}, records[0].Summary)
+	assert.Contains(t, records[0].Diff, "+            \"subset\": \"api-2-default\",")
+	assert.False(t, records[0].Truncated)
+
+	dr, _ := istioClient.NetworkingV1alpha3().DestinationRules("default").Get("api-destinationrule", metav1.GetOptions{})
+	records, err = AuditTrail(dr.ObjectMeta)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "DestinationRule", records[0].Kind)
+	assert.Equal(t, []string{"api-1-default", "api-2-default"}, records[0].Summary)
+
+	// every record is appended to the audit file as well
+	file, err := os.Open(auditFile)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var kinds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		kinds = append(kinds, record.Kind)
+	}
+	assert.Equal(t, []string{"DestinationRule", "VirtualService"}, kinds)
+}
+
+func TestAudit_Integrated_RevertKeepsTrail(t *testing.T) {
+	istioClient, selector := auditedResources()
+	vsR := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeFake.NewSimpleClientset(), Audit: Audit{User: "jane"}}
+
+	snapshot, err := vsR.List(selector)
+	assert.NoError(t, err)
+
+	err = vsR.Update(Shift{
+		Port:     5000,
+		Hostname: "api",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "2"},
+			RequestHeaders: map[string]string{"x-version": "2"},
+			Exact:          true,
+		},
+	})
+	assert.NoError(t, err)
+
+	reverted, err := vsR.Revert(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"virtualService 'api-virtualservice'"}, reverted)
+
+	vs, _ := istioClient.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, 1, len(vs.Spec.Http))
+
+	records, err := AuditTrail(vs.ObjectMeta)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, OperationShift, records[0].Operation)
+	assert.Equal(t, OperationRevert, records[1].Operation)
+	assert.Nil(t, records[1].Shift)
+}
+
+func TestAudit_Integrated_SkipUnchanged(t *testing.T) {
+	istioClient, selector := auditedResources()
+	vsR := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeFake.NewSimpleClientset(), Audit: Audit{User: "jane"}}
+
+	shift := Shift{
+		Port:     5000,
+		Hostname: "api",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "2"},
+			RequestHeaders: map[string]string{"x-version": "2"},
+			Exact:          true,
+		},
+	}
+
+	// identical updates, as the controller's resyncs, are neither applied nor recorded
+	for i := 0; i < HistoryLimit+2; i++ {
+		assert.NoError(t, vsR.Update(shift))
+	}
+
+	updates := 0
+	for _, action := range istioClient.Actions() {
+		if action.GetVerb() == "update" {
+			updates++
+		}
+	}
+	assert.Equal(t, 1, updates)
+
+	vs, _ := istioClient.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	records, err := AuditTrail(vs.ObjectMeta)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(records))
+}
+
+func TestAudit_Unit_Limit(t *testing.T) {
+	meta := metav1.ObjectMeta{Name: "api-virtualservice"}
+	before := &v1alpha3.VirtualService{}
+	after := &v1alpha3.VirtualService{Hosts: []string{"api"}}
+
+	for i := 0; i < HistoryLimit+2; i++ {
+		current := *meta.DeepCopy()
+		_, err := Audit{User: "jane"}.record("unit-testing-uuid", auditContext{operation: OperationShift}, "VirtualService", current, &meta, before, after, nil)
+		assert.NoError(t, err)
+	}
+
+	records, err := AuditTrail(meta)
+	assert.NoError(t, err)
+	assert.Equal(t, HistoryLimit, len(records))
+	// revisions keep counting after the oldest records are dropped
+	assert.Equal(t, 3, records[0].Revision)
+	assert.Equal(t, HistoryLimit+2, records[HistoryLimit-1].Revision)
+
+	// an unparseable trail is replaced instead of blocking the change
+	meta.Annotations[HistoryAnnotation] = "not-json"
+	_, err = AuditTrail(meta)
+	assert.EqualError(t, err, "could not parse audit records of 'api-virtualservice': invalid character 'o' in literal null (expecting 'u')")
+
+	_, err = Audit{User: "jane"}.record("unit-testing-uuid", auditContext{}, "VirtualService", *meta.DeepCopy(), &meta, before, after, nil)
+	assert.NoError(t, err)
+	records, _ = AuditTrail(meta)
+	assert.Equal(t, 1, len(records))
+}
+
+func TestAudit_Unit_MaxBytes(t *testing.T) {
+	meta := metav1.ObjectMeta{Name: "api-virtualservice"}
+	before := &v1alpha3.VirtualService{}
+
+	// every diff is truncated at AuditDiffLimit, so only a few records fit in AuditMaxBytes
+	var hosts []string
+	for i := 0; i < 1000; i++ {
+		hosts = append(hosts, fmt.Sprintf("api-%d.default.svc.cluster.local", i))
+	}
+	after := &v1alpha3.VirtualService{Hosts: hosts}
+
+	for i := 0; i < HistoryLimit; i++ {
+		_, err := Audit{User: "jane"}.record("unit-testing-uuid", auditContext{operation: OperationShift}, "VirtualService", *meta.DeepCopy(), &meta, before, after, nil)
+		assert.NoError(t, err)
+	}
+
+	assert.True(t, len(meta.Annotations[HistoryAnnotation]) <= AuditMaxBytes)
+
+	records, err := AuditTrail(meta)
+	assert.NoError(t, err)
+	assert.True(t, len(records) < HistoryLimit)
+	assert.Equal(t, HistoryLimit, records[len(records)-1].Revision)
+	assert.True(t, records[0].Truncated)
+	assert.Equal(t, AuditDiffLimit, len(records[0].Diff))
+}
@@ -0,0 +1,41 @@
+package router
+
+import (
+	"encoding/json"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+)
+
+// generated DeepCopy functions of istio-client-go only copy spec pointers, so a JSON round-trip is used instead
+
+// CopyVirtualService returns a deep copy of a virtualService, including its spec
+func CopyVirtualService(in *v1alpha32.VirtualService) (*v1alpha32.VirtualService, error) {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &v1alpha32.VirtualService{}
+	err = json.Unmarshal(b, out)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// CopyDestinationRule returns a deep copy of a destinationRule, including its spec
+func CopyDestinationRule(in *v1alpha32.DestinationRule) (*v1alpha32.DestinationRule, error) {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &v1alpha32.DestinationRule{}
+	err = json.Unmarshal(b, out)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
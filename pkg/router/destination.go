@@ -0,0 +1,100 @@
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+)
+
+// DestinationNamespace returns the namespace of a destination host: the one of FQDN hosts
+// ('<service>.<namespace>.svc.cluster.local') or the given namespace for short ones, as istio resolves them
+func DestinationNamespace(host string, namespace string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) >= 3 && parts[2] == "svc" && parts[1] != "" {
+		return parts[1]
+	}
+
+	return namespace
+}
+
+// destinationService returns the service name of a destination host
+func destinationService(host string) string {
+	if DestinationNamespace(host, "") == "" {
+		return host
+	}
+
+	return strings.Split(host, ".")[0]
+}
+
+// SubsetName returns the subset of a build: '<name>-<build>-<namespace>', which are the service name and the
+// namespace of the destination for FQDN hosts
+func SubsetName(host string, build uint32, namespace string) string {
+	return fmt.Sprintf("%s-%v-%s", destinationService(host), build, DestinationNamespace(host, namespace))
+}
+
+// ExternalNamespaces returns the sorted namespaces which routes of virtualServices are routed to, besides their own
+func ExternalNamespaces(vsl *v1alpha32.VirtualServiceList) []string {
+	seen := map[string]bool{}
+	var namespaces []string
+
+	add := func(vs v1alpha32.VirtualService, host string) {
+		namespace := DestinationNamespace(host, vs.Namespace)
+		if namespace != vs.Namespace && !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	for _, vs := range vsl.Items {
+		for _, httpRoute := range vs.Spec.Http {
+			for _, route := range httpRoute.Route {
+				add(vs, route.GetDestination().GetHost())
+			}
+
+			if httpRoute.Mirror != nil {
+				add(vs, httpRoute.Mirror.GetHost())
+			}
+		}
+
+		for _, tcpRoute := range vs.Spec.Tcp {
+			for _, route := range tcpRoute.Route {
+				add(vs, route.GetDestination().GetHost())
+			}
+		}
+
+		for _, tlsRoute := range vs.Spec.Tls {
+			for _, route := range tlsRoute.Route {
+				add(vs, route.GetDestination().GetHost())
+			}
+		}
+	}
+	sort.Strings(namespaces)
+
+	return namespaces
+}
+
+// appendDestinationRules appends the destinationRules matched by a k8s labelSelector at namespaces which were not listed yet
+func appendDestinationRules(d *DestinationRule, selector map[string]string, irl *IstioRouteList, namespaces []string) error {
+	listed := map[string]bool{}
+	for _, dr := range irl.DList.Items {
+		listed[dr.Namespace] = true
+	}
+
+	for _, namespace := range namespaces {
+		if listed[namespace] {
+			continue
+		}
+		listed[namespace] = true
+
+		drs, _, err := d.list(namespace, selector)
+		if err != nil {
+			return err
+		}
+
+		irl.DList.Items = append(irl.DList.Items, drs.Items...)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package router
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDestinationNamespace_Unit(t *testing.T) {
+	cases := []struct {
+		host      string
+		namespace string
+		subset    string
+	}{
+		{"api", "default", "api-3-default"},
+		{"api.domain.io", "default", "api.domain.io-3-default"},
+		{"api.payments.svc.cluster.local", "payments", "api-3-payments"},
+		{"api.payments.svc", "payments", "api-3-payments"},
+		{"api.payments", "default", "api.payments-3-default"},
+	}
+
+	for _, tt := range cases {
+		assert.Equal(t, tt.namespace, DestinationNamespace(tt.host, "default"), tt.host)
+		assert.Equal(t, tt.subset, SubsetName(tt.host, 3, "default"), tt.host)
+	}
+}
+
+func TestExternalNamespaces_Unit(t *testing.T) {
+	vs := v1alpha32.VirtualService{}
+	vs.Namespace = "default"
+	vs.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api"}},
+				{Destination: &v1alpha3.Destination{Host: "api.payments.svc.cluster.local"}},
+				{Destination: &v1alpha3.Destination{Host: "api.default.svc.cluster.local"}},
+			},
+			Mirror: &v1alpha3.Destination{Host: "api.shadow.svc.cluster.local"},
+		},
+	}
+	vs.Spec.Tcp = []*v1alpha3.TCPRoute{
+		{Route: []*v1alpha3.RouteDestination{{Destination: &v1alpha3.Destination{Host: "db.billing.svc.cluster.local"}}}},
+	}
+
+	namespaces := ExternalNamespaces(&v1alpha32.VirtualServiceList{Items: []v1alpha32.VirtualService{vs}})
+	assert.Equal(t, []string{"billing", "payments", "shadow"}, namespaces)
+}
+
+func TestCrossNamespace_Integrated_ShiftAndClear(t *testing.T) {
+	istioClient := istioFake.NewSimpleClientset()
+	kubeClient := kubeFake.NewSimpleClientset()
+	selector := map[string]string{"app": "api"}
+	host := "api.payments.svc.cluster.local"
+
+	// the virtualService lives at the clients' namespace, the destinationRule and pods at the destination's one
+	v := v1alpha32.VirtualService{}
+	v.Name = "api-virtualservice"
+	v.Namespace = "default"
+	v.Labels = selector
+	v.Annotations = map[string]string{RoutesAnnotation: "[]"}
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: host, Subset: "api-1-payments"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{}
+	d.Name = "api-destinationrule"
+	d.Namespace = "payments"
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-1-payments", Labels: map[string]string{"app": "api", "build": "1"}},
+	}
+
+	for _, build := range []string{"1", "2"} {
+		_, _ = kubeClient.CoreV1().Pods("payments").Create(readyPod("api-"+build, "payments", map[string]string{"app": "api", "build": build}, true))
+	}
+
+	_, _ = istioClient.NetworkingV1alpha3().VirtualServices(v.Namespace).Create(&v)
+	_, _ = istioClient.NetworkingV1alpha3().DestinationRules(d.Namespace).Create(&d)
+
+	drR := &DestinationRule{TrackingId: "unit-testing-uuid", Name: host, Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeClient}
+	vsR := &VirtualService{TrackingId: "unit-testing-uuid", Name: host, Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeClient}
+
+	shift := Shift{
+		Port:     5000,
+		Hostname: host,
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "2"},
+			RequestHeaders: map[string]string{"x-version": "2"},
+			Exact:          true,
+		},
+	}
+
+	err := drR.Update(shift)
+	assert.NoError(t, err)
+	err = vsR.Update(shift)
+	assert.NoError(t, err)
+
+	dr, _ := istioClient.NetworkingV1alpha3().DestinationRules("payments").Get(d.Name, metav1.GetOptions{})
+	assert.Equal(t, "api-2-payments", dr.Spec.Subsets[1].Name)
+
+	vs, _ := istioClient.NetworkingV1alpha3().VirtualServices("default").Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, host, vs.Spec.Http[0].Route[0].Destination.Host)
+	assert.Equal(t, "api-2-payments", vs.Spec.Http[0].Route[0].Destination.Subset)
+
+	// destinationRules of the destination's namespace are listed along with the virtualService's one
+	drs, err := (&DestinationRule{TrackingId: "unit-testing-uuid", Namespace: "default", Istio: istioClient}).ListRouted(selector, &v1alpha32.VirtualServiceList{Items: []v1alpha32.VirtualService{*vs}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(drs.DList.Items))
+	assert.Equal(t, "payments", drs.DList.Items[0].Namespace)
+
+	// pods of the canary are found at the destination's namespace, so its route is kept
+	clearR := &VirtualService{TrackingId: "unit-testing-uuid", Namespace: "default", Istio: istioClient, KubeClient: kubeClient}
+	err = clearR.Clear(Shift{Selector: selector}, "soft")
+	assert.NoError(t, err)
+
+	vs, _ = istioClient.NetworkingV1alpha3().VirtualServices("default").Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 2, len(vs.Spec.Http))
+
+	_ = kubeClient.CoreV1().Pods("payments").Delete("api-2", &metav1.DeleteOptions{})
+	err = clearR.Clear(Shift{Selector: selector}, "soft")
+	assert.NoError(t, err)
+
+	vs, _ = istioClient.NetworkingV1alpha3().VirtualServices("default").Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(vs.Spec.Http))
+	assert.Equal(t, "api-1-payments", vs.Spec.Http[0].Route[0].Destination.Subset)
+}
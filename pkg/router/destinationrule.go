@@ -3,6 +3,7 @@ package router
 import (
 	"errors"
 	"fmt"
+	"io"
 	"github.com/pismo/istiops/pkg/logger"
 
 	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
@@ -17,10 +18,22 @@ type DestinationRule struct {
 	Build      uint32
 	Istio      IstioClientInterface
 	KubeClient KubeClientInterface
+	// DryRun prints changes as a diff instead of applying them
+	DryRun bool
+	// DiffOutput receives the diff of each change in dry-run mode, which is only logged when nil
+	DiffOutput io.Writer
+	// Retry of updates which conflict with concurrent changes, DefaultRetry is used when empty
+	Retry Retry
+	// Audit identifies who changes resources and where their audit records are written besides annotations
+	Audit Audit
+	// audited is the running operation, recorded along with each change
+	audited auditContext
 }
 
 // Clear will remove any subset which are not used by a virtualService given a k8s labelSelector
 func (d *DestinationRule) Clear(s Shift, m string) error {
+	defer d.auditing(OperationClear, &s)()
+
 	v := VirtualService{
 		TrackingId: d.TrackingId,
 		Name:       d.Name,
@@ -34,7 +47,7 @@ func (d *DestinationRule) Clear(s Shift, m string) error {
 		return err
 	}
 
-	drs, err := d.List(s.Selector)
+	drs, err := d.ListRouted(s.Selector, vss.VList)
 	if err != nil {
 		return err
 	}
@@ -42,6 +55,11 @@ func (d *DestinationRule) Clear(s Shift, m string) error {
 	var cleanedSubsetList []*v1alpha3.Subset
 
 	for _, dr := range drs.DList.Items {
+		// subsets of other namespaces may be routed by virtualServices which are not being cleared, so they are kept
+		if dr.Namespace != d.namespace() {
+			continue
+		}
+
 		// validate for each subset it's own existence in virtualServices
 		for _, subset := range dr.Spec.Subsets {
 			subsetExists := false
@@ -52,6 +70,17 @@ func (d *DestinationRule) Clear(s Shift, m string) error {
 							subsetExists = true
 						}
 					}
+
+					// mirrored subsets are kept as well
+					if http.Mirror != nil && subset.GetName() == http.Mirror.Subset {
+						subsetExists = true
+					}
+				}
+
+				for _, l4Subset := range l4Subsets(&vs) {
+					if subset.GetName() == l4Subset {
+						subsetExists = true
+					}
 				}
 			}
 
@@ -78,7 +107,7 @@ func (d *DestinationRule) Clear(s Shift, m string) error {
 // Create returns a new subset to be posterior appended to destinationRules
 func (d *DestinationRule) Create(s Shift) (*IstioRules, error) {
 	newSubset := &v1alpha3.Subset{
-		Name:   fmt.Sprintf("%s-%v-%s", d.Name, d.Build, d.Namespace),
+		Name:   SubsetName(d.Name, d.Build, d.Namespace),
 		Labels: s.Traffic.PodSelector,
 	}
 
@@ -141,7 +170,7 @@ func (d *DestinationRule) Validate(s Shift) error {
 or just create a new one (based on Create() method)
 */
 func (d *DestinationRule) Update(s Shift) error {
-	newSubset := fmt.Sprintf("%s-%v-%s", d.Name, d.Build, d.Namespace)
+	defer d.auditing(OperationShift, &s)()
 
 	drs, err := d.List(s.Selector)
 	if err != nil {
@@ -149,55 +178,77 @@ func (d *DestinationRule) Update(s Shift) error {
 	}
 
 	for _, dr := range drs.DList.Items {
-		subsetExists := false
-		for _, subsetValue := range dr.Spec.Subsets {
-			if subsetValue.Name == newSubset {
-				subsetExists = true
+		dr := dr
+		err := onConflict(d.TrackingId, d.Retry, "destinationRule", dr.Name, func(attempt int) error {
+			// a conflict means the resource was changed in the meantime, so the shift is applied again over its fresh state
+			if attempt > 0 {
+				fresh, err := d.get(dr.Name)
+				if err != nil {
+					return err
+				}
+				dr = *fresh
 			}
-		}
 
-		if !subsetExists {
-			irl, err := d.Create(s)
-			if err != nil {
-				logger.Error(fmt.Sprintf("could not create subset due to error '%s'", err), d.TrackingId)
+			changed, err := d.applyShift(s, &dr)
+			if err != nil || !changed {
 				return err
 			}
 
-			dr.Spec.Subsets = append(dr.Spec.Subsets, irl.Subset)
-
 			err = UpdateDestinationRule(d, &dr)
 			if err != nil {
 				logger.Error(fmt.Sprintf("could not update destinationRule '%s' due to error '%s'", dr.Name, err), d.TrackingId)
-				return err
 			}
-		} else {
-			logger.Info(fmt.Sprintf("subset '%s' already created", newSubset), d.TrackingId)
+			return err
+		})
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// List will return all destinationRules which matches a k8s labelSelector
-func (d *DestinationRule) List(selector map[string]string) (*IstioRouteList, error) {
-	logger.Debug(fmt.Sprintf("Getting destinationRules which matches label-selector '%s'", selector), d.TrackingId)
+// applyShift appends the subset of a Shift object to a destinationRule object, returning whether it was changed
+func (d *DestinationRule) applyShift(s Shift, dr *v1alpha32.DestinationRule) (bool, error) {
+	newSubset := SubsetName(d.Name, d.Build, d.Namespace)
 
-	stringified, err := Stringify(d.TrackingId, selector)
+	for _, subsetValue := range dr.Spec.Subsets {
+		if subsetValue.Name == newSubset {
+			logger.Info(fmt.Sprintf("subset '%s' already created", newSubset), d.TrackingId)
+			return false, nil
+		}
+	}
+
+	irl, err := d.Create(s)
 	if err != nil {
-		return &IstioRouteList{}, err
+		logger.Error(fmt.Sprintf("could not create subset due to error '%s'", err), d.TrackingId)
+		return false, err
 	}
 
-	listOptions := metav1.ListOptions{
-		LabelSelector: stringified,
+	dr.Spec.Subsets = append(dr.Spec.Subsets, irl.Subset)
+
+	return true, nil
+}
+
+// get returns a destinationRule by its name, not sharing subsets with any other object
+func (d *DestinationRule) get(name string) (*v1alpha32.DestinationRule, error) {
+	dr, err := d.Istio.NetworkingV1alpha3().DestinationRules(d.namespace()).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
 	}
 
-	drs, err := d.Istio.NetworkingV1alpha3().DestinationRules(d.Namespace).List(listOptions)
+	return CopyDestinationRule(dr)
+}
+
+// List will return all destinationRules which matches a k8s labelSelector
+func (d *DestinationRule) List(selector map[string]string) (*IstioRouteList, error) {
+	drs, stringified, err := d.list(d.namespace(), selector)
 	if err != nil {
 		return &IstioRouteList{}, err
 	}
 
 	if len(drs.Items) <= 0 {
-		return nil, errors.New(fmt.Sprintf("could not find any destinationRules which matched label-selector '%v'", listOptions.LabelSelector))
+		return nil, NotFoundError{fmt.Sprintf("could not find any destinationRules which matched label-selector '%v'", stringified)}
 	}
 
 	irl := IstioRouteList{
@@ -207,14 +258,89 @@ func (d *DestinationRule) List(selector map[string]string) (*IstioRouteList, err
 	return &irl, nil
 }
 
-// UpdateDestinationRule updates a specific virtualService given an updated object
+// ListRouted will return all destinationRules which matches a k8s labelSelector at the router's namespace and at every
+// namespace which the virtualServices of a list are routed to
+func (d *DestinationRule) ListRouted(selector map[string]string, vsl *v1alpha32.VirtualServiceList) (*IstioRouteList, error) {
+	drs, stringified, err := d.list(d.namespace(), selector)
+	if err != nil {
+		return &IstioRouteList{}, err
+	}
+
+	irl := &IstioRouteList{
+		DList: drs,
+	}
+
+	err = appendDestinationRules(d, selector, irl, ExternalNamespaces(vsl))
+	if err != nil {
+		return &IstioRouteList{}, err
+	}
+
+	if len(irl.DList.Items) <= 0 {
+		return nil, NotFoundError{fmt.Sprintf("could not find any destinationRules which matched label-selector '%v'", stringified)}
+	}
+
+	return irl, nil
+}
+
+// list returns the destinationRules of a namespace which matches a k8s labelSelector, even if there are none
+func (d *DestinationRule) list(namespace string, selector map[string]string) (*v1alpha32.DestinationRuleList, string, error) {
+	logger.Debug(fmt.Sprintf("Getting destinationRules which matches label-selector '%s' at namespace '%s'", selector, namespace), d.TrackingId)
+
+	stringified, err := Stringify(d.TrackingId, selector)
+	if err != nil {
+		return nil, "", err
+	}
+
+	listOptions := metav1.ListOptions{
+		LabelSelector: stringified,
+	}
+
+	drs, err := d.Istio.NetworkingV1alpha3().DestinationRules(namespace).List(listOptions)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// listed items are mutated by the callers, so they must not share subsets with any other object
+	for drKey := range drs.Items {
+		drCopy, err := CopyDestinationRule(&drs.Items[drKey])
+		if err != nil {
+			return nil, "", err
+		}
+		drs.Items[drKey] = *drCopy
+	}
+
+	return drs, stringified, nil
+}
+
+// UpdateDestinationRule updates a specific destinationRule given an updated object
 func UpdateDestinationRule(d *DestinationRule, destinationRule *v1alpha32.DestinationRule) error {
+	current, err := d.Istio.NetworkingV1alpha3().DestinationRules(d.namespace()).Get(destinationRule.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if d.DryRun {
+		return PrintDiff(d.TrackingId, d.DiffOutput, "DestinationRule", current.ObjectMeta, &current.Spec, destinationRule.ObjectMeta, &destinationRule.Spec)
+	}
+
+	// no-op updates are neither applied nor audited, so they never push real changes out of the audit trail
+	if unchanged(current.ObjectMeta, destinationRule.ObjectMeta, &current.Spec.DestinationRule, &destinationRule.Spec.DestinationRule) {
+		logger.Info(fmt.Sprintf("No changes for destinationRule '%s', skipping update", destinationRule.Name), d.TrackingId)
+		return nil
+	}
+
+	record, err := d.Audit.record(d.TrackingId, d.audited, "DestinationRule", current.ObjectMeta, &destinationRule.ObjectMeta, &current.Spec.DestinationRule, &destinationRule.Spec.DestinationRule, subsetNames(&destinationRule.Spec.DestinationRule))
+	if err != nil {
+		return err
+	}
+
 	logger.Info(fmt.Sprintf("Updating rule for destinationRule '%s'...", destinationRule.Name), d.TrackingId)
-	_, err := d.Istio.NetworkingV1alpha3().DestinationRules(d.Namespace).Update(destinationRule)
+	_, err = d.Istio.NetworkingV1alpha3().DestinationRules(d.namespace()).Update(destinationRule)
 	if err != nil {
 		return err
 	}
 
+	d.Audit.write(d.TrackingId, record)
 	return nil
 }
 
@@ -226,3 +352,23 @@ func ValidateDestinationRuleList(irl *IstioRouteList) error {
 
 	return nil
 }
+
+// namespace returns where destinationRules are looked up: the namespace of FQDN destinations or the router's one
+func (d *DestinationRule) namespace() string {
+	return DestinationNamespace(d.Name, d.Namespace)
+}
+
+// SetDryRun makes the router print its changes as a diff instead of applying them
+func (d *DestinationRule) SetDryRun(dryRun bool) {
+	d.DryRun = dryRun
+}
+
+// GetNamespace returns the namespace which the router operates at
+func (d *DestinationRule) GetNamespace() string {
+	return d.Namespace
+}
+
+// SetNamespace binds the router to another namespace
+func (d *DestinationRule) SetNamespace(namespace string) {
+	d.Namespace = namespace
+}
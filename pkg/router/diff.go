@@ -0,0 +1,274 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const diffContext = 3
+
+type resourceView struct {
+	Kind     string           `json:"kind"`
+	Metadata resourceMetadata `json:"metadata"`
+	Spec     interface{}      `json:"spec"`
+}
+
+type resourceMetadata struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Yamlify returns the yaml representation of a resource's metadata and spec
+func Yamlify(kind string, meta metav1.ObjectMeta, spec interface{}) (string, error) {
+	view := resourceView{
+		Kind: kind,
+		Metadata: resourceMetadata{
+			Name:        meta.Name,
+			Namespace:   meta.Namespace,
+			Labels:      meta.Labels,
+			Annotations: meta.Annotations,
+		},
+		Spec: spec,
+	}
+
+	b, err := yaml.Marshal(view)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// lineDiff returns the shortest edit script between two list of lines based on their longest common subsequence
+func lineDiff(a []string, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		} else {
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+
+	return lines
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// UnifiedDiff returns a unified diff between two texts, or an empty string when both are equal
+func UnifiedDiff(name string, from string, to string) string {
+	lines := lineDiff(splitLines(from), splitLines(to))
+
+	changed := false
+	for _, line := range lines {
+		if line.op != ' ' {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("--- a/%s\n+++ b/%s\n", name, name))
+
+	// group changes in hunks surrounded by context lines
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+
+		hunkStart := start - diffContext
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+
+		hunkEnd := start
+		for k := start; k < len(lines); k++ {
+			if lines[k].op != ' ' {
+				hunkEnd = k
+			} else if k-hunkEnd > 2*diffContext {
+				break
+			}
+		}
+
+		hunkEnd += diffContext
+		if hunkEnd >= len(lines) {
+			hunkEnd = len(lines) - 1
+		}
+
+		// count line positions of the hunk at both texts
+		fromLine, toLine := 1, 1
+		for _, line := range lines[:hunkStart] {
+			if line.op != '+' {
+				fromLine++
+			}
+			if line.op != '-' {
+				toLine++
+			}
+		}
+
+		fromCount, toCount := 0, 0
+		for _, line := range lines[hunkStart : hunkEnd+1] {
+			if line.op != '+' {
+				fromCount++
+			}
+			if line.op != '-' {
+				toCount++
+			}
+		}
+
+		b.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount))
+		for _, line := range lines[hunkStart : hunkEnd+1] {
+			b.WriteString(fmt.Sprintf("%c%s\n", line.op, line.text))
+		}
+
+		start = hunkEnd + 1
+	}
+
+	return b.String()
+}
+
+// PrintDiff writes to w the unified diff between current and updated states of a resource, nothing is written when w
+// is nil
+func PrintDiff(trackingId string, w io.Writer, kind string, currentMeta metav1.ObjectMeta, currentSpec interface{}, updatedMeta metav1.ObjectMeta, updatedSpec interface{}) error {
+	current, err := Yamlify(kind, currentMeta, currentSpec)
+	if err != nil {
+		return err
+	}
+
+	updated, err := Yamlify(kind, updatedMeta, updatedSpec)
+	if err != nil {
+		return err
+	}
+
+	diff := UnifiedDiff(fmt.Sprintf("%s/%s/%s", strings.ToLower(kind), currentMeta.Namespace, currentMeta.Name), current, updated)
+	if diff == "" {
+		logger.Info(fmt.Sprintf("Dry-run: no changes for %s '%s'", kind, currentMeta.Name), trackingId)
+		return nil
+	}
+
+	logger.Info(fmt.Sprintf("Dry-run: skipping update of %s '%s'", kind, currentMeta.Name), trackingId)
+	if w == nil {
+		return nil
+	}
+
+	_, err = io.WriteString(w, diff)
+	return err
+}
+
+// ReversePatch restores the text which a unified diff of UnifiedDiff was computed from, given the text it led to
+func ReversePatch(to string, diff string) (string, error) {
+	type hunk struct {
+		toLine int
+		lines  []string
+	}
+
+	var hunks []*hunk
+	for _, line := range splitLines(diff) {
+		switch {
+		case strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ "):
+			continue
+		case strings.HasPrefix(line, "@@ "):
+			var fromLine, fromCount, toLine, toCount int
+			_, err := fmt.Sscanf(line, "@@ -%d,%d +%d,%d @@", &fromLine, &fromCount, &toLine, &toCount)
+			if err != nil {
+				return "", errors.New(fmt.Sprintf("invalid hunk header '%s'", line))
+			}
+			hunks = append(hunks, &hunk{toLine: toLine})
+		case len(hunks) == 0 || line == "":
+			return "", errors.New(fmt.Sprintf("invalid diff line '%s'", line))
+		default:
+			hunks[len(hunks)-1].lines = append(hunks[len(hunks)-1].lines, line)
+		}
+	}
+
+	lines := splitLines(to)
+
+	// hunks are reverted from the last one, so the positions of the previous ones are kept
+	for i := len(hunks) - 1; i >= 0; i-- {
+		var from, expected []string
+		for _, line := range hunks[i].lines {
+			if line[0] != '+' {
+				from = append(from, line[1:])
+			}
+			if line[0] != '-' {
+				expected = append(expected, line[1:])
+			}
+		}
+
+		start := hunks[i].toLine - 1
+		if start < 0 || start+len(expected) > len(lines) {
+			return "", errors.New("diff does not apply to the given text")
+		}
+
+		for k, line := range expected {
+			if lines[start+k] != line {
+				return "", errors.New("diff does not apply to the given text")
+			}
+		}
+
+		restored := append([]string{}, lines[:start]...)
+		restored = append(restored, from...)
+		lines = append(restored, lines[start+len(expected):]...)
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
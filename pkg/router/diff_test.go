@@ -0,0 +1,171 @@
+package router
+
+import (
+	"bytes"
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUnifiedDiff_Unit_Equal(t *testing.T) {
+	assert.Equal(t, "", UnifiedDiff("resource", "a\nb\n", "a\nb\n"))
+}
+
+func TestUnifiedDiff_Unit(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	to := "a\nb\nc\nd\nE\nf\ng\nh\ni\n"
+
+	expected := `--- a/resource
++++ b/resource
+@@ -2,7 +2,8 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
++i
+`
+
+	assert.Equal(t, expected, UnifiedDiff("resource", from, to))
+}
+
+func TestUnifiedDiff_Unit_SplitHunks(t *testing.T) {
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	to := "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n"
+
+	expected := `--- a/resource
++++ b/resource
+@@ -1,3 +1,4 @@
++0
+ 1
+ 2
+ 3
+@@ -9,4 +10,3 @@
+ 9
+ 10
+ 11
+-12
+`
+
+	assert.Equal(t, expected, UnifiedDiff("resource", from, to))
+}
+
+func TestReversePatch_Unit(t *testing.T) {
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	to := "0\n1\n2\n3\n4\n5\nsix\n7\n8\n9\n10\n11\n"
+
+	restored, err := ReversePatch(to, UnifiedDiff("resource", from, to))
+	assert.NoError(t, err)
+	assert.Equal(t, from, restored)
+
+	restored, err = ReversePatch("", UnifiedDiff("resource", "a\n", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "a\n", restored)
+
+	// texts changed after the diff was computed can't be restored
+	_, err = ReversePatch("0\n1\n2\n", UnifiedDiff("resource", from, to))
+	assert.EqualError(t, err, "diff does not apply to the given text")
+}
+
+func TestYamlify_Unit(t *testing.T) {
+	vs := v1alpha32.VirtualService{}
+	vs.Name = "api-testing"
+	vs.Namespace = "default"
+	vs.Spec.Hosts = []string{"api-service"}
+
+	y, err := Yamlify("VirtualService", vs.ObjectMeta, &vs.Spec)
+	assert.NoError(t, err)
+	assert.Equal(t, "kind: VirtualService\nmetadata:\n  name: api-testing\n  namespace: default\nspec:\n  hosts:\n  - api-service\n", y)
+}
+
+func TestUpdateVirtualService_Integrated_DryRun(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Namespace:  "integration",
+		Istio:      fakeIstioClient,
+		DryRun:     true,
+		DiffOutput: &bytes.Buffer{},
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-2-integration"}},
+			},
+		},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	vss, err := vs.List(selector)
+	assert.NoError(t, err)
+
+	listed := vss.VList.Items[0]
+	listed.Spec.Http[0].Route[0].Destination.Subset = "api-testing-3-integration"
+
+	err = UpdateVirtualService(&vs, &listed)
+	assert.NoError(t, err)
+
+	// nothing is applied in dry-run mode
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, "api-testing-2-integration", re.Spec.Http[0].Route[0].Destination.Subset)
+
+	diff := vs.DiffOutput.(*bytes.Buffer).String()
+	assert.Contains(t, diff, "--- a/virtualservice/integration/integration-test-virtualservice\n")
+	assert.Contains(t, diff, "+        subset: api-testing-3-integration\n")
+}
+
+func TestUpdateDestinationRule_Integrated_DryRun(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	dr := DestinationRule{
+		TrackingId: "unit-testing-uuid",
+		Namespace:  "integration",
+		Istio:      fakeIstioClient,
+		DryRun:     true,
+		DiffOutput: &bytes.Buffer{},
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = dr.Namespace
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-testing-2-integration", Labels: map[string]string{"build": "2"}},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(dr.Namespace).Create(&d)
+
+	drs, err := dr.List(selector)
+	assert.NoError(t, err)
+
+	listed := drs.DList.Items[0]
+	listed.Spec.Subsets = append(listed.Spec.Subsets, &v1alpha3.Subset{Name: "api-testing-3-integration", Labels: map[string]string{"build": "3"}})
+
+	err = UpdateDestinationRule(&dr, &listed)
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().DestinationRules(dr.Namespace).Get(d.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(re.Spec.Subsets))
+	assert.Contains(t, dr.DiffOutput.(*bytes.Buffer).String(), "+    name: api-testing-3-integration\n")
+}
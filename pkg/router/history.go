@@ -0,0 +1,279 @@
+package router
+
+import (
+	"fmt"
+	"time"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	"istio.io/api/networking/v1alpha3"
+)
+
+// RouteDestination is a master-route destination with the labels of its subset
+type RouteDestination struct {
+	Host   string            `json:"host"`
+	Port   uint32            `json:"port"`
+	Subset string            `json:"subset"`
+	Weight int32             `json:"weight"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// History returns the audit records of a virtualService which replaced its master-route, the newest one being the
+// last element
+func History(vs *v1alpha32.VirtualService) ([]AuditRecord, error) {
+	records, err := AuditTrail(vs.ObjectMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []AuditRecord
+	for _, record := range records {
+		if len(record.Destinations) > 0 {
+			revisions = append(revisions, record)
+		}
+	}
+
+	return revisions, nil
+}
+
+// rollbackTarget returns the newest master-route state of a virtualService which differs from its current one and was
+// not restored by a rollback yet, so consecutive rollbacks step further back in its history
+func rollbackTarget(vs *v1alpha32.VirtualService, current []RouteDestination) (AuditRecord, bool, error) {
+	records, err := AuditTrail(vs.ObjectMeta)
+	if err != nil {
+		return AuditRecord{}, false, err
+	}
+
+	rolledBack := map[int]bool{}
+	for _, record := range records {
+		if record.RolledBack > 0 {
+			rolledBack[record.RolledBack] = true
+		}
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if len(record.Destinations) == 0 || rolledBack[record.Revision] || sameDestinations(record.Destinations, current) {
+			continue
+		}
+
+		return record, true, nil
+	}
+
+	return AuditRecord{}, false, nil
+}
+
+// masterDestinations returns a copy of the master-route destinations of a virtualService
+func masterDestinations(vs *v1alpha32.VirtualService, master MasterRoute) []RouteDestination {
+	var destinations []RouteDestination
+
+	for _, httpValue := range vs.Spec.Http {
+		if !orDefault(master).Matches(httpValue) {
+			continue
+		}
+
+		for _, routeValue := range httpValue.Route {
+			destinations = append(destinations, RouteDestination{
+				Host:   routeValue.Destination.GetHost(),
+				Port:   routeValue.Destination.GetPort().GetNumber(),
+				Subset: routeValue.Destination.GetSubset(),
+				Weight: routeValue.Weight,
+			})
+		}
+	}
+
+	return destinations
+}
+
+func sameDestinations(a []RouteDestination, b []RouteDestination) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Host != b[i].Host || a[i].Port != b[i].Port || a[i].Subset != b[i].Subset || a[i].Weight != b[i].Weight {
+			return false
+		}
+	}
+
+	return true
+}
+
+// subsetLabels returns the labels of every subset from destinationRules which matches a k8s labelSelector, including
+// the ones of namespaces which a virtualService is routed to
+func (v *VirtualService) subsetLabels(selector map[string]string, vs *v1alpha32.VirtualService) map[string]map[string]string {
+	labels := map[string]map[string]string{}
+
+	dr := DestinationRule{
+		TrackingId: v.TrackingId,
+		Namespace:  v.Namespace,
+		Istio:      v.Istio,
+	}
+
+	// subsets of the shifted destination and of every destination of the virtualService
+	drs := &IstioRouteList{DList: &v1alpha32.DestinationRuleList{}}
+	namespaces := []string{v.Namespace, DestinationNamespace(v.Name, v.Namespace)}
+	namespaces = append(namespaces, ExternalNamespaces(&v1alpha32.VirtualServiceList{Items: []v1alpha32.VirtualService{*vs}})...)
+	err := appendDestinationRules(&dr, selector, drs, namespaces)
+	if err != nil {
+		logger.Debug(fmt.Sprintf("recording master-route history without subset labels: %s", err), v.TrackingId)
+		return labels
+	}
+
+	for _, d := range drs.DList.Items {
+		for _, subset := range d.Spec.Subsets {
+			labels[subset.Name] = subset.Labels
+		}
+	}
+
+	return labels
+}
+
+// recordHistory keeps the previous master-route state to be recorded along with the next change of the
+// virtualService, when it was changed
+func (v *VirtualService) recordHistory(selector map[string]string, vs *v1alpha32.VirtualService, previous []RouteDestination) {
+	if len(previous) == 0 || sameDestinations(previous, masterDestinations(vs, v.masterRoute())) {
+		return
+	}
+
+	labels := v.subsetLabels(selector, vs)
+	for i := range previous {
+		previous[i].Labels = labels[previous[i].Subset]
+	}
+
+	logger.Debug(fmt.Sprintf("Recording previous master-route state of virtualService '%s'", vs.Name), v.TrackingId)
+	v.audited.destinations = previous
+}
+
+// Rollback restores the master-route of virtualServices which matches a k8s labelSelector to its previous recorded state
+func (v *VirtualService) Rollback(selector map[string]string) error {
+	defer v.auditing(OperationRollback, nil)()
+
+	dr := DestinationRule{
+		TrackingId: v.TrackingId,
+		Namespace:  v.Namespace,
+		Istio:      v.Istio,
+		DryRun:     v.DryRun,
+		DiffOutput: v.DiffOutput,
+		Audit:      v.Audit,
+		audited:    v.audited,
+	}
+
+	vss, err := v.List(selector)
+	if err != nil {
+		return err
+	}
+
+	// subsets of destinations in other namespaces are restored to the destinationRules of those namespaces
+	drs, err := dr.ListRouted(selector, vss.VList)
+	if err != nil {
+		return err
+	}
+
+	previousRevisions := map[string]AuditRecord{}
+	for _, vs := range vss.VList.Items {
+		previous, ok, err := rollbackTarget(&vs, masterDestinations(&vs, v.masterRoute()))
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return errors.New(fmt.Sprintf("could not find any previous master-route state for virtualService '%s'", vs.Name))
+		}
+
+		previousRevisions[vs.Name] = previous
+	}
+
+	// subsets may have been cleared in the meantime, so they must be restored before routing to them
+	for drKey := range drs.DList.Items {
+		d := &drs.DList.Items[drKey]
+		subsetsAdded := false
+		for _, previous := range previousRevisions {
+			for _, destination := range previous.Destinations {
+				if DestinationNamespace(destination.Host, v.Namespace) != d.Namespace {
+					continue
+				}
+
+				subsetExists := false
+				for _, subset := range d.Spec.Subsets {
+					if subset.Name == destination.Subset {
+						subsetExists = true
+					}
+				}
+
+				if subsetExists {
+					continue
+				}
+
+				if len(destination.Labels) == 0 {
+					return errors.New(fmt.Sprintf("could not restore subset '%s' without recorded labels", destination.Subset))
+				}
+
+				logger.Info(fmt.Sprintf("Restoring subset '%s' to destinationRule '%s'", destination.Subset, d.Name), v.TrackingId)
+				d.Spec.Subsets = append(d.Spec.Subsets, &v1alpha3.Subset{
+					Name:   destination.Subset,
+					Labels: destination.Labels,
+				})
+				subsetsAdded = true
+			}
+		}
+
+		if subsetsAdded {
+			owner := dr
+			owner.Namespace = d.Namespace
+			err = UpdateDestinationRule(&owner, d)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, vs := range vss.VList.Items {
+		previous := previousRevisions[vs.Name]
+
+		var routeRestored []*v1alpha3.HTTPRouteDestination
+		for _, destination := range previous.Destinations {
+			routeDestination := &v1alpha3.HTTPRouteDestination{
+				Weight: destination.Weight,
+				Destination: &v1alpha3.Destination{
+					Host:   destination.Host,
+					Subset: destination.Subset,
+				},
+			}
+
+			if destination.Port != 0 {
+				routeDestination.Destination.Port = &v1alpha3.PortSelector{
+					Port: &v1alpha3.PortSelector_Number{
+						Number: destination.Port,
+					},
+				}
+			}
+
+			routeRestored = append(routeRestored, routeDestination)
+		}
+
+		masterRouteExists := false
+		for _, httpValue := range vs.Spec.Http {
+			if v.masterRoute().Matches(httpValue) {
+				masterRouteExists = true
+				httpValue.Route = routeRestored
+			}
+		}
+
+		if !masterRouteExists {
+			return errors.New(fmt.Sprintf("could not find master-route '%s' for virtualService '%s'", v.masterRoute(), vs.Name))
+		}
+
+		// the restored revision is recorded instead of the rolled back state, so the next rollback steps further back
+		v.audited.rolledBack = previous.Revision
+
+		logger.Info(fmt.Sprintf("Rolling back master-route of virtualService '%s' to state recorded at '%s'", vs.Name, previous.Timestamp.Format(time.RFC3339)), v.TrackingId)
+		err = UpdateVirtualService(v, &vs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package router
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHistory_Unit_Empty(t *testing.T) {
+	revisions, err := History(&v1alpha32.VirtualService{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(revisions))
+}
+
+func TestHistory_Unit_Legacy(t *testing.T) {
+	vs := &v1alpha32.VirtualService{}
+	vs.Annotations = map[string]string{
+		HistoryAnnotation: `[{"destinations":[{"host":"api","port":0,"subset":"api-1-default","weight":100}],"trackingId":"a","timestamp":"2019-08-01T10:00:00Z"},{"destinations":[{"host":"api","port":0,"subset":"api-2-default","weight":100}],"trackingId":"b","timestamp":"2019-08-02T10:00:00Z"}]`,
+	}
+
+	// master-route states recorded before the audit trail are kept as its oldest records
+	revisions, err := History(vs)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, 1, revisions[0].Revision)
+	assert.Equal(t, 2, revisions[1].Revision)
+	assert.Equal(t, "api-2-default", revisions[1].Destinations[0].Subset)
+
+	before := &v1alpha3.VirtualService{}
+	after := &v1alpha3.VirtualService{Hosts: []string{"api"}}
+	_, err = Audit{User: "jane"}.record("unit-testing-uuid", auditContext{operation: OperationShift}, "VirtualService", *vs.ObjectMeta.DeepCopy(), &vs.ObjectMeta, before, after, nil)
+	assert.NoError(t, err)
+
+	records, err := AuditTrail(vs.ObjectMeta)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, 3, records[2].Revision)
+
+	// only changes of the master-route are part of its history
+	revisions, _ = History(vs)
+	assert.Equal(t, 2, len(revisions))
+}
+
+func TestVirtualService_Rollback_Integrated(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Headers: map[string]*v1alpha3.StringMatch{"x-email": {MatchType: &v1alpha3.StringMatch_Exact{Exact: "somebody@domain.io"}}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-3-integration"}},
+			},
+		},
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-2-integration"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = vs.Namespace
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-testing-2-integration", Labels: map[string]string{"build": "2"}},
+		{Name: "api-testing-3-integration", Labels: map[string]string{"build": "3"}},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Create(&d)
+
+	// without any previous state there is nothing to rollback to
+	err := vs.Rollback(selector)
+	assert.EqualError(t, err, "could not find any previous master-route state for virtualService 'integration-test-virtualservice'")
+
+	shift := Shift{
+		Port:     8888,
+		Hostname: "api-service",
+		Selector: selector,
+		Traffic:  Traffic{Weight: 100},
+	}
+
+	err = vs.Update(shift)
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, "api-testing-3-integration", re.Spec.Http[len(re.Spec.Http)-1].Route[0].Destination.Subset)
+
+	revisions, err := History(re)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(revisions))
+	assert.Equal(t, "api-testing-2-integration", revisions[0].Destinations[0].Subset)
+	assert.Equal(t, map[string]string{"build": "2"}, revisions[0].Destinations[0].Labels)
+	// along with the audit record of the shift which replaced it
+	assert.Equal(t, OperationShift, revisions[0].Operation)
+	assert.Equal(t, "api-testing-3-integration=100", revisions[0].Summary[len(revisions[0].Summary)-1])
+
+	// the same shift does not record a new state
+	err = vs.Update(shift)
+	assert.NoError(t, err)
+	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	revisions, _ = History(re)
+	assert.Equal(t, 1, len(revisions))
+
+	// old subset was cleared in the meantime
+	dr, _ := fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Get(d.Name, metav1.GetOptions{})
+	dr.Spec.Subsets = dr.Spec.Subsets[1:]
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Update(dr)
+
+	err = vs.Rollback(selector)
+	assert.NoError(t, err)
+
+	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	master := re.Spec.Http[len(re.Spec.Http)-1]
+	assert.Equal(t, ".+", master.Match[0].Uri.GetRegex())
+	assert.Equal(t, 1, len(master.Route))
+	assert.Equal(t, "api-testing-2-integration", master.Route[0].Destination.Subset)
+	assert.Nil(t, master.Route[0].Destination.Port)
+
+	// the rollback records the restored revision instead of the rolled back state
+	revisions, _ = History(re)
+	assert.Equal(t, 1, len(revisions))
+	records, _ := AuditTrail(re.ObjectMeta)
+	assert.Equal(t, OperationRollback, records[len(records)-1].Operation)
+	assert.Equal(t, revisions[0].Revision, records[len(records)-1].RolledBack)
+
+	dr, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Get(d.Name, metav1.GetOptions{})
+	assert.Equal(t, 2, len(dr.Spec.Subsets))
+	assert.Equal(t, "api-testing-2-integration", dr.Spec.Subsets[1].Name)
+	assert.Equal(t, map[string]string{"build": "2"}, dr.Spec.Subsets[1].Labels)
+
+	// so there is nothing left to rollback to
+	err = vs.Rollback(selector)
+	assert.EqualError(t, err, "could not find any previous master-route state for virtualService 'integration-test-virtualservice'")
+}
+
+func TestVirtualService_Rollback_Integrated_Consecutive(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Istio:      fakeIstioClient,
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	headerRoute := func(build string) *v1alpha3.HTTPRoute {
+		return &v1alpha3.HTTPRoute{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Headers: map[string]*v1alpha3.StringMatch{"x-build": {MatchType: &v1alpha3.StringMatch_Exact{Exact: build}}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-" + build + "-integration"}},
+			},
+		}
+	}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		headerRoute("2"),
+		headerRoute("3"),
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-1-integration"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = vs.Namespace
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-testing-1-integration", Labels: map[string]string{"build": "1"}},
+		{Name: "api-testing-2-integration", Labels: map[string]string{"build": "2"}},
+		{Name: "api-testing-3-integration", Labels: map[string]string{"build": "3"}},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Create(&d)
+
+	shift := Shift{
+		Port:     8888,
+		Hostname: "api-service",
+		Selector: selector,
+		Traffic:  Traffic{Weight: 100},
+	}
+
+	for _, build := range []uint32{2, 3} {
+		vs.Build = build
+		err := vs.Update(shift)
+		assert.NoError(t, err)
+	}
+
+	masterSubset := func() string {
+		re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+		return re.Spec.Http[len(re.Spec.Http)-1].Route[0].Destination.Subset
+	}
+	assert.Equal(t, "api-testing-3-integration", masterSubset())
+
+	// each rollback steps one state further back instead of undoing the previous rollback
+	err := vs.Rollback(selector)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-testing-2-integration", masterSubset())
+
+	err = vs.Rollback(selector)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-testing-1-integration", masterSubset())
+
+	err = vs.Rollback(selector)
+	assert.EqualError(t, err, "could not find any previous master-route state for virtualService 'integration-test-virtualservice'")
+	assert.Equal(t, "api-testing-1-integration", masterSubset())
+}
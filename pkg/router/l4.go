@@ -0,0 +1,189 @@
+package router
+
+import (
+	"fmt"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	"istio.io/api/networking/v1alpha3"
+)
+
+const (
+	// ProtocolHTTP shifts traffic of virtualService's http routes (default)
+	ProtocolHTTP = "http"
+	// ProtocolTCP shifts traffic of virtualService's tcp routes
+	ProtocolTCP = "tcp"
+	// ProtocolTLS shifts traffic of virtualService's tls (passthrough) routes
+	ProtocolTLS = "tls"
+)
+
+// ValidateProtocol checks if a Traffic protocol is supported, empty meaning ProtocolHTTP
+func ValidateProtocol(protocol string) error {
+	if protocol != "" && protocol != ProtocolHTTP && protocol != ProtocolTCP && protocol != ProtocolTLS {
+		return errors.New(fmt.Sprintf("protocol '%s' must be '%s', '%s' or '%s'", protocol, ProtocolHTTP, ProtocolTCP, ProtocolTLS))
+	}
+
+	return nil
+}
+
+// isL4 returns whether a Shift targets tcp or tls routes
+func isL4(s Shift) bool {
+	return s.Traffic.Protocol == ProtocolTCP || s.Traffic.Protocol == ProtocolTLS
+}
+
+// routesToHost returns whether any destination of a L4 route is the given hostname
+func routesToHost(routeDestinations []*v1alpha3.RouteDestination, hostname string) bool {
+	for _, routeValue := range routeDestinations {
+		if routeValue.Destination.GetHost() == hostname {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BalanceL4 returns the destinations of a tcp/tls route with weight balanced between its current subset and the new one
+func BalanceL4(routeDestinations []*v1alpha3.RouteDestination, newSubset string, s Shift) ([]*v1alpha3.RouteDestination, error) {
+	if len(routeDestinations) == 0 {
+		return nil, errors.New("empty destinations for route")
+	}
+
+	// a weight is balanced between two subsets, any other subset of a split would be silently dropped
+	if len(routeDestinations) > 2 {
+		return nil, errors.New(fmt.Sprintf("route is split across %d subsets, refusing to balance a 'weight' between two of them: shift with 'weights' instead", len(routeDestinations)))
+	}
+
+	var subsets []string
+	for _, routeValue := range routeDestinations {
+		subsets = append(subsets, routeValue.Destination.GetSubset())
+	}
+
+	currentSubset, ok := CurrentSubset(subsets, newSubset)
+	if !ok {
+		return routeDestinations, nil
+	}
+
+	httpBalanced, err := Balance(currentSubset, newSubset, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return toL4(httpBalanced), nil
+}
+
+// toL4 converts http route destinations to tcp/tls ones
+func toL4(httpDestinations []*v1alpha3.HTTPRouteDestination) []*v1alpha3.RouteDestination {
+	var routeDestinations []*v1alpha3.RouteDestination
+	for _, httpValue := range httpDestinations {
+		routeDestinations = append(routeDestinations, &v1alpha3.RouteDestination{
+			Destination: httpValue.Destination,
+			Weight:      httpValue.Weight,
+		})
+	}
+
+	return routeDestinations
+}
+
+// newL4Destination returns a single destination routing 100% of traffic to a subset, or the split of a Shift object
+func newL4Destination(subset string, s Shift) []*v1alpha3.RouteDestination {
+	if len(s.Traffic.Weights) > 0 {
+		return toL4(Split(s))
+	}
+
+	return []*v1alpha3.RouteDestination{
+		{
+			Destination: &v1alpha3.Destination{
+				Host:   s.Hostname,
+				Subset: subset,
+				Port: &v1alpha3.PortSelector{
+					Port: &v1alpha3.PortSelector_Number{
+						Number: s.Port,
+					},
+				},
+			},
+		},
+	}
+}
+
+// applyL4Shift balances the tcp or tls route of a virtualService which routes to the Shift hostname, creating it when it does not exist
+func (v *VirtualService) applyL4Shift(s Shift, vs *v1alpha32.VirtualService) error {
+	subsetName := SubsetName(v.Name, v.Build, v.Namespace)
+
+	var routes []*[]*v1alpha3.RouteDestination
+	if s.Traffic.Protocol == ProtocolTCP {
+		for _, tcpValue := range vs.Spec.Tcp {
+			if routesToHost(tcpValue.Route, s.Hostname) {
+				routes = append(routes, &tcpValue.Route)
+			}
+		}
+	}
+
+	if s.Traffic.Protocol == ProtocolTLS {
+		for _, tlsValue := range vs.Spec.Tls {
+			if routesToHost(tlsValue.Route, s.Hostname) {
+				routes = append(routes, &tlsValue.Route)
+			}
+		}
+	}
+
+	if len(routes) > 1 {
+		return errors.New(fmt.Sprintf("multiple %s routes found for host '%s'", s.Traffic.Protocol, s.Hostname))
+	}
+
+	if len(routes) == 0 {
+		logger.Info(fmt.Sprintf("Could not find a %s route for host '%s', creating with 100%% of weight...", s.Traffic.Protocol, s.Hostname), v.TrackingId)
+
+		if s.Traffic.Protocol == ProtocolTCP {
+			tcpRoute := &v1alpha3.TCPRoute{Route: newL4Destination(subsetName, s)}
+			if s.Port != 0 {
+				tcpRoute.Match = []*v1alpha3.L4MatchAttributes{{Port: s.Port}}
+			}
+			vs.Spec.Tcp = append(vs.Spec.Tcp, tcpRoute)
+		}
+
+		if s.Traffic.Protocol == ProtocolTLS {
+			// tls routes are matched by the SNI of the requests, which are the virtualService's hosts
+			tlsRoute := &v1alpha3.TLSRoute{
+				Match: []*v1alpha3.TLSMatchAttributes{{SniHosts: vs.Spec.Hosts, Port: s.Port}},
+				Route: newL4Destination(subsetName, s),
+			}
+			vs.Spec.Tls = append(vs.Spec.Tls, tlsRoute)
+		}
+
+		return nil
+	}
+
+	logger.Info(fmt.Sprintf("Updating %s route to balance canary traffic", s.Traffic.Protocol), v.TrackingId)
+	if len(s.Traffic.Weights) > 0 {
+		*routes[0] = toL4(Split(s))
+		return nil
+	}
+
+	balanced, err := BalanceL4(*routes[0], subsetName, s)
+	if err != nil {
+		return err
+	}
+	*routes[0] = balanced
+
+	return nil
+}
+
+// l4Subsets returns every subset routed by tcp and tls routes of a virtualService
+func l4Subsets(vs *v1alpha32.VirtualService) []string {
+	var subsets []string
+
+	for _, tcpValue := range vs.Spec.Tcp {
+		for _, routeValue := range tcpValue.Route {
+			subsets = append(subsets, routeValue.Destination.GetSubset())
+		}
+	}
+
+	for _, tlsValue := range vs.Spec.Tls {
+		for _, routeValue := range tlsValue.Route {
+			subsets = append(subsets, routeValue.Destination.GetSubset())
+		}
+	}
+
+	return subsets
+}
@@ -0,0 +1,227 @@
+package router
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateProtocol_Unit(t *testing.T) {
+	assert.NoError(t, ValidateProtocol(""))
+	assert.NoError(t, ValidateProtocol(ProtocolTCP))
+	assert.EqualError(t, ValidateProtocol("udp"), "protocol 'udp' must be 'http', 'tcp' or 'tls'")
+}
+
+func TestVirtualService_Validate_Unit_L4Headers(t *testing.T) {
+	vs := VirtualService{}
+
+	err := vs.Validate(Shift{Traffic: Traffic{Protocol: ProtocolTLS, RequestHeaders: map[string]string{"x-email": "somebody@domain.io"}}})
+	assert.EqualError(t, err, "'tls' routes can only be shifted by 'weight'")
+
+	err = vs.Validate(Shift{Traffic: Traffic{Protocol: ProtocolTCP, Weight: 10}})
+	assert.NoError(t, err)
+}
+
+func TestBalanceL4_Unit(t *testing.T) {
+	s := Shift{Hostname: "api-service", Port: 5000, Traffic: Traffic{Weight: 20}}
+
+	current := []*v1alpha3.RouteDestination{
+		{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-3-default"}, Weight: 10},
+		{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-2-default"}, Weight: 90},
+	}
+
+	balanced, err := BalanceL4(current, "api-3-default", s)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(balanced))
+	assert.Equal(t, "api-2-default", balanced[0].Destination.Subset)
+	assert.Equal(t, int32(80), balanced[0].Weight)
+	assert.Equal(t, "api-3-default", balanced[1].Destination.Subset)
+	assert.Equal(t, int32(20), balanced[1].Weight)
+
+	// a route which already routes every connection to the subset is kept as is
+	balanced, err = BalanceL4(current[:1], "api-3-default", s)
+	assert.NoError(t, err)
+	assert.Equal(t, current[:1], balanced)
+
+	_, err = BalanceL4(nil, "api-3-default", s)
+	assert.EqualError(t, err, "empty destinations for route")
+}
+
+func TestVirtualService_Update_Integrated_Tcp(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+	}
+
+	shift := Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: map[string]string{"environment": "integration-tests"},
+		Traffic: Traffic{
+			PodSelector: map[string]string{"app": "api", "build": "3"},
+			Weight:      30,
+			Protocol:    ProtocolTCP,
+		},
+	}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = shift.Selector
+	v.Spec.Hosts = []string{"api-service"}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	// a tcp route is created when there is none
+	err := vs.Update(shift)
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(re.Spec.Tcp))
+	assert.Equal(t, uint32(5000), re.Spec.Tcp[0].Match[0].Port)
+	assert.Equal(t, 1, len(re.Spec.Tcp[0].Route))
+	assert.Equal(t, "api-testing-3-integration", re.Spec.Tcp[0].Route[0].Destination.Subset)
+
+	// a next build is balanced with the current one
+	vs.Build = 4
+	err = vs.Update(shift)
+	assert.NoError(t, err)
+
+	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 0, len(re.Spec.Http))
+	assert.Equal(t, 2, len(re.Spec.Tcp[0].Route))
+	assert.Equal(t, "api-testing-3-integration", re.Spec.Tcp[0].Route[0].Destination.Subset)
+	assert.Equal(t, int32(70), re.Spec.Tcp[0].Route[0].Weight)
+	assert.Equal(t, "api-testing-4-integration", re.Spec.Tcp[0].Route[1].Destination.Subset)
+	assert.Equal(t, int32(30), re.Spec.Tcp[0].Route[1].Weight)
+}
+
+func TestVirtualService_Update_Integrated_Tls(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+	}
+
+	shift := Shift{
+		Port:     443,
+		Hostname: "api-service",
+		Selector: map[string]string{"environment": "integration-tests"},
+		Traffic: Traffic{
+			PodSelector: map[string]string{"app": "api", "build": "3"},
+			Weight:      100,
+			Protocol:    ProtocolTLS,
+		},
+	}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = shift.Selector
+	v.Spec.Hosts = []string{"api.domain.io"}
+	v.Spec.Tls = []*v1alpha3.TLSRoute{
+		{
+			Match: []*v1alpha3.TLSMatchAttributes{{SniHosts: []string{"api.domain.io"}, Port: 443}},
+			Route: []*v1alpha3.RouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-2-integration"}},
+			},
+		},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	err := vs.Update(shift)
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(re.Spec.Tls))
+	assert.Equal(t, []string{"api.domain.io"}, re.Spec.Tls[0].Match[0].SniHosts)
+	assert.Equal(t, 1, len(re.Spec.Tls[0].Route))
+	assert.Equal(t, "api-testing-3-integration", re.Spec.Tls[0].Route[0].Destination.Subset)
+	assert.Equal(t, int32(100), re.Spec.Tls[0].Route[0].Weight)
+}
+
+func TestClear_Soft_Integrated_Tcp(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+	fakeKubeClient = kubeFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Namespace:  "integration",
+		Istio:      fakeIstioClient,
+		KubeClient: fakeKubeClient,
+	}
+
+	dr := DestinationRule{
+		TrackingId: "unit-testing-uuid",
+		Namespace:  "integration",
+		Istio:      fakeIstioClient,
+		KubeClient: fakeKubeClient,
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = selector
+	v.Spec.Tcp = []*v1alpha3.TCPRoute{
+		{
+			Match: []*v1alpha3.L4MatchAttributes{{Port: 5000}},
+			Route: []*v1alpha3.RouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-2-integration"}},
+			},
+		},
+		{
+			Match: []*v1alpha3.L4MatchAttributes{{Port: 6000}},
+			Route: []*v1alpha3.RouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-1-integration"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = vs.Namespace
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-testing-1-integration", Labels: map[string]string{"app": "api", "build": "1"}},
+		{Name: "api-testing-2-integration", Labels: map[string]string{"app": "api", "build": "2"}},
+	}
+
+	// the pod of a statefulSet, which has no deployment
+	pod := readyPod("api-2-0", vs.Namespace, map[string]string{"app": "api", "build": "2"}, true)
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Create(&d)
+	_, _ = fakeKubeClient.CoreV1().Pods(vs.Namespace).Create(pod)
+
+	err := vs.Clear(Shift{Selector: selector}, "soft")
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(re.Spec.Tcp))
+	assert.Equal(t, "api-testing-2-integration", re.Spec.Tcp[0].Route[0].Destination.Subset)
+
+	// subsets routed by tcp routes are kept
+	err = dr.Clear(Shift{Selector: selector}, "soft")
+	assert.NoError(t, err)
+
+	reDr, _ := fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Get(d.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(reDr.Spec.Subsets))
+	assert.Equal(t, "api-testing-2-integration", reDr.Spec.Subsets[0].Name)
+}
@@ -0,0 +1,151 @@
+package router
+
+import (
+	"fmt"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/pkg/errors"
+	"istio.io/api/networking/v1alpha3"
+)
+
+const (
+	// MasterRouteRegex is the legacy master-route, matching any uri by the regex '.+' (default)
+	MasterRouteRegex = "regex"
+	// MasterRouteCatchAll is a master-route without any match block
+	MasterRouteCatchAll = "catch-all"
+	// MasterRoutePrefix is a master-route matching the uri prefix '/'
+	MasterRoutePrefix = "prefix"
+	// MasterRouteNamed would be a master-route identified by its name, which is not available at the istio API in use
+	MasterRouteNamed = "named"
+)
+
+// MasterRoute defines which http route of a virtualService is the default one (master-route),
+// serving every request which is not matched by canary routes
+type MasterRoute interface {
+	// Matches returns whether a http route is the master-route
+	Matches(route *v1alpha3.HTTPRoute) bool
+	// Match returns the match block of a new master-route
+	Match() []*v1alpha3.HTTPMatchRequest
+	String() string
+}
+
+// RegexMasterRoute is the legacy master-route: 'Regex: .+'
+type RegexMasterRoute struct{}
+
+func (RegexMasterRoute) Matches(route *v1alpha3.HTTPRoute) bool {
+	for _, matchValue := range route.Match {
+		if matchValue.Uri.GetRegex() == ".+" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (RegexMasterRoute) Match() []*v1alpha3.HTTPMatchRequest {
+	return []*v1alpha3.HTTPMatchRequest{
+		{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+	}
+}
+
+func (RegexMasterRoute) String() string {
+	return "Regex: .+"
+}
+
+// CatchAllMasterRoute is a master-route without any match block
+type CatchAllMasterRoute struct{}
+
+func (CatchAllMasterRoute) Matches(route *v1alpha3.HTTPRoute) bool {
+	return len(route.Match) == 0
+}
+
+func (CatchAllMasterRoute) Match() []*v1alpha3.HTTPMatchRequest {
+	return nil
+}
+
+func (CatchAllMasterRoute) String() string {
+	return "catch-all"
+}
+
+// PrefixMasterRoute is a master-route matching any uri by the prefix '/'
+type PrefixMasterRoute struct{}
+
+func (PrefixMasterRoute) Matches(route *v1alpha3.HTTPRoute) bool {
+	for _, matchValue := range route.Match {
+		if matchValue.Uri.GetPrefix() == "/" && len(matchValue.Headers) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (PrefixMasterRoute) Match() []*v1alpha3.HTTPMatchRequest {
+	return []*v1alpha3.HTTPMatchRequest{
+		{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Prefix{Prefix: "/"}}},
+	}
+}
+
+func (PrefixMasterRoute) String() string {
+	return "Prefix: /"
+}
+
+// ParseMasterRoute returns the master-route definition of a given kind, empty meaning MasterRouteRegex
+func ParseMasterRoute(kind string) (MasterRoute, error) {
+	switch kind {
+	case "", MasterRouteRegex:
+		return RegexMasterRoute{}, nil
+	case MasterRouteCatchAll:
+		return CatchAllMasterRoute{}, nil
+	case MasterRoutePrefix:
+		return PrefixMasterRoute{}, nil
+	case MasterRouteNamed:
+		return nil, errors.New("named master-routes are not supported, HTTPRoute has no 'name' at the istio API in use")
+	}
+
+	return nil, errors.New(fmt.Sprintf("master-route '%s' must be '%s', '%s' or '%s'", kind, MasterRouteRegex, MasterRouteCatchAll, MasterRoutePrefix))
+}
+
+// DetectMasterRoute returns the master-route definition which matches the http routes of a virtualService, nil if none does
+func DetectMasterRoute(vs *v1alpha32.VirtualService) MasterRoute {
+	for _, master := range []MasterRoute{RegexMasterRoute{}, PrefixMasterRoute{}, CatchAllMasterRoute{}} {
+		for _, httpValue := range vs.Spec.Http {
+			if master.Matches(httpValue) {
+				return master
+			}
+		}
+	}
+
+	return nil
+}
+
+// masterMatches returns how many match blocks of a http route are a master-route one, so duplicated blocks are counted
+// as multiple master-routes. Routes without match blocks (catch-all) count as one
+func masterMatches(master MasterRoute, route *v1alpha3.HTTPRoute) int {
+	if len(route.Match) == 0 {
+		return 1
+	}
+
+	var counter int
+	for _, matchValue := range route.Match {
+		if master.Matches(&v1alpha3.HTTPRoute{Match: []*v1alpha3.HTTPMatchRequest{matchValue}}) {
+			counter += 1
+		}
+	}
+
+	return counter
+}
+
+// masterRoute returns the master-route definition of a router, RegexMasterRoute if none was given
+func (v *VirtualService) masterRoute() MasterRoute {
+	return orDefault(v.MasterRoute)
+}
+
+// orDefault returns RegexMasterRoute for nil master-route definitions
+func orDefault(master MasterRoute) MasterRoute {
+	if master == nil {
+		return RegexMasterRoute{}
+	}
+
+	return master
+}
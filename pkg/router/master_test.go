@@ -0,0 +1,154 @@
+package router
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseMasterRoute_Unit(t *testing.T) {
+	master, err := ParseMasterRoute("")
+	assert.NoError(t, err)
+	assert.Equal(t, RegexMasterRoute{}, master)
+
+	master, err = ParseMasterRoute(MasterRouteCatchAll)
+	assert.NoError(t, err)
+	assert.Equal(t, CatchAllMasterRoute{}, master)
+
+	master, err = ParseMasterRoute(MasterRoutePrefix)
+	assert.NoError(t, err)
+	assert.Equal(t, PrefixMasterRoute{}, master)
+
+	_, err = ParseMasterRoute(MasterRouteNamed)
+	assert.EqualError(t, err, "named master-routes are not supported, HTTPRoute has no 'name' at the istio API in use")
+
+	_, err = ParseMasterRoute("default")
+	assert.EqualError(t, err, "master-route 'default' must be 'regex', 'catch-all' or 'prefix'")
+}
+
+func TestMasterRoute_Unit_Matches(t *testing.T) {
+	regexRoute := &v1alpha3.HTTPRoute{Match: RegexMasterRoute{}.Match()}
+	prefixRoute := &v1alpha3.HTTPRoute{Match: PrefixMasterRoute{}.Match()}
+	catchAllRoute := &v1alpha3.HTTPRoute{}
+	headerRoute := &v1alpha3.HTTPRoute{
+		Match: []*v1alpha3.HTTPMatchRequest{
+			{
+				Uri:     &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Prefix{Prefix: "/"}},
+				Headers: map[string]*v1alpha3.StringMatch{"x-email": {MatchType: &v1alpha3.StringMatch_Exact{Exact: "somebody@domain.io"}}},
+			},
+		},
+	}
+
+	assert.True(t, RegexMasterRoute{}.Matches(regexRoute))
+	assert.False(t, RegexMasterRoute{}.Matches(catchAllRoute))
+
+	assert.True(t, PrefixMasterRoute{}.Matches(prefixRoute))
+	assert.False(t, PrefixMasterRoute{}.Matches(regexRoute))
+	assert.False(t, PrefixMasterRoute{}.Matches(headerRoute))
+
+	assert.True(t, CatchAllMasterRoute{}.Matches(catchAllRoute))
+	assert.False(t, CatchAllMasterRoute{}.Matches(prefixRoute))
+}
+
+func TestDetectMasterRoute_Unit(t *testing.T) {
+	vs := &v1alpha32.VirtualService{}
+	assert.Nil(t, DetectMasterRoute(vs))
+
+	vs.Spec.Http = []*v1alpha3.HTTPRoute{
+		{Match: []*v1alpha3.HTTPMatchRequest{{Method: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Exact{Exact: "GET"}}}}},
+		{Route: []*v1alpha3.HTTPRouteDestination{{Destination: &v1alpha3.Destination{Host: "api-service"}}}},
+	}
+	assert.Equal(t, CatchAllMasterRoute{}, DetectMasterRoute(vs))
+}
+
+func TestPercentage_Unit_CatchAllMasterRoute(t *testing.T) {
+	shift := Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Traffic:  Traffic{Weight: 10},
+	}
+
+	routeList := []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{{Method: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Exact{Exact: "GET"}}}},
+			Route: []*v1alpha3.HTTPRouteDestination{{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "canary-subset"}}},
+		},
+	}
+
+	// a missing master-route is created without any match block
+	routed, err := Percentage("unit-testing-uuid", "new-subset", routeList, shift, CatchAllMasterRoute{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(routed))
+	assert.Equal(t, 0, len(routed[1].Match))
+	assert.Equal(t, "new-subset", routed[1].Route[0].Destination.Subset)
+
+	routed, err = Percentage("unit-testing-uuid", "next-subset", routed, shift, CatchAllMasterRoute{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(routed))
+	assert.Equal(t, "new-subset", routed[1].Route[0].Destination.Subset)
+	assert.Equal(t, int32(90), routed[1].Route[0].Weight)
+	assert.Equal(t, "next-subset", routed[1].Route[1].Destination.Subset)
+	assert.Equal(t, int32(10), routed[1].Route[1].Weight)
+}
+
+func TestVirtualService_Update_Integrated_CatchAllMasterRoute(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId:  "unit-testing-uuid",
+		Name:        "api-testing",
+		Namespace:   "integration",
+		Build:       3,
+		Istio:       fakeIstioClient,
+		MasterRoute: CatchAllMasterRoute{},
+	}
+
+	shift := Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: map[string]string{"environment": "integration-tests"},
+		Traffic: Traffic{
+			PodSelector: map[string]string{"app": "api", "build": "3"},
+			Weight:      20,
+		},
+	}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = shift.Selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Headers: map[string]*v1alpha3.StringMatch{"x-email": {MatchType: &v1alpha3.StringMatch_Exact{Exact: "somebody@domain.io"}}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-3-integration"}},
+			},
+		},
+		{
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-2-integration"}},
+			},
+		},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	err := vs.Update(shift)
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	// request header's route of the weighted subset is removed & no regex master-route is created
+	assert.Equal(t, 1, len(re.Spec.Http))
+	assert.Equal(t, 0, len(re.Spec.Http[0].Match))
+	assert.Equal(t, 2, len(re.Spec.Http[0].Route))
+	assert.Equal(t, "api-testing-2-integration", re.Spec.Http[0].Route[0].Destination.Subset)
+	assert.Equal(t, int32(80), re.Spec.Http[0].Route[0].Weight)
+	assert.Equal(t, "api-testing-3-integration", re.Spec.Http[0].Route[1].Destination.Subset)
+	assert.Equal(t, int32(20), re.Spec.Http[0].Route[1].Weight)
+}
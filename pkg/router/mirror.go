@@ -0,0 +1,112 @@
+package router
+
+import (
+	"fmt"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	"istio.io/api/networking/v1alpha3"
+)
+
+// MirrorPercentAll is the only percent of requests which can be mirrored, as the istio API in use has no
+// 'mirrorPercent' (nor 'mirrorPercentage') field
+const MirrorPercentAll = 100
+
+// validateMirror checks that a mirror is requested on its own and with a supported percent
+func validateMirror(s Shift) error {
+	if !s.Traffic.Mirror {
+		if s.Traffic.MirrorPercent != 0 {
+			return errors.New("a 'mirror percent' can only be given to a mirrored route")
+		}
+		return nil
+	}
+
+	if isL4(s) {
+		return errors.New(fmt.Sprintf("'%s' routes can't be mirrored", s.Traffic.Protocol))
+	}
+
+	if s.Traffic.Weight != 0 || len(s.Traffic.Weights) > 0 || s.Traffic.HasMatch() {
+		return errors.New("a mirrored route can't be served with a 'weight', 'weights' or 'request headers'")
+	}
+
+	if s.Traffic.MirrorPercent != 0 && s.Traffic.MirrorPercent != MirrorPercentAll {
+		return errors.New(fmt.Sprintf("mirror percent '%d' is not supported, every request of the master-route is mirrored (%d)", s.Traffic.MirrorPercent, MirrorPercentAll))
+	}
+
+	return nil
+}
+
+// applyMirror mirrors the requests of a virtualService's master-route to the subset of the current build, whose
+// responses are discarded
+func (v *VirtualService) applyMirror(s Shift, vs *v1alpha32.VirtualService) error {
+	subsetName := SubsetName(v.Name, v.Build, v.Namespace)
+
+	for _, httpValue := range vs.Spec.Http {
+		if !v.masterRoute().Matches(httpValue) {
+			continue
+		}
+
+		if httpValue.Mirror.GetSubset() == subsetName {
+			logger.Info(fmt.Sprintf("Master-route of virtualService '%s' is already mirrored to subset '%s', skipping", vs.Name, subsetName), v.TrackingId)
+			return nil
+		}
+
+		logger.Info(fmt.Sprintf("Mirroring master-route of virtualService '%s' to subset '%s'...", vs.Name, subsetName), v.TrackingId)
+		httpValue.Mirror = &v1alpha3.Destination{
+			Host:   s.Hostname,
+			Subset: subsetName,
+			Port: &v1alpha3.PortSelector{
+				Port: &v1alpha3.PortSelector_Number{
+					Number: s.Port,
+				},
+			},
+		}
+
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("could not find the master-route '%s' of virtualService '%s' to be mirrored", v.masterRoute(), vs.Name))
+}
+
+// unmirrorRouted removes the mirror of a master-route which already routes requests to the mirrored subset, so the
+// subset doesn't receive the same requests twice once it's shifted to
+func (v *VirtualService) unmirrorRouted(httpRoutes []*v1alpha3.HTTPRoute) {
+	for _, httpValue := range httpRoutes {
+		if httpValue.Mirror == nil || !v.masterRoute().Matches(httpValue) {
+			continue
+		}
+
+		for _, routeValue := range httpValue.Route {
+			if routeValue.Destination.GetSubset() == httpValue.Mirror.GetSubset() {
+				logger.Info(fmt.Sprintf("Removing mirror to subset '%s', which is now routed by the master-route", httpValue.Mirror.GetSubset()), v.TrackingId)
+				httpValue.Mirror = nil
+				break
+			}
+		}
+	}
+}
+
+// clearMirror removes the mirror of a route when it's stale: always for 'hard' clears and, for 'soft' ones, when its
+// subset has no ready pods
+func (v *VirtualService) clearMirror(dss *IstioRouteList, httpValue *v1alpha3.HTTPRoute, mode string) error {
+	if httpValue.Mirror == nil {
+		return nil
+	}
+
+	if mode == "soft" {
+		active, err := v.activeSubset(dss, httpValue.Mirror)
+		if err != nil {
+			return err
+		}
+
+		if active {
+			return nil
+		}
+	}
+
+	logger.Info(fmt.Sprintf("removing mirror to subset '%s'", httpValue.Mirror.GetSubset()), v.TrackingId)
+	httpValue.Mirror = nil
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package router
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestVirtualService_Validate_Unit_Mirror(t *testing.T) {
+	v := &VirtualService{}
+
+	assert.NoError(t, v.Validate(Shift{Traffic: Traffic{Mirror: true}}))
+	assert.NoError(t, v.Validate(Shift{Traffic: Traffic{Mirror: true, MirrorPercent: 100}}))
+
+	failureCases := []struct {
+		traffic Traffic
+		err     string
+	}{
+		{Traffic{MirrorPercent: 100, Weight: 10}, "a 'mirror percent' can only be given to a mirrored route"},
+		{Traffic{Mirror: true, Protocol: ProtocolTCP}, "'tcp' routes can't be mirrored"},
+		{Traffic{Mirror: true, Weight: 10}, "a mirrored route can't be served with a 'weight', 'weights' or 'request headers'"},
+		{Traffic{Mirror: true, Weights: map[string]int32{"api-1-default": 100}}, "a mirrored route can't be served with a 'weight', 'weights' or 'request headers'"},
+		{Traffic{Mirror: true, RequestHeaders: map[string]string{"x-version": "2"}}, "a mirrored route can't be served with a 'weight', 'weights' or 'request headers'"},
+		{Traffic{Mirror: true, MirrorPercent: 10}, "mirror percent '10' is not supported, every request of the master-route is mirrored (100)"},
+	}
+
+	for _, tt := range failureCases {
+		err := v.Validate(Shift{Traffic: tt.traffic})
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func mirrorFixtures(t *testing.T) (*DestinationRule, *VirtualService, Shift) {
+	istioClient := istioFake.NewSimpleClientset()
+	kubeClient := kubeFake.NewSimpleClientset()
+	selector := map[string]string{"app": "api"}
+
+	v := v1alpha32.VirtualService{}
+	v.Name = "api-virtualservice"
+	v.Namespace = "default"
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}}},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api", Subset: "api-1-default"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{}
+	d.Name = "api-destinationrule"
+	d.Namespace = "default"
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-1-default", Labels: map[string]string{"app": "api", "build": "1"}},
+	}
+
+	_, err := istioClient.NetworkingV1alpha3().VirtualServices(v.Namespace).Create(&v)
+	assert.NoError(t, err)
+	_, err = istioClient.NetworkingV1alpha3().DestinationRules(d.Namespace).Create(&d)
+	assert.NoError(t, err)
+	_, err = kubeClient.CoreV1().Pods("default").Create(readyPod("api-1", "default", map[string]string{"app": "api", "build": "1"}, true))
+	assert.NoError(t, err)
+
+	drR := &DestinationRule{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeClient}
+	vsR := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeClient}
+
+	shift := Shift{
+		Port:     5000,
+		Hostname: "api",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector: map[string]string{"app": "api", "build": "2"},
+			Mirror:      true,
+		},
+	}
+
+	err = drR.Update(shift)
+	assert.NoError(t, err)
+	err = vsR.Update(shift)
+	assert.NoError(t, err)
+
+	return drR, vsR, shift
+}
+
+func TestVirtualService_Mirror_Integrated(t *testing.T) {
+	drR, vsR, shift := mirrorFixtures(t)
+
+	vs, _ := vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, 1, len(vs.Spec.Http))
+	assert.Equal(t, "api-1-default", vs.Spec.Http[0].Route[0].Destination.Subset)
+	assert.Equal(t, "api-2-default", vs.Spec.Http[0].Mirror.Subset)
+	assert.Equal(t, uint32(5000), vs.Spec.Http[0].Mirror.Port.GetNumber())
+
+	// the mirrored subset is kept by a soft clear while it has ready pods
+	_, _ = vsR.KubeClient.CoreV1().Pods("default").Create(readyPod("api-2", "default", map[string]string{"app": "api", "build": "2"}, true))
+	assert.NoError(t, vsR.Clear(Shift{Selector: shift.Selector}, "soft"))
+	assert.NoError(t, drR.Clear(Shift{Selector: shift.Selector}, "soft"))
+
+	vs, _ = vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, "api-2-default", vs.Spec.Http[0].Mirror.GetSubset())
+	dr, _ := drR.Istio.NetworkingV1alpha3().DestinationRules("default").Get("api-destinationrule", metav1.GetOptions{})
+	assert.Equal(t, 2, len(dr.Spec.Subsets))
+
+	// once the mirrored subset takes a weight of the master-route, it's no longer mirrored
+	shift.Traffic.Mirror = false
+	shift.Traffic.Weight = 10
+	assert.NoError(t, vsR.Update(shift))
+
+	vs, _ = vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Nil(t, vs.Spec.Http[0].Mirror)
+	assert.Equal(t, 2, len(vs.Spec.Http[0].Route))
+}
+
+func TestVirtualService_Clear_Integrated_Mirror(t *testing.T) {
+	// stale mirrors, whose subset has no ready pods, are removed by a soft clear
+	drR, vsR, shift := mirrorFixtures(t)
+	_, _ = vsR.KubeClient.CoreV1().Pods("default").Create(readyPod("api-2", "default", map[string]string{"app": "api", "build": "2"}, false))
+
+	assert.NoError(t, vsR.Clear(Shift{Selector: shift.Selector}, "soft"))
+	assert.NoError(t, drR.Clear(Shift{Selector: shift.Selector}, "soft"))
+
+	vs, _ := vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, 1, len(vs.Spec.Http))
+	assert.Nil(t, vs.Spec.Http[0].Mirror)
+	dr, _ := drR.Istio.NetworkingV1alpha3().DestinationRules("default").Get("api-destinationrule", metav1.GetOptions{})
+	assert.Equal(t, 1, len(dr.Spec.Subsets))
+
+	// every mirror is removed by a hard clear
+	_, vsR, shift = mirrorFixtures(t)
+	_, _ = vsR.KubeClient.CoreV1().Pods("default").Create(readyPod("api-2", "default", map[string]string{"app": "api", "build": "2"}, true))
+
+	assert.NoError(t, vsR.Clear(Shift{Selector: shift.Selector}, "hard"))
+
+	vs, _ = vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Nil(t, vs.Spec.Http[0].Mirror)
+}
+
+func TestVirtualService_Mirror_Integrated_WithoutMasterRoute(t *testing.T) {
+	_, vsR, shift := mirrorFixtures(t)
+	vsR.MasterRoute = PrefixMasterRoute{}
+
+	err := vsR.Update(shift)
+	assert.EqualError(t, err, "could not find the master-route 'Prefix: /' of virtualService 'api-virtualservice' to be mirrored")
+}
@@ -0,0 +1,223 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/pkg/errors"
+	"istio.io/api/networking/v1alpha3"
+)
+
+// RoutesAnnotation is the virtualService annotation which keeps the http routes created by istiops. HTTPRoute has no
+// 'name' at the istio API in use, so routes are identified by the fingerprint of their match block and their subset
+const RoutesAnnotation = "istiops.io/routes"
+
+// OwnedRoute is a http route created by istiops
+type OwnedRoute struct {
+	Name        string `json:"name"`
+	Subset      string `json:"subset"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// RouteName returns the deterministic name of the route created by istiops for a subset
+func RouteName(subset string) string {
+	return fmt.Sprintf("istiops-%s", subset)
+}
+
+// Fingerprint returns a stable identifier of a http route's match block
+func Fingerprint(route *v1alpha3.HTTPRoute) (string, error) {
+	value, err := json.Marshal(route.Match)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(value)
+
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// OwnedRoutes returns the http routes created by istiops which are recorded at a virtualService
+func OwnedRoutes(vs *v1alpha32.VirtualService) ([]OwnedRoute, error) {
+	var owned []OwnedRoute
+
+	value, ok := vs.Annotations[RoutesAnnotation]
+	if !ok || value == "" {
+		return owned, nil
+	}
+
+	err := json.Unmarshal([]byte(value), &owned)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not parse routes of virtualService '%s': %s", vs.Name, err))
+	}
+
+	return owned, nil
+}
+
+// OwnedRouteName returns the name of a virtualService's http route created by istiops, empty for any other route
+func OwnedRouteName(vs *v1alpha32.VirtualService, route *v1alpha3.HTTPRoute) (string, error) {
+	o, err := ownershipOf(vs)
+	if err != nil {
+		return "", err
+	}
+
+	return o.name(route), nil
+}
+
+// ownership tells which http routes of a virtualService were created by istiops
+type ownership struct {
+	routes []OwnedRoute
+	// legacy virtualServices have no recorded routes, so every one of them is considered as created by istiops
+	legacy bool
+	// adoptable returns the subsets of a legacy virtualService's route which istiops would have created it for, so
+	// the route is recorded along with the first one created by istiops
+	adoptable func(route *v1alpha3.HTTPRoute) []string
+}
+
+func ownershipOf(vs *v1alpha32.VirtualService) (*ownership, error) {
+	_, recorded := vs.Annotations[RoutesAnnotation]
+
+	routes, err := OwnedRoutes(vs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ownership{routes: routes, legacy: !recorded}, nil
+}
+
+// name returns the name of a http route created by istiops, empty for any other route
+func (o *ownership) name(route *v1alpha3.HTTPRoute) string {
+	fingerprint, err := Fingerprint(route)
+	if err != nil {
+		return ""
+	}
+
+	for _, owned := range o.routes {
+		if owned.Fingerprint == fingerprint && routesToSubset(route, owned.Subset) {
+			return owned.Name
+		}
+	}
+
+	return ""
+}
+
+// owns returns whether a http route may be changed or removed by istiops
+func (o *ownership) owns(route *v1alpha3.HTTPRoute) bool {
+	return o.legacy || o.name(route) != ""
+}
+
+// add records a http route created by istiops for a subset, replacing any previous one
+func (o *ownership) add(subset string, route *v1alpha3.HTTPRoute) error {
+	fingerprint, err := Fingerprint(route)
+	if err != nil {
+		return err
+	}
+
+	var routes []OwnedRoute
+	for _, owned := range o.routes {
+		if owned.Subset != subset {
+			routes = append(routes, owned)
+		}
+	}
+	o.routes = append(routes, OwnedRoute{Name: RouteName(subset), Subset: subset, Fingerprint: fingerprint})
+
+	return nil
+}
+
+// save records the routes created by istiops which are still present at a virtualService
+func (o *ownership) save(vs *v1alpha32.VirtualService) error {
+	// nothing was ever created by istiops, so the virtualService is kept as it is
+	if o.legacy && len(o.routes) == 0 {
+		return nil
+	}
+
+	// routes created by istiops before they were recorded would be taken as hand-written ones from now on
+	if o.legacy && o.adoptable != nil {
+		for _, httpValue := range vs.Spec.Http {
+			subsets := o.adoptable(httpValue)
+			if len(subsets) == 0 || o.name(httpValue) != "" {
+				continue
+			}
+
+			fingerprint, err := Fingerprint(httpValue)
+			if err != nil {
+				return err
+			}
+			o.routes = append(o.routes, OwnedRoute{Name: RouteName(subsets[0]), Subset: subsets[0], Fingerprint: fingerprint})
+		}
+	}
+
+	routes := []OwnedRoute{}
+	for _, owned := range o.routes {
+		for _, httpValue := range vs.Spec.Http {
+			fingerprint, err := Fingerprint(httpValue)
+			if err != nil {
+				return err
+			}
+
+			if owned.Fingerprint == fingerprint && routesToSubset(httpValue, owned.Subset) {
+				routes = append(routes, owned)
+				break
+			}
+		}
+	}
+
+	value, err := json.Marshal(routes)
+	if err != nil {
+		return err
+	}
+
+	if vs.Annotations == nil {
+		vs.Annotations = map[string]string{}
+	}
+	vs.Annotations[RoutesAnnotation] = string(value)
+
+	return nil
+}
+
+// routesToSubset returns whether any destination of a http route is the given subset
+func routesToSubset(route *v1alpha3.HTTPRoute, subset string) bool {
+	for _, routeValue := range route.Route {
+		if routeValue.Destination.GetSubset() == subset {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ownership returns which http routes of a virtualService were created by istiops, adopting the routes of legacy
+// virtualServices to subsets of the router's name ('<name>-<build>-<namespace>') besides the master-route
+func (v *VirtualService) ownership(vs *v1alpha32.VirtualService) (*ownership, error) {
+	o, err := ownershipOf(vs)
+	if err != nil {
+		return nil, err
+	}
+
+	subsetPattern := v.subsetPattern()
+
+	o.adoptable = func(route *v1alpha3.HTTPRoute) []string {
+		if v.masterRoute().Matches(route) {
+			return nil
+		}
+
+		var subsets []string
+		for _, routeValue := range route.Route {
+			if subsetPattern.MatchString(routeValue.Destination.GetSubset()) {
+				subsets = append(subsets, routeValue.Destination.GetSubset())
+			}
+		}
+
+		return subsets
+	}
+
+	return o, nil
+}
+
+// subsetPattern matches the subsets which istiops names for the router's destination, of any build
+func (v *VirtualService) subsetPattern() *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf("^%s-[0-9]+-%s$", regexp.QuoteMeta(destinationService(v.Name)), regexp.QuoteMeta(DestinationNamespace(v.Name, v.Namespace))))
+}
@@ -0,0 +1,330 @@
+package router
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	v1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFingerprint_Unit(t *testing.T) {
+	route := &v1alpha3.HTTPRoute{
+		Match: []*v1alpha3.HTTPMatchRequest{
+			{Headers: map[string]*v1alpha3.StringMatch{
+				"x-email":  {MatchType: &v1alpha3.StringMatch_Exact{Exact: "somebody@domain.io"}},
+				"x-client": {MatchType: &v1alpha3.StringMatch_Exact{Exact: "mobile"}},
+			}},
+		},
+	}
+
+	first, err := Fingerprint(route)
+	assert.NoError(t, err)
+	second, err := Fingerprint(route)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 16, len(first))
+
+	other, err := Fingerprint(&v1alpha3.HTTPRoute{Match: RegexMasterRoute{}.Match()})
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, other)
+}
+
+// ownedRoutesVirtualService returns a virtualService with a hand-written route to build 1 & a master-route to build 0,
+// whose routes are recorded (none created by istiops yet)
+func ownedRoutesVirtualService(namespace string, selector map[string]string) v1alpha32.VirtualService {
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = namespace
+	v.Labels = selector
+	v.Annotations = map[string]string{RoutesAnnotation: "[]"}
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Headers: map[string]*v1alpha3.StringMatch{"x-team": {MatchType: &v1alpha3.StringMatch_Exact{Exact: "qa"}}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-1-integration"}},
+			},
+		},
+		{
+			Match: RegexMasterRoute{}.Match(),
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-0-integration"}},
+			},
+		},
+	}
+
+	return v
+}
+
+func TestVirtualService_Update_Integrated_OwnedRoutes(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      1,
+		Istio:      fakeIstioClient,
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+	v := ownedRoutesVirtualService(vs.Namespace, selector)
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	headers := Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "1"},
+			RequestHeaders: map[string]string{"x-email": "somebody@domain.io"},
+			Exact:          true,
+		},
+	}
+
+	// the hand-written route of build 1 is not taken as the istiops one
+	err := vs.Update(headers)
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 3, len(re.Spec.Http))
+
+	owned, err := OwnedRoutes(re)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(owned))
+	assert.Equal(t, "istiops-api-testing-1-integration", owned[0].Name)
+
+	name, err := OwnedRouteName(re, re.Spec.Http[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "istiops-api-testing-1-integration", name)
+
+	name, err = OwnedRouteName(re, re.Spec.Http[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+
+	// weighting build 1 removes only the route created by istiops
+	vs.Build = 2
+	err = vs.Update(headers)
+	assert.NoError(t, err)
+
+	vs.Build = 1
+	err = vs.Update(Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: selector,
+		Traffic:  Traffic{PodSelector: map[string]string{"app": "api", "build": "1"}, Weight: 100},
+	})
+	assert.NoError(t, err)
+
+	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 3, len(re.Spec.Http))
+	assert.Equal(t, "api-testing-2-integration", re.Spec.Http[0].Route[0].Destination.Subset)
+	assert.Equal(t, "qa", re.Spec.Http[1].Match[0].Headers["x-team"].GetExact())
+	assert.Equal(t, ".+", re.Spec.Http[2].Match[0].Uri.GetRegex())
+
+	owned, err = OwnedRoutes(re)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(owned))
+	assert.Equal(t, "istiops-api-testing-2-integration", owned[0].Name)
+}
+
+func TestVirtualService_Update_Integrated_LegacyRoutes(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      1,
+		Istio:      fakeIstioClient,
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+	v := ownedRoutesVirtualService(vs.Namespace, selector)
+	v.Annotations = nil
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	// without recorded routes, every route is taken as created by istiops
+	err := vs.Update(Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "1"},
+			RequestHeaders: map[string]string{"x-email": "somebody@domain.io"},
+			Exact:          true,
+		},
+	})
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 2, len(re.Spec.Http))
+	_, recorded := re.Annotations[RoutesAnnotation]
+	assert.False(t, recorded)
+}
+
+func TestClear_Integrated_AdoptsLegacyRoutes(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+	fakeKubeClient = kubeFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      6,
+		Istio:      fakeIstioClient,
+		KubeClient: fakeKubeClient,
+	}
+
+	// a canary of build 5 created by istiops before routes were recorded
+	selector := map[string]string{"environment": "integration-tests"}
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Headers: map[string]*v1alpha3.StringMatch{"x-version": {MatchType: &v1alpha3.StringMatch_Exact{Exact: "5"}}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-5-integration"}},
+			},
+		},
+		{
+			Match: RegexMasterRoute{}.Match(),
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-4-integration"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = vs.Namespace
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-testing-4-integration", Labels: map[string]string{"app": "api", "build": "4"}},
+		{Name: "api-testing-5-integration", Labels: map[string]string{"app": "api", "build": "5"}},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Create(&d)
+
+	err := vs.Update(Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "6"},
+			RequestHeaders: map[string]string{"x-version": "6"},
+			Exact:          true,
+		},
+	})
+	assert.NoError(t, err)
+
+	// the route of build 5 is recorded along with the first route created by istiops
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	owned, err := OwnedRoutes(re)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(owned))
+	assert.Equal(t, "istiops-api-testing-6-integration", owned[0].Name)
+	assert.Equal(t, "istiops-api-testing-5-integration", owned[1].Name)
+
+	err = vs.Clear(Shift{Selector: selector}, "hard")
+	assert.NoError(t, err)
+
+	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(re.Spec.Http))
+	assert.Equal(t, ".+", re.Spec.Http[0].Match[0].Uri.GetRegex())
+	assert.Equal(t, "[]", re.Annotations[RoutesAnnotation])
+}
+
+func TestClear_Integrated_OwnedRoutes(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+	fakeKubeClient = kubeFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      2,
+		Istio:      fakeIstioClient,
+		KubeClient: fakeKubeClient,
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+	v := ownedRoutesVirtualService(vs.Namespace, selector)
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = vs.Namespace
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-testing-0-integration", Labels: map[string]string{"app": "api", "build": "0"}},
+		{Name: "api-testing-1-integration", Labels: map[string]string{"app": "api", "build": "1"}},
+		{Name: "api-testing-2-integration", Labels: map[string]string{"app": "api", "build": "2"}},
+	}
+
+	dep := v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api-0",
+			Namespace: vs.Namespace,
+			Labels:    map[string]string{"app": "api", "build": "0"},
+		},
+		Status: v1.DeploymentStatus{Replicas: 1, ReadyReplicas: 1},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Create(&d)
+	_, _ = fakeKubeClient.AppsV1().Deployments(vs.Namespace).Create(&dep)
+
+	err := vs.Update(Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "2"},
+			RequestHeaders: map[string]string{"x-email": "somebody@domain.io"},
+			Exact:          true,
+		},
+	})
+	assert.NoError(t, err)
+
+	// subsets of build 1 & 2 have no pods, but the hand-written route is kept anyway
+	err = vs.Clear(Shift{Selector: selector}, "soft")
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 2, len(re.Spec.Http))
+	assert.Equal(t, "qa", re.Spec.Http[0].Match[0].Headers["x-team"].GetExact())
+	assert.Equal(t, ".+", re.Spec.Http[1].Match[0].Uri.GetRegex())
+	assert.Equal(t, "[]", re.Annotations[RoutesAnnotation])
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Update(&v)
+	err = vs.Update(Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "2"},
+			RequestHeaders: map[string]string{"x-email": "somebody@domain.io"},
+			Exact:          true,
+		},
+	})
+	assert.NoError(t, err)
+
+	err = vs.Clear(Shift{Selector: selector}, "hard")
+	assert.NoError(t, err)
+
+	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 2, len(re.Spec.Http))
+	assert.Equal(t, "qa", re.Spec.Http[0].Match[0].Headers["x-team"].GetExact())
+	assert.Equal(t, ".+", re.Spec.Http[1].Match[0].Uri.GetRegex())
+}
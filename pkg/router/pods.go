@@ -0,0 +1,46 @@
+package router
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PodReady returns whether a pod is ready to receive traffic, pods being deleted are never ready
+func PodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// ReadyPods returns the ready pods and all the pods matched by labels at a namespace, regardless of the kind of
+// workload which manages them
+func ReadyPods(trackingId string, kubeClient KubeClientInterface, namespace string, labels map[string]string) (int32, int32, error) {
+	labelSelector, err := Stringify(trackingId, labels)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var ready int32
+	for i := range pods.Items {
+		if PodReady(&pods.Items[i]) {
+			ready++
+		}
+	}
+
+	return ready, int32(len(pods.Items)), nil
+}
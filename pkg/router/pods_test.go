@@ -0,0 +1,64 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func readyPod(name string, namespace string, labels map[string]string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+
+	return pod
+}
+
+func TestPodReady_Unit(t *testing.T) {
+	deleted := readyPod("api-2-c", "default", nil, true)
+	deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	cases := []struct {
+		pod   *corev1.Pod
+		ready bool
+	}{
+		{readyPod("api-2-a", "default", nil, true), true},
+		{readyPod("api-2-b", "default", nil, false), false},
+		{deleted, false},
+		{&corev1.Pod{}, false},
+	}
+
+	for _, tt := range cases {
+		assert.Equal(t, tt.ready, PodReady(tt.pod))
+	}
+}
+
+func TestReadyPods_Unit(t *testing.T) {
+	build2 := map[string]string{"app": "api", "build": "2"}
+	kubeClient := kubeFake.NewSimpleClientset(
+		// pods of any workload kind are counted, as a statefulSet's or bare ones
+		readyPod("api-2-0", "default", build2, true),
+		readyPod("api-2-1", "default", build2, false),
+		readyPod("api-2-x7k2p", "default", build2, true),
+		readyPod("api-3-0", "default", map[string]string{"app": "api", "build": "3"}, true),
+		readyPod("api-2-0", "payments", build2, true),
+	)
+
+	ready, total, err := ReadyPods("unit-testing-uuid", kubeClient, "default", build2)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), ready)
+	assert.Equal(t, int32(3), total)
+
+	ready, total, err = ReadyPods("unit-testing-uuid", kubeClient, "default", map[string]string{"build": "4"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), ready)
+	assert.Equal(t, int32(0), total)
+}
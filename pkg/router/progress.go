@@ -0,0 +1,166 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	"istio.io/api/networking/v1alpha3"
+)
+
+const (
+	// ProgressAnnotation is the virtualService annotation which keeps the state of a rollout
+	ProgressAnnotation = "istiops.io/rollout"
+
+	RolloutRunning   = "running"
+	RolloutCompleted = "completed"
+	RolloutAborted   = "aborted"
+	RolloutFailed    = "failed"
+)
+
+// Progress describes a step-based rollout recorded into the virtualServices being shifted
+type Progress struct {
+	Subset     string    `json:"subset"`
+	Baseline   string    `json:"baseline"`
+	Steps      []int32   `json:"steps"`
+	Step       int       `json:"step"`
+	Status     string    `json:"status"`
+	TrackingId string    `json:"trackingId"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Progress returns the rollout recorded for the current subset into virtualServices which matches a k8s labelSelector.
+// A nil Progress is returned when there is no rollout recorded at all.
+func (v *VirtualService) Progress(selector map[string]string) (*Progress, error) {
+	subsetName := SubsetName(v.Name, v.Build, v.Namespace)
+
+	vss, err := v.List(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vs := range vss.VList.Items {
+		value, ok := vs.Annotations[ProgressAnnotation]
+		if !ok {
+			continue
+		}
+
+		p := &Progress{}
+		err := json.Unmarshal([]byte(value), p)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("could not parse rollout progress of virtualService '%s': %s", vs.Name, err))
+		}
+
+		// a router without build is not tied to any subset (ex: when aborting)
+		if v.Build != 0 && p.Subset != subsetName {
+			logger.Debug(fmt.Sprintf("ignoring rollout recorded for subset '%s'", p.Subset), v.TrackingId)
+			continue
+		}
+
+		return p, nil
+	}
+
+	return nil, nil
+}
+
+// SaveProgress records the given rollout state into every virtualService which matches a k8s labelSelector
+func (v *VirtualService) SaveProgress(selector map[string]string, p Progress) error {
+	defer v.auditing(OperationRollout, nil)()
+
+	if p.Subset == "" {
+		p.Subset = SubsetName(v.Name, v.Build, v.Namespace)
+	}
+	p.TrackingId = v.TrackingId
+	p.UpdatedAt = time.Now().UTC()
+
+	vss, err := v.List(selector)
+	if err != nil {
+		return err
+	}
+
+	// baseline is the master-route subset which the rollout is shifting traffic from
+	if p.Baseline == "" {
+		for _, vs := range vss.VList.Items {
+			for _, httpValue := range vs.Spec.Http {
+				if !v.masterRoute().Matches(httpValue) {
+					continue
+				}
+
+				for _, routeValue := range httpValue.Route {
+					if routeValue.Destination.Subset != p.Subset {
+						p.Baseline = routeValue.Destination.Subset
+					}
+				}
+			}
+		}
+	}
+
+	value, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	for _, vs := range vss.VList.Items {
+		if vs.Annotations == nil {
+			vs.Annotations = map[string]string{}
+		}
+		vs.Annotations[ProgressAnnotation] = string(value)
+
+		logger.Info(fmt.Sprintf("Recording rollout '%s' at step '%d/%d' for virtualService '%s'", p.Status, p.Step+1, len(p.Steps), vs.Name), v.TrackingId)
+		err := UpdateVirtualService(v, &vs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Restore routes the whole traffic of master-route back to the given subset
+func (v *VirtualService) Restore(selector map[string]string, subset string) error {
+	defer v.auditing(OperationRollout, nil)()
+
+	if subset == "" {
+		return errors.New("empty subset to be restored")
+	}
+
+	vss, err := v.List(selector)
+	if err != nil {
+		return err
+	}
+
+	for _, vs := range vss.VList.Items {
+		previous := masterDestinations(&vs, v.masterRoute())
+		restored := false
+		for _, httpValue := range vs.Spec.Http {
+			if !v.masterRoute().Matches(httpValue) {
+				continue
+			}
+
+			for _, routeValue := range httpValue.Route {
+				if routeValue.Destination.Subset == subset {
+					routeValue.Weight = 0
+					httpValue.Route = []*v1alpha3.HTTPRouteDestination{routeValue}
+					restored = true
+					break
+				}
+			}
+		}
+
+		if !restored {
+			return errors.New(fmt.Sprintf("could not find subset '%s' at master-route of virtualService '%s'", subset, vs.Name))
+		}
+
+		v.recordHistory(selector, &vs, previous)
+
+		logger.Info(fmt.Sprintf("Restoring master-route of virtualService '%s' to subset '%s'", vs.Name, subset), v.TrackingId)
+		err = UpdateVirtualService(v, &vs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
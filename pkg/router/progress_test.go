@@ -0,0 +1,118 @@
+package router
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVirtualService_Progress_Integrated(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = selector
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	// nothing was recorded so far
+	p, err := vs.Progress(selector)
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	err = vs.SaveProgress(selector, Progress{
+		Steps:  []int32{10, 100},
+		Step:   0,
+		Status: RolloutRunning,
+	})
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Contains(t, re.Annotations[ProgressAnnotation], "api-testing-3-integration")
+
+	p, err = vs.Progress(selector)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-testing-3-integration", p.Subset)
+	assert.Equal(t, []int32{10, 100}, p.Steps)
+	assert.Equal(t, 0, p.Step)
+	assert.Equal(t, RolloutRunning, p.Status)
+	assert.Equal(t, "unit-testing-uuid", p.TrackingId)
+
+	// a rollout recorded for another build is ignored
+	vs.Build = 4
+	p, err = vs.Progress(selector)
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	// a router without build will get any recorded rollout
+	vs.Build = 0
+	p, err = vs.Progress(selector)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-testing-3-integration", p.Subset)
+}
+
+func TestVirtualService_Restore_Integrated(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-2-integration"}, Weight: 90},
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-3-integration"}, Weight: 10},
+			},
+		},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	// baseline is taken from the master-route
+	err := vs.SaveProgress(selector, Progress{Steps: []int32{10, 100}, Step: 0, Status: RolloutRunning})
+	assert.NoError(t, err)
+
+	p, err := vs.Progress(selector)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-testing-2-integration", p.Baseline)
+
+	err = vs.Restore(selector, p.Baseline)
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(re.Spec.Http[0].Route))
+	assert.Equal(t, "api-testing-2-integration", re.Spec.Http[0].Route[0].Destination.Subset)
+	assert.Equal(t, int32(0), re.Spec.Http[0].Route[0].Weight)
+
+	err = vs.Restore(selector, "non-existent-subset")
+	assert.EqualError(t, err, "could not find subset 'non-existent-subset' at master-route of virtualService 'integration-test-virtualservice'")
+}
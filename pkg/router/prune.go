@@ -0,0 +1,191 @@
+package router
+
+import (
+	"fmt"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	"istio.io/api/networking/v1alpha3"
+)
+
+// replaceDrifted replaces the canary route created by istiops for a subset when its match differs from the shift's
+// one, creating it when the subset is only routed by the master-route
+func (v *VirtualService) replaceDrifted(owned *ownership, subset string, s Shift, vs *v1alpha32.VirtualService) error {
+	desired, err := v.Create(s)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := Fingerprint(desired.MatchDestination)
+	if err != nil {
+		return err
+	}
+
+	for httpKey, httpValue := range vs.Spec.Http {
+		if v.masterRoute().Matches(httpValue) || !owned.owns(httpValue) || !routesToSubset(httpValue, subset) {
+			continue
+		}
+
+		current, err := Fingerprint(httpValue)
+		if err != nil {
+			return err
+		}
+
+		if current == fingerprint {
+			return nil
+		}
+
+		logger.Info(fmt.Sprintf("Replacing canary route of subset '%s', whose match drifted from the shift", subset), v.TrackingId)
+		vs.Spec.Http[httpKey] = desired.MatchDestination
+
+		return owned.add(subset, desired.MatchDestination)
+	}
+
+	// canary routes precede the master-route due to istio's rules precedence
+	vs.Spec.Http = append([]*v1alpha3.HTTPRoute{desired.MatchDestination}, vs.Spec.Http...)
+
+	return owned.add(subset, desired.MatchDestination)
+}
+
+// Prune removes the http routes created by istiops for builds of the router's destination which aren't kept, and
+// takes drained subsets out of the master-route giving their weight to its heaviest remaining subset
+func (v *VirtualService) Prune(s Shift, keep []string, drain []string) error {
+	defer v.auditing(OperationClear, &s)()
+
+	vss, err := v.List(s.Selector)
+	if err != nil {
+		return err
+	}
+
+	for _, vs := range vss.VList.Items {
+		vs := vs
+		err := onConflict(v.TrackingId, v.Retry, "virtualService", vs.Name, func(attempt int) error {
+			if attempt > 0 {
+				fresh, err := v.get(vs.Name)
+				if err != nil {
+					return err
+				}
+				vs = *fresh
+			}
+
+			err := v.applyPrune(s, &vs, keep, drain)
+			if err != nil {
+				return err
+			}
+
+			return UpdateVirtualService(v, &vs)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyPrune changes the routes of a virtualService object, see Prune
+func (v *VirtualService) applyPrune(s Shift, vs *v1alpha32.VirtualService, keep []string, drain []string) error {
+	owned, err := v.ownership(vs)
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{}
+	for _, subset := range keep {
+		kept[subset] = true
+	}
+
+	drained := map[string]bool{}
+	for _, subset := range drain {
+		drained[subset] = true
+	}
+
+	// subsets of other destinations routed by the same virtualService are never pruned
+	pattern := v.subsetPattern()
+	prunable := func(subset string) bool {
+		return pattern.MatchString(subset) && !kept[subset]
+	}
+
+	previous := masterDestinations(vs, v.masterRoute())
+
+	var routes []*v1alpha3.HTTPRoute
+	for _, httpValue := range vs.Spec.Http {
+		if v.masterRoute().Matches(httpValue) {
+			err := v.drainMaster(vs, httpValue, drained)
+			if err != nil {
+				return err
+			}
+
+			if httpValue.Mirror != nil && prunable(httpValue.Mirror.GetSubset()) {
+				logger.Info(fmt.Sprintf("Removing mirror to subset '%s', which is not in the spec", httpValue.Mirror.GetSubset()), v.TrackingId)
+				httpValue.Mirror = nil
+			}
+
+			routes = append(routes, httpValue)
+			continue
+		}
+
+		if !owned.owns(httpValue) || len(httpValue.Route) == 0 {
+			routes = append(routes, httpValue)
+			continue
+		}
+
+		pruned := true
+		for _, routeValue := range httpValue.Route {
+			if !prunable(routeValue.Destination.GetSubset()) {
+				pruned = false
+			}
+		}
+
+		if !pruned {
+			routes = append(routes, httpValue)
+			continue
+		}
+
+		logger.Info(fmt.Sprintf("Removing route to subset '%s', which is not in the spec", httpValue.Route[0].Destination.GetSubset()), v.TrackingId)
+	}
+	vs.Spec.Http = routes
+
+	v.recordHistory(s.Selector, vs, previous)
+
+	return owned.save(vs)
+}
+
+// drainMaster takes drained subsets out of a master-route, giving their weight to its heaviest remaining subset
+func (v *VirtualService) drainMaster(vs *v1alpha32.VirtualService, httpValue *v1alpha3.HTTPRoute, drained map[string]bool) error {
+	var remaining []*v1alpha3.HTTPRouteDestination
+	var drainedWeight int32
+	for _, routeValue := range httpValue.Route {
+		if drained[routeValue.Destination.GetSubset()] {
+			logger.Info(fmt.Sprintf("Draining subset '%s' out of the master-route of virtualService '%s'", routeValue.Destination.GetSubset(), vs.Name), v.TrackingId)
+			drainedWeight += routeValue.Weight
+			continue
+		}
+
+		remaining = append(remaining, routeValue)
+	}
+
+	if len(remaining) == len(httpValue.Route) {
+		return nil
+	}
+
+	if len(remaining) == 0 {
+		return errors.New(fmt.Sprintf("refusing to drain every subset of the master-route of virtualService '%s'", vs.Name))
+	}
+
+	if len(remaining) == 1 {
+		remaining[0].Weight = 100
+	} else {
+		heaviest := remaining[0]
+		for _, routeValue := range remaining {
+			if routeValue.Weight > heaviest.Weight {
+				heaviest = routeValue
+			}
+		}
+		heaviest.Weight += drainedWeight
+	}
+	httpValue.Route = remaining
+
+	return nil
+}
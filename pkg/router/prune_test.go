@@ -0,0 +1,140 @@
+package router
+
+import (
+	"fmt"
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pruneFixtures returns a virtualService router whose master-route is balanced between builds 1 and 3, with canary
+// routes of builds 2 and 4 and a route of another destination
+func pruneFixtures(t *testing.T) (*VirtualService, Shift) {
+	istioClient := istioFake.NewSimpleClientset()
+	selector := map[string]string{"app": "api"}
+
+	v := v1alpha32.VirtualService{}
+	v.Name = "api-virtualservice"
+	v.Namespace = "default"
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Prefix{Prefix: "/admin"}}}},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "admin", Subset: "admin-1-default"}},
+			},
+		},
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}}},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api", Subset: "api-1-default"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{}
+	d.Name = "api-destinationrule"
+	d.Namespace = "default"
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-1-default", Labels: map[string]string{"app": "api", "build": "1"}},
+	}
+
+	_, err := istioClient.NetworkingV1alpha3().VirtualServices(v.Namespace).Create(&v)
+	assert.NoError(t, err)
+	_, err = istioClient.NetworkingV1alpha3().DestinationRules(d.Namespace).Create(&d)
+	assert.NoError(t, err)
+
+	shift := Shift{Port: 5000, Hostname: "api", Selector: selector}
+	// a weight is only shifted to a build which already has a canary route
+	shifts := []struct {
+		build   uint32
+		traffic Traffic
+	}{
+		{2, Traffic{RequestHeaders: map[string]string{"x-version": "2"}, Exact: true}},
+		{3, Traffic{RequestHeaders: map[string]string{"x-version": "3"}, Exact: true}},
+		{3, Traffic{Weight: 20}},
+		{4, Traffic{RequestHeaders: map[string]string{"x-version": "4"}, Exact: true}},
+	}
+
+	for _, tt := range shifts {
+		shift.Traffic = tt.traffic
+		shift.Traffic.PodSelector = map[string]string{"app": "api", "build": fmt.Sprint(tt.build)}
+
+		drR := &DestinationRule{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: tt.build, Istio: istioClient}
+		vsR := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: tt.build, Istio: istioClient}
+		assert.NoError(t, drR.Update(shift))
+		assert.NoError(t, vsR.Update(shift))
+	}
+
+	return &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Istio: istioClient}, Shift{Selector: selector}
+}
+
+func TestVirtualService_Prune_Integrated(t *testing.T) {
+	vsR, shift := pruneFixtures(t)
+
+	vs, _ := vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, 4, len(vs.Spec.Http))
+
+	// build 2 is kept, build 3 is drained and build 4 is no longer desired
+	err := vsR.Prune(shift, []string{"api-2-default"}, []string{"api-3-default"})
+	assert.NoError(t, err)
+
+	vs, _ = vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, 3, len(vs.Spec.Http))
+	assert.Equal(t, "api-2-default", vs.Spec.Http[0].Route[0].Destination.Subset)
+	// routes of other destinations are kept
+	assert.Equal(t, "/admin", vs.Spec.Http[1].Match[0].Uri.GetPrefix())
+
+	master := vs.Spec.Http[2]
+	assert.Equal(t, 1, len(master.Route))
+	assert.Equal(t, "api-1-default", master.Route[0].Destination.Subset)
+	assert.Equal(t, int32(100), master.Route[0].Weight)
+
+	// the drained master-route is kept at history
+	revisions, err := History(vs)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-3-default", revisions[len(revisions)-1].Destinations[1].Subset)
+
+	// the master-route can't be left without any subset
+	err = vsR.Prune(shift, nil, []string{"api-1-default"})
+	assert.EqualError(t, err, "refusing to drain every subset of the master-route of virtualService 'api-virtualservice'")
+}
+
+func TestVirtualService_Update_Integrated_Reconcile(t *testing.T) {
+	vsR, shift := pruneFixtures(t)
+	vsR.Build = 2
+
+	shift.Port = 5000
+	shift.Hostname = "api"
+	shift.Traffic = Traffic{PodSelector: map[string]string{"app": "api", "build": "2"}, RequestHeaders: map[string]string{"x-version": "two"}, Exact: true}
+
+	// drifted canary routes are kept unless they're reconciled
+	assert.NoError(t, vsR.Update(shift))
+	vs, _ := vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, "2", vs.Spec.Http[1].Match[0].Headers["x-version"].GetExact())
+
+	vsR.Reconcile = true
+	assert.NoError(t, vsR.Update(shift))
+	vs, _ = vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, 4, len(vs.Spec.Http))
+	assert.Equal(t, "api-2-default", vs.Spec.Http[1].Route[0].Destination.Subset)
+	assert.Equal(t, "two", vs.Spec.Http[1].Match[0].Headers["x-version"].GetExact())
+
+	// the replaced route is still owned by istiops
+	name, err := OwnedRouteName(vs, vs.Spec.Http[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "istiops-api-2-default", name)
+
+	// a subset which is only routed by the master-route gets its canary route
+	vsR.Build = 3
+	shift.Traffic = Traffic{PodSelector: map[string]string{"app": "api", "build": "3"}, RequestHeaders: map[string]string{"x-version": "3"}, Exact: true}
+	assert.NoError(t, vsR.Update(shift))
+	vs, _ = vsR.Istio.NetworkingV1alpha3().VirtualServices("default").Get("api-virtualservice", metav1.GetOptions{})
+	assert.Equal(t, 5, len(vs.Spec.Http))
+	assert.Equal(t, "api-3-default", vs.Spec.Http[0].Route[0].Destination.Subset)
+}
@@ -0,0 +1,119 @@
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultReadinessInterval is the pause between readiness checks while waiting for replicas to become ready
+const DefaultReadinessInterval = 5 * time.Second
+
+// Readiness gates shifts on the ready replicas of the workloads matched by the pod-selector
+type Readiness struct {
+	// MinReady is the minimum of ready replicas, not checked when zero
+	MinReady int32
+	// Rollout waits for the deployments to be completely rolled out, as 'kubectl rollout status'
+	Rollout bool
+	// Timeout is how long to wait for replicas to become ready (checked only once when zero) and, apart from it,
+	// for deployments to roll out (DefaultRolloutTimeout when zero)
+	Timeout time.Duration
+	// Interval between checks while waiting, DefaultReadinessInterval is used when empty
+	Interval time.Duration
+}
+
+// Enabled returns whether shifts must be gated
+func (r Readiness) Enabled() bool {
+	return r.MinReady > 0 || r.Rollout
+}
+
+// ReadyReplicas returns the ready replicas of the deployments matched by a pod-selector at a namespace, along with
+// their names
+func ReadyReplicas(trackingId string, kubeClient KubeClientInterface, namespace string, podSelector map[string]string) (int32, []string, error) {
+	labelSelector, err := Stringify(trackingId, podSelector)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	deps, err := kubeClient.AppsV1().Deployments(namespace).List(metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var ready int32
+	var names []string
+	for _, dep := range deps.Items {
+		ready += dep.Status.ReadyReplicas
+		names = append(names, dep.Name)
+	}
+	sort.Strings(names)
+
+	return ready, names, nil
+}
+
+// AwaitReady waits for the workloads of a shift's pod-selector to roll out and checks that they have at least the
+// minimum of ready replicas, waiting for them up to the readiness timeout
+func (v *VirtualService) AwaitReady(s Shift, r Readiness) error {
+	if r.Rollout {
+		err := v.awaitRollout(s, r.Timeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.MinReady == 0 {
+		return nil
+	}
+
+	interval := r.Interval
+	if interval == 0 {
+		interval = DefaultReadinessInterval
+	}
+
+	namespace := DestinationNamespace(v.Name, v.Namespace)
+	podSelector, err := Stringify(v.TrackingId, s.Traffic.PodSelector)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(r.Timeout)
+	for {
+		ready, names, err := ReadyReplicas(v.TrackingId, v.KubeClient, namespace, s.Traffic.PodSelector)
+		if err != nil {
+			return err
+		}
+
+		if len(names) > 0 && ready >= r.MinReady {
+			logger.Info(fmt.Sprintf("Deployments '%s' have %d ready replicas", strings.Join(names, ","), ready), v.TrackingId)
+			return nil
+		}
+
+		var reason string
+		if len(names) == 0 {
+			reason = fmt.Sprintf("no deployments matched pod-selector '%s' at namespace '%s'", podSelector, namespace)
+		} else {
+			reason = fmt.Sprintf("deployments '%s' have %d ready replicas, at least %d are required", strings.Join(names, ","), ready, r.MinReady)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if r.Timeout > 0 {
+				return errors.New(fmt.Sprintf("%s (waited %s)", reason, r.Timeout))
+			}
+			return errors.New(reason)
+		}
+
+		logger.Info(fmt.Sprintf("Waiting for ready replicas: %s", reason), v.TrackingId)
+		if remaining < interval {
+			interval = remaining
+		}
+		time.Sleep(interval)
+	}
+}
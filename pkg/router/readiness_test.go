@@ -0,0 +1,72 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func readinessDeployment(name string, build string, ready int32) *appsv1.Deployment {
+	dep := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "api", "build": build}}}
+	dep.Status.Replicas = 3
+	dep.Status.ReadyReplicas = ready
+
+	return dep
+}
+
+func TestReadyReplicas_Unit(t *testing.T) {
+	kubeClient := kubeFake.NewSimpleClientset(
+		readinessDeployment("api-2-blue", "2", 1),
+		readinessDeployment("api-2-green", "2", 2),
+		readinessDeployment("api-3", "3", 3),
+	)
+
+	ready, names, err := ReadyReplicas("unit-testing-uuid", kubeClient, "default", map[string]string{"app": "api", "build": "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), ready)
+	assert.Equal(t, []string{"api-2-blue", "api-2-green"}, names)
+}
+
+func TestVirtualService_AwaitReady_Unit(t *testing.T) {
+	kubeClient := kubeFake.NewSimpleClientset(readinessDeployment("api-2", "2", 1))
+	v := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", KubeClient: kubeClient}
+	shift := Shift{Traffic: Traffic{PodSelector: map[string]string{"app": "api", "build": "2"}}}
+
+	// disabled gate
+	assert.NoError(t, v.AwaitReady(shift, Readiness{}))
+
+	assert.NoError(t, v.AwaitReady(shift, Readiness{MinReady: 1}))
+
+	failureCases := []struct {
+		readiness   Readiness
+		podSelector map[string]string
+		err         string
+	}{
+		{Readiness{MinReady: 2}, map[string]string{"app": "api", "build": "2"}, "deployments 'api-2' have 1 ready replicas, at least 2 are required"},
+		{Readiness{MinReady: 1}, map[string]string{"build": "3"}, "no deployments matched pod-selector 'build=3' at namespace 'default'"},
+		{Readiness{MinReady: 2, Timeout: 30 * time.Millisecond, Interval: 10 * time.Millisecond}, map[string]string{"app": "api", "build": "2"}, "deployments 'api-2' have 1 ready replicas, at least 2 are required (waited 30ms)"},
+	}
+
+	for _, tt := range failureCases {
+		err := v.AwaitReady(Shift{Traffic: Traffic{PodSelector: tt.podSelector}}, tt.readiness)
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestVirtualService_AwaitReady_Unit_Waiting(t *testing.T) {
+	kubeClient := kubeFake.NewSimpleClientset(readinessDeployment("api-2", "2", 0))
+	v := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", KubeClient: kubeClient}
+	shift := Shift{Traffic: Traffic{PodSelector: map[string]string{"app": "api", "build": "2"}}}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_, _ = kubeClient.AppsV1().Deployments("default").UpdateStatus(readinessDeployment("api-2", "2", 3))
+	}()
+
+	err := v.AwaitReady(shift, Readiness{MinReady: 3, Timeout: 2 * time.Second, Interval: 10 * time.Millisecond})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,67 @@
+package router
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// Retry defines how updates which conflict with a concurrent change of the same resource are retried
+type Retry struct {
+	// Attempts is the maximum of times an update is submitted, zero means DefaultRetry's attempts
+	Attempts int
+	// Backoff is the pause before the first retry, being doubled for each next one
+	Backoff time.Duration
+}
+
+// DefaultRetry is used by routers which do not define any Retry
+var DefaultRetry = Retry{
+	Attempts: 5,
+	Backoff:  100 * time.Millisecond,
+}
+
+func (r Retry) backoff() wait.Backoff {
+	if r.Attempts <= 0 {
+		r.Attempts = DefaultRetry.Attempts
+	}
+
+	if r.Backoff <= 0 {
+		r.Backoff = DefaultRetry.Backoff
+	}
+
+	return wait.Backoff{
+		Steps:    r.Attempts,
+		Duration: r.Backoff,
+		Factor:   2,
+		Jitter:   0.1,
+	}
+}
+
+// onConflict runs fn until it succeeds, fails with a non-conflict error or runs out of attempts.
+// fn receives the current attempt (starting at 0) and must re-read the resource on every retry
+func onConflict(trackingId string, r Retry, kind string, name string, fn func(attempt int) error) error {
+	backoff := r.backoff()
+
+	attempt := 0
+	err := retry.RetryOnConflict(backoff, func() error {
+		err := fn(attempt)
+		attempt++
+
+		if apierrors.IsConflict(err) && attempt < backoff.Steps {
+			logger.Warn(fmt.Sprintf("%s '%s' was changed in the meantime, retrying update (%d/%d)", kind, name, attempt+1, backoff.Steps), trackingId)
+		}
+
+		return err
+	})
+
+	if apierrors.IsConflict(err) {
+		return errors.New(fmt.Sprintf("could not update %s '%s' after %d attempts: %s", kind, name, attempt, err))
+	}
+
+	return err
+}
@@ -0,0 +1,149 @@
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// conflicting makes the first 'times' updates of a resource fail with a conflict error
+func conflicting(resource string, times int) k8stesting.ReactionFunc {
+	updates := 0
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		if updates > times {
+			return false, nil, nil
+		}
+
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Group: "networking.istio.io", Resource: resource}, "integration-test", errors.New("the object has been modified"))
+	}
+}
+
+func TestOnConflict_Unit(t *testing.T) {
+	attempts := 0
+	err := onConflict("unit-testing-uuid", Retry{Attempts: 3, Backoff: time.Millisecond}, "virtualService", "api", func(attempt int) error {
+		assert.Equal(t, attempts, attempt)
+		attempts++
+		return apierrors.NewConflict(schema.GroupResource{Resource: "virtualservices"}, "api", errors.New("the object has been modified"))
+	})
+
+	assert.Equal(t, 3, attempts)
+	assert.EqualError(t, err, "could not update virtualService 'api' after 3 attempts: Operation cannot be fulfilled on virtualservices \"api\": the object has been modified")
+}
+
+func TestOnConflict_Unit_NonConflictError(t *testing.T) {
+	attempts := 0
+	err := onConflict("unit-testing-uuid", Retry{Attempts: 3, Backoff: time.Millisecond}, "virtualService", "api", func(attempt int) error {
+		attempts++
+		return errors.New("forbidden")
+	})
+
+	assert.Equal(t, 1, attempts)
+	assert.EqualError(t, err, "forbidden")
+}
+
+func TestVirtualService_Update_Integrated_Conflict(t *testing.T) {
+	fakeClient := istioFake.NewSimpleClientset()
+	fakeClient.PrependReactor("update", "virtualservices", conflicting("virtualservices", 2))
+	fakeIstioClient = fakeClient
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+		Retry:      Retry{Attempts: 3, Backoff: time.Millisecond},
+	}
+
+	shift := Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: map[string]string{"environment": "integration-tests"},
+		Traffic: Traffic{
+			PodSelector: map[string]string{"app": "api", "build": "3"},
+			Weight:      20,
+		},
+	}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = shift.Selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Headers: map[string]*v1alpha3.StringMatch{"x-email": {MatchType: &v1alpha3.StringMatch_Exact{Exact: "somebody@domain.io"}}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-3-integration"}},
+			},
+		},
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-2-integration"}, Weight: 100},
+			},
+		},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	err := vs.Update(shift)
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(re.Spec.Http))
+	assert.Equal(t, 2, len(re.Spec.Http[0].Route))
+	assert.Equal(t, "api-testing-2-integration", re.Spec.Http[0].Route[0].Destination.Subset)
+	assert.Equal(t, int32(80), re.Spec.Http[0].Route[0].Weight)
+	assert.Equal(t, "api-testing-3-integration", re.Spec.Http[0].Route[1].Destination.Subset)
+	assert.Equal(t, int32(20), re.Spec.Http[0].Route[1].Weight)
+}
+
+func TestDestinationRule_Update_Integrated_Conflict(t *testing.T) {
+	fakeClient := istioFake.NewSimpleClientset()
+	fakeClient.PrependReactor("update", "destinationrules", conflicting("destinationrules", 5))
+	fakeIstioClient = fakeClient
+
+	dr := DestinationRule{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+		Retry:      Retry{Attempts: 2, Backoff: time.Millisecond},
+	}
+
+	shift := Shift{
+		Selector: map[string]string{"environment": "integration-tests"},
+		Traffic: Traffic{
+			PodSelector: map[string]string{"app": "api", "build": "3"},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = dr.Namespace
+	d.Labels = shift.Selector
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(dr.Namespace).Create(&d)
+
+	err := dr.Update(shift)
+	assert.EqualError(t, err, "could not update destinationRule 'integration-test-destinationrule' after 2 attempts: Operation cannot be fulfilled on destinationrules.networking.istio.io \"integration-test\": the object has been modified")
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().DestinationRules(dr.Namespace).Get(d.Name, metav1.GetOptions{})
+	assert.Equal(t, 0, len(re.Spec.Subsets))
+}
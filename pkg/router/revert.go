@@ -0,0 +1,111 @@
+package router
+
+import (
+	"fmt"
+
+	"github.com/pismo/istiops/pkg/logger"
+)
+
+// Revert puts destinationRules back to the state of a previous snapshot, returning which ones were actually changed
+func (d *DestinationRule) Revert(snapshot *IstioRouteList) ([]string, error) {
+	defer d.auditing(OperationRevert, nil)()
+
+	var reverted []string
+	if snapshot == nil || snapshot.DList == nil {
+		return reverted, nil
+	}
+
+	for _, previous := range snapshot.DList.Items {
+		previous := previous
+		changed := false
+		err := onConflict(d.TrackingId, d.Retry, "destinationRule", previous.Name, func(attempt int) error {
+			current, err := d.get(previous.Name)
+			if err != nil {
+				return err
+			}
+
+			currentState, err := Yamlify("DestinationRule", current.ObjectMeta, &current.Spec)
+			if err != nil {
+				return err
+			}
+
+			previousState, err := Yamlify("DestinationRule", previous.ObjectMeta, &previous.Spec)
+			if err != nil {
+				return err
+			}
+
+			changed = currentState != previousState
+			if !changed {
+				return nil
+			}
+
+			logger.Info(fmt.Sprintf("Reverting destinationRule '%s' to its previous state", previous.Name), d.TrackingId)
+			current.Labels = previous.Labels
+			current.Annotations = previous.Annotations
+			current.Spec = previous.Spec
+
+			return UpdateDestinationRule(d, current)
+		})
+		if err != nil {
+			return reverted, err
+		}
+
+		if changed {
+			reverted = append(reverted, fmt.Sprintf("destinationRule '%s'", previous.Name))
+		}
+	}
+
+	return reverted, nil
+}
+
+// Revert puts virtualServices back to the state of a previous snapshot, returning which ones were actually changed
+func (v *VirtualService) Revert(snapshot *IstioRouteList) ([]string, error) {
+	defer v.auditing(OperationRevert, nil)()
+
+	var reverted []string
+	if snapshot == nil || snapshot.VList == nil {
+		return reverted, nil
+	}
+
+	for _, previous := range snapshot.VList.Items {
+		previous := previous
+		changed := false
+		err := onConflict(v.TrackingId, v.Retry, "virtualService", previous.Name, func(attempt int) error {
+			current, err := v.get(previous.Name)
+			if err != nil {
+				return err
+			}
+
+			currentState, err := Yamlify("VirtualService", current.ObjectMeta, &current.Spec)
+			if err != nil {
+				return err
+			}
+
+			previousState, err := Yamlify("VirtualService", previous.ObjectMeta, &previous.Spec)
+			if err != nil {
+				return err
+			}
+
+			changed = currentState != previousState
+			if !changed {
+				return nil
+			}
+
+			logger.Info(fmt.Sprintf("Reverting virtualService '%s' to its previous state", previous.Name), v.TrackingId)
+			current.Labels = previous.Labels
+			current.Annotations = previous.Annotations
+			current.Spec = previous.Spec
+
+			return UpdateVirtualService(v, current)
+		})
+		if err != nil {
+			return reverted, err
+		}
+
+		if changed {
+			reverted = append(reverted, fmt.Sprintf("virtualService '%s'", previous.Name))
+		}
+	}
+
+	return reverted, nil
+}
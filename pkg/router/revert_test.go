@@ -0,0 +1,82 @@
+package router
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRevert_Integrated(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	dr := DestinationRule{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+	}
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = dr.Namespace
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-testing-2-integration", Labels: map[string]string{"build": "2"}},
+	}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-2-integration"}},
+			},
+		},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(dr.Namespace).Create(&d)
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+
+	drs, err := dr.List(selector)
+	assert.NoError(t, err)
+	vss, err := vs.List(selector)
+	assert.NoError(t, err)
+
+	snapshot := &IstioRouteList{DList: drs.DList, VList: vss.VList}
+
+	// only the destinationRule is changed after the snapshot
+	err = dr.Update(Shift{Selector: selector, Traffic: Traffic{PodSelector: map[string]string{"build": "3"}}})
+	assert.NoError(t, err)
+
+	reverted, err := vs.Revert(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(reverted))
+
+	reverted, err = dr.Revert(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"destinationRule 'integration-test-destinationrule'"}, reverted)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().DestinationRules(dr.Namespace).Get(d.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(re.Spec.Subsets))
+	assert.Equal(t, "api-testing-2-integration", re.Spec.Subsets[0].Name)
+}
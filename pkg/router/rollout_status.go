@@ -0,0 +1,144 @@
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// RolloutStatus returns whether a deployment has completely rolled out along with a description of its progress,
+// as 'kubectl rollout status' does
+func RolloutStatus(dep *appsv1.Deployment) (bool, string, error) {
+	if dep.Generation > dep.Status.ObservedGeneration {
+		return false, fmt.Sprintf("deployment '%s': waiting for its spec update to be observed", dep.Name), nil
+	}
+
+	for _, condition := range dep.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return false, "", errors.New(fmt.Sprintf("deployment '%s' exceeded its progress deadline", dep.Name))
+		}
+	}
+
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+
+	if dep.Status.UpdatedReplicas < replicas {
+		return false, fmt.Sprintf("deployment '%s': %d out of %d new replicas have been updated", dep.Name, dep.Status.UpdatedReplicas, replicas), nil
+	}
+
+	if dep.Status.Replicas > dep.Status.UpdatedReplicas {
+		return false, fmt.Sprintf("deployment '%s': %d old replicas are pending termination", dep.Name, dep.Status.Replicas-dep.Status.UpdatedReplicas), nil
+	}
+
+	if dep.Status.AvailableReplicas < dep.Status.UpdatedReplicas {
+		return false, fmt.Sprintf("deployment '%s': %d of %d updated replicas are available", dep.Name, dep.Status.AvailableReplicas, dep.Status.UpdatedReplicas), nil
+	}
+
+	return true, fmt.Sprintf("deployment '%s' successfully rolled out", dep.Name), nil
+}
+
+// DefaultRolloutTimeout is how long deployments are waited for to roll out when no timeout is given, as the default
+// progress deadline of deployments
+const DefaultRolloutTimeout = 10 * time.Minute
+
+// awaitRollout watches the deployments matched by a shift's pod-selector until all of them are completely rolled
+// out, up to a timeout (DefaultRolloutTimeout when zero)
+func (v *VirtualService) awaitRollout(s Shift, timeout time.Duration) error {
+	namespace := DestinationNamespace(v.Name, v.Namespace)
+	podSelector, err := Stringify(v.TrackingId, s.Traffic.PodSelector)
+	if err != nil {
+		return err
+	}
+
+	if timeout == 0 {
+		timeout = DefaultRolloutTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	reported := map[string]string{}
+	watchOptions := metav1.ListOptions{LabelSelector: podSelector}
+
+	var wi watch.Interface
+	defer func() {
+		if wi != nil {
+			wi.Stop()
+		}
+	}()
+
+	for {
+		deps, err := v.KubeClient.AppsV1().Deployments(namespace).List(metav1.ListOptions{LabelSelector: podSelector})
+		if err != nil {
+			return err
+		}
+
+		// a typo at the pod-selector would otherwise wait for the whole timeout
+		if len(deps.Items) == 0 {
+			return errors.New(fmt.Sprintf("no deployments matched pod-selector '%s' at namespace '%s'", podSelector, namespace))
+		}
+
+		done, pending, err := v.rolloutProgress(deps.Items, reported)
+		if err != nil {
+			return err
+		}
+
+		if done {
+			return nil
+		}
+
+		// a single watch is kept open, started from the listed version so no change is missed in the meantime
+		if wi == nil {
+			watchOptions.ResourceVersion = deps.ResourceVersion
+			wi, err = v.KubeClient.AppsV1().Deployments(namespace).Watch(watchOptions)
+			if err != nil {
+				return err
+			}
+		}
+
+		// any event means the deployments must be evaluated again
+		select {
+		case _, ok := <-wi.ResultChan():
+			if !ok {
+				logger.Debug("Watch of deployments closed, watching again", v.TrackingId)
+				wi = nil
+			}
+		case <-timer.C:
+			return errors.New(fmt.Sprintf("rollout did not finish within %s: %s", timeout, pending))
+		}
+	}
+}
+
+// rolloutProgress returns whether every deployment has rolled out and the progress of the pending ones, logging
+// each progress once
+func (v *VirtualService) rolloutProgress(deps []appsv1.Deployment, reported map[string]string) (bool, string, error) {
+	var pending []string
+	for i := range deps {
+		dep := &deps[i]
+		done, progress, err := RolloutStatus(dep)
+		if err != nil {
+			return false, "", err
+		}
+
+		if reported[dep.Name] != progress {
+			logger.Info(progress, v.TrackingId)
+			reported[dep.Name] = progress
+		}
+
+		if !done {
+			pending = append(pending, progress)
+		}
+	}
+	sort.Strings(pending)
+
+	return len(pending) == 0, strings.Join(pending, "; "), nil
+}
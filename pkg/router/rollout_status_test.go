@@ -0,0 +1,94 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func rollingDeployment(replicas int32, updated int32, total int32, available int32) *appsv1.Deployment {
+	dep := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api-2", Namespace: "default", Generation: 2, Labels: map[string]string{"app": "api", "build": "2"}}}
+	dep.Spec.Replicas = &replicas
+	dep.Status.ObservedGeneration = 2
+	dep.Status.UpdatedReplicas = updated
+	dep.Status.Replicas = total
+	dep.Status.AvailableReplicas = available
+	dep.Status.ReadyReplicas = available
+
+	return dep
+}
+
+func TestRolloutStatus_Unit(t *testing.T) {
+	unobserved := rollingDeployment(3, 3, 3, 3)
+	unobserved.Generation = 3
+
+	exceeded := rollingDeployment(3, 1, 3, 1)
+	exceeded.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"}}
+
+	cases := []struct {
+		dep      *appsv1.Deployment
+		done     bool
+		progress string
+	}{
+		{unobserved, false, "deployment 'api-2': waiting for its spec update to be observed"},
+		{rollingDeployment(3, 1, 3, 1), false, "deployment 'api-2': 1 out of 3 new replicas have been updated"},
+		{rollingDeployment(3, 3, 4, 3), false, "deployment 'api-2': 1 old replicas are pending termination"},
+		{rollingDeployment(3, 3, 3, 2), false, "deployment 'api-2': 2 of 3 updated replicas are available"},
+		{rollingDeployment(3, 3, 3, 3), true, "deployment 'api-2' successfully rolled out"},
+	}
+
+	for _, tt := range cases {
+		done, progress, err := RolloutStatus(tt.dep)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.done, done)
+		assert.Equal(t, tt.progress, progress)
+	}
+
+	_, _, err := RolloutStatus(exceeded)
+	assert.EqualError(t, err, "deployment 'api-2' exceeded its progress deadline")
+}
+
+func TestVirtualService_AwaitReady_Unit_Rollout(t *testing.T) {
+	kubeClient := kubeFake.NewSimpleClientset(rollingDeployment(3, 1, 3, 1))
+	v := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", KubeClient: kubeClient}
+	shift := Shift{Traffic: Traffic{PodSelector: map[string]string{"app": "api", "build": "2"}}}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = kubeClient.AppsV1().Deployments("default").UpdateStatus(rollingDeployment(3, 3, 4, 2))
+		time.Sleep(50 * time.Millisecond)
+		_, _ = kubeClient.AppsV1().Deployments("default").UpdateStatus(rollingDeployment(3, 3, 3, 3))
+	}()
+
+	err := v.AwaitReady(shift, Readiness{Rollout: true, MinReady: 3, Timeout: 2 * time.Second})
+	assert.NoError(t, err)
+}
+
+func TestVirtualService_AwaitReady_Unit_RolloutErrorCases(t *testing.T) {
+	exceeded := rollingDeployment(3, 1, 3, 1)
+	exceeded.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"}}
+
+	failureCases := []struct {
+		dep *appsv1.Deployment
+		err string
+	}{
+		{rollingDeployment(3, 1, 3, 1), "rollout did not finish within 50ms: deployment 'api-2': 1 out of 3 new replicas have been updated"},
+		{exceeded, "deployment 'api-2' exceeded its progress deadline"},
+	}
+
+	shift := Shift{Traffic: Traffic{PodSelector: map[string]string{"app": "api", "build": "2"}}}
+	for _, tt := range failureCases {
+		v := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", KubeClient: kubeFake.NewSimpleClientset(tt.dep)}
+		err := v.AwaitReady(shift, Readiness{Rollout: true, Timeout: 50 * time.Millisecond})
+		assert.EqualError(t, err, tt.err)
+	}
+
+	// a pod-selector without deployments fails right away, even without a timeout
+	v := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", KubeClient: kubeFake.NewSimpleClientset()}
+	err := v.AwaitReady(Shift{Traffic: Traffic{PodSelector: map[string]string{"build": "2"}}}, Readiness{Rollout: true})
+	assert.EqualError(t, err, "no deployments matched pod-selector 'build=2' at namespace 'default'")
+}
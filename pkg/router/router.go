@@ -32,7 +32,29 @@ type Traffic struct {
 	RequestHeaders map[string]string
 	Exact          bool
 	Regexp         bool
-	Weight         int32
+	// UriPrefix & UriRegex match the requests' path, only one of them can be given
+	UriPrefix string
+	UriRegex  string
+	// Method matches the requests' HTTP method (ex: 'GET')
+	Method string
+	// SourceLabels match the labels of the workload which sends the requests
+	SourceLabels map[string]string
+	// Gateways restrict the route to requests from the given gateways' names
+	Gateways []string
+	Weight   int32
+	// Weights splits the master-route across many subsets (subset name -> weight), which must sum 100
+	Weights map[string]int32
+	// Protocol of the routes to be shifted: ProtocolHTTP (default), ProtocolTCP or ProtocolTLS
+	Protocol string
+	// Mirror copies the requests of the master-route to the new subset, whose responses are discarded
+	Mirror bool
+	// MirrorPercent of requests to be mirrored, only MirrorPercentAll (default when zero) is supported
+	MirrorPercent uint32
+}
+
+// HasMatch returns whether a Traffic has any criteria to match requests of a canary route
+func (t Traffic) HasMatch() bool {
+	return len(t.RequestHeaders) > 0 || t.UriPrefix != "" || t.UriRegex != "" || t.Method != "" || len(t.SourceLabels) > 0
 }
 
 type Selector struct {
@@ -49,6 +71,21 @@ type IstioRouteList struct {
 	DList *v1alpha32.DestinationRuleList
 }
 
+// NotFoundError is returned when no resources match a label-selector
+type NotFoundError struct {
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return e.Message
+}
+
+// IsNotFound returns whether an error tells that no resources match a label-selector
+func IsNotFound(err error) bool {
+	_, ok := err.(NotFoundError)
+	return ok
+}
+
 // Stringify returns a k8s selector string based on given map. Ex: "map[key] = value -> key=value"
 func Stringify(cid string, labelSelector map[string]string) (string, error) {
 
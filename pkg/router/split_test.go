@@ -0,0 +1,176 @@
+package router
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateWeights_Unit(t *testing.T) {
+	assert.NoError(t, ValidateWeights(map[string]int32{"api-1-default": 50, "api-2-default": 30, "api-3-default": 20}))
+	assert.EqualError(t, ValidateWeights(map[string]int32{"api-1-default": 50, "api-2-default": 30}), "weights must sum 100, got '80'")
+	assert.EqualError(t, ValidateWeights(map[string]int32{"api-1-default": 100, "api-2-default": 0}), "weight of subset 'api-2-default' not in range 1 - 100")
+}
+
+func TestVirtualService_Validate_Unit_Weights(t *testing.T) {
+	vs := VirtualService{}
+
+	err := vs.Validate(Shift{Traffic: Traffic{Weight: 10, Weights: map[string]int32{"api-1-default": 100}}})
+	assert.EqualError(t, err, "a route split by 'weights' can't be served with a 'weight' or 'request headers'")
+
+	err = vs.Validate(Shift{Traffic: Traffic{Weights: map[string]int32{"api-1-default": 60, "api-2-default": 40}}})
+	assert.NoError(t, err)
+}
+
+func TestSplit_Unit(t *testing.T) {
+	s := Shift{
+		Hostname: "api-service",
+		Port:     5000,
+		Traffic:  Traffic{Weights: map[string]int32{"api-3-default": 20, "api-1-default": 50, "api-2-default": 30}},
+	}
+
+	routeSplit := Split(s)
+	assert.Equal(t, 3, len(routeSplit))
+	assert.Equal(t, "api-1-default", routeSplit[0].Destination.Subset)
+	assert.Equal(t, int32(50), routeSplit[0].Weight)
+	assert.Equal(t, "api-2-default", routeSplit[1].Destination.Subset)
+	assert.Equal(t, int32(30), routeSplit[1].Weight)
+	assert.Equal(t, "api-3-default", routeSplit[2].Destination.Subset)
+	assert.Equal(t, int32(20), routeSplit[2].Weight)
+	assert.Equal(t, uint32(5000), routeSplit[2].Destination.Port.GetNumber())
+}
+
+func TestPercentage_Unit_SortedSplit(t *testing.T) {
+	split := Shift{
+		Hostname: "api-service",
+		Port:     5000,
+		Traffic:  Traffic{Weights: map[string]int32{"api-9-default": 50, "api-10-default": 50}},
+	}
+
+	// splits are sorted by subset name, so the subset being shifted to comes first
+	master := &v1alpha3.HTTPRoute{
+		Match: []*v1alpha3.HTTPMatchRequest{{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}}},
+		Route: Split(split),
+	}
+	assert.Equal(t, "api-10-default", master.Route[0].Destination.Subset)
+
+	s := Shift{Hostname: "api-service", Port: 5000, Traffic: Traffic{Weight: 80}}
+	routed, err := Percentage("unit-testing-uuid", "api-10-default", []*v1alpha3.HTTPRoute{master}, s, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(routed[0].Route))
+	assert.Equal(t, "api-9-default", routed[0].Route[0].Destination.Subset)
+	assert.Equal(t, int32(20), routed[0].Route[0].Weight)
+	assert.Equal(t, "api-10-default", routed[0].Route[1].Destination.Subset)
+	assert.Equal(t, int32(80), routed[0].Route[1].Weight)
+
+	// a master-route which routes every request to the subset is kept as is
+	master.Route = master.Route[1:]
+	master.Route[0].Weight = 0
+	routed, err = Percentage("unit-testing-uuid", "api-10-default", []*v1alpha3.HTTPRoute{master}, s, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(routed[0].Route))
+	assert.Equal(t, "api-10-default", routed[0].Route[0].Destination.Subset)
+}
+
+func TestVirtualService_Update_Integrated_Weights(t *testing.T) {
+	fakeIstioClient = istioFake.NewSimpleClientset()
+
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      3,
+		Istio:      fakeIstioClient,
+	}
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	shift := Shift{
+		Port:     5000,
+		Hostname: "api-service",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector: map[string]string{"app": "api", "build": "3"},
+			Weights: map[string]int32{
+				"api-testing-1-integration": 50,
+				"api-testing-2-integration": 30,
+				"api-testing-3-integration": 20,
+			},
+		},
+	}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = vs.Namespace
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Headers: map[string]*v1alpha3.StringMatch{"x-email": {MatchType: &v1alpha3.StringMatch_Exact{Exact: "somebody@domain.io"}}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-2-integration"}},
+			},
+		},
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-testing-1-integration"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = vs.Namespace
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-testing-1-integration", Labels: map[string]string{"build": "1"}},
+	}
+
+	_, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&v)
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Create(&d)
+
+	// subset of build 2 does not exist
+	err := vs.Update(shift)
+	assert.EqualError(t, err, "could not find subset 'api-testing-2-integration' at destinationRules")
+
+	d.Spec.Subsets = append(d.Spec.Subsets, &v1alpha3.Subset{Name: "api-testing-2-integration", Labels: map[string]string{"build": "2"}})
+	_, _ = fakeIstioClient.NetworkingV1alpha3().DestinationRules(vs.Namespace).Update(&d)
+
+	err = vs.Update(shift)
+	assert.NoError(t, err)
+
+	re, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	// request header's route of a weighted subset is removed
+	assert.Equal(t, 1, len(re.Spec.Http))
+	assert.Equal(t, 3, len(re.Spec.Http[0].Route))
+	assert.Equal(t, "api-testing-1-integration", re.Spec.Http[0].Route[0].Destination.Subset)
+	assert.Equal(t, int32(50), re.Spec.Http[0].Route[0].Weight)
+	assert.Equal(t, "api-testing-2-integration", re.Spec.Http[0].Route[1].Destination.Subset)
+	assert.Equal(t, int32(30), re.Spec.Http[0].Route[1].Weight)
+	assert.Equal(t, "api-testing-3-integration", re.Spec.Http[0].Route[2].Destination.Subset)
+	assert.Equal(t, int32(20), re.Spec.Http[0].Route[2].Weight)
+
+	// previous master-route is kept at history
+	revisions, err := History(re)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(revisions))
+	assert.Equal(t, "api-testing-1-integration", revisions[0].Destinations[0].Subset)
+
+	// a weight can't be balanced over a split of more than 2 subsets without dropping any of them
+	shift.Traffic.Weights = nil
+	shift.Traffic.Weight = 40
+	err = vs.Update(shift)
+	assert.EqualError(t, err, "master-route is split across 3 subsets, refusing to balance a 'weight' between two of them: shift with 'weights' instead")
+
+	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 3, len(re.Spec.Http[0].Route))
+	assert.Equal(t, "api-testing-2-integration", re.Spec.Http[0].Route[1].Destination.Subset)
+}
@@ -2,12 +2,14 @@ package router
 
 import (
 	"fmt"
+	"io"
 	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
 	"github.com/pismo/istiops/pkg/logger"
 	"github.com/pkg/errors"
 	"istio.io/api/networking/v1alpha3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"regexp"
+	"sort"
+	"strings"
 )
 
 type VirtualService struct {
@@ -17,10 +19,26 @@ type VirtualService struct {
 	Build      uint32
 	Istio      IstioClientInterface
 	KubeClient KubeClientInterface
+	// DryRun prints changes as a diff instead of applying them
+	DryRun bool
+	// DiffOutput receives the diff of each change in dry-run mode, which is only logged when nil
+	DiffOutput io.Writer
+	// Retry of updates which conflict with concurrent changes, DefaultRetry is used when empty
+	Retry Retry
+	// MasterRoute defines the default route of virtualServices, RegexMasterRoute is used when empty
+	MasterRoute MasterRoute
+	// Reconcile replaces the canary route of a build whose match drifted from the shift, instead of keeping it
+	Reconcile bool
+	// Audit identifies who changes resources and where their audit records are written besides annotations
+	Audit Audit
+	// audited is the running operation, recorded along with each change
+	audited auditContext
 }
 
 // Clear will remove any virtualService's routes which are not master ones given a k8s labelSelector
 func (v *VirtualService) Clear(s Shift, m string) error {
+	defer v.auditing(OperationClear, &s)()
+
 	dr := DestinationRule{
 		TrackingId: v.TrackingId,
 		Name:       v.Name,
@@ -30,32 +48,39 @@ func (v *VirtualService) Clear(s Shift, m string) error {
 		KubeClient: v.KubeClient,
 	}
 
-	dss, err := dr.List(s.Selector)
-	if err != nil {
-		return err
+	// missing destinationRules are reported before missing virtualServices
+	vss, vsErr := v.List(s.Selector)
+	routed := &v1alpha32.VirtualServiceList{}
+	if vsErr == nil {
+		routed = vss.VList
 	}
 
-	vss, err := v.List(s.Selector)
+	// subsets of destinations in other namespaces are defined by destinationRules of those namespaces
+	dss, err := dr.ListRouted(s.Selector, routed)
 	if err != nil {
 		return err
 	}
 
+	if vsErr != nil {
+		return vsErr
+	}
+
 	// generating a cleaned list of routes with only route-master (URI: .+) included
 	for _, vs := range vss.VList.Items {
 		var cleanedRules []*v1alpha3.HTTPRoute
 		cleanedRules = []*v1alpha3.HTTPRoute{}
 
+		owned, err := v.ownership(&vs)
+		if err != nil {
+			return err
+		}
+
 		if m == "hard" {
-			logger.Info(fmt.Sprintf("triggering hard clear. Removing all virtualService '%s' rules except the master-route one (Regex: .+)", vs.Name), v.TrackingId)
+			logger.Info(fmt.Sprintf("triggering hard clear. Removing all virtualService '%s' rules except the master-route one (%s)", vs.Name, v.masterRoute()), v.TrackingId)
 			for httpKey, httpValue := range vs.Spec.Http {
-				for _, matchValue := range httpValue.Match {
-					anyPrefix, _ := regexp.MatchString(`.+`, matchValue.Uri.GetPrefix())
-					if anyPrefix {
-						cleanedRules = append(cleanedRules, vs.Spec.Http[httpKey])
-					}
-					if matchValue.Uri.GetRegex() == ".+" {
-						cleanedRules = append(cleanedRules, vs.Spec.Http[httpKey])
-					}
+				// routes which were not created by istiops are never removed
+				if v.masterRoute().Matches(httpValue) || !owned.owns(httpValue) {
+					cleanedRules = append(cleanedRules, vs.Spec.Http[httpKey])
 				}
 			}
 		}
@@ -63,6 +88,12 @@ func (v *VirtualService) Clear(s Shift, m string) error {
 		if m == "soft" {
 			logger.Info(fmt.Sprintf("triggering soft clear for virtualService '%s'", vs.Name), v.TrackingId)
 			for httpKey, httpValue := range vs.Spec.Http {
+				// routes which were not created by istiops are never removed
+				if !owned.owns(httpValue) {
+					cleanedRules = append(cleanedRules, vs.Spec.Http[httpKey])
+					continue
+				}
+
 				// append canary rules without pods associated - based on destinationRules
 				for _, routeValue := range httpValue.Route {
 					// subset can be empty and won't be removed
@@ -72,63 +103,74 @@ func (v *VirtualService) Clear(s Shift, m string) error {
 					}
 
 					if routeValue.Destination.Subset != "" {
-						for _, d := range dss.DList.Items {
-							for _, subset := range d.Spec.Subsets {
-								if subset.GetName() == routeValue.Destination.Subset {
-									// finally get all deployments associated with the current subset labels
-									subsetLabelsMap := map[string]string{}
-									for labelKey, labelValue := range subset.Labels {
-										subsetLabelsMap[labelKey] = labelValue
-									}
-									subsetLabelsString, err := Stringify(v.TrackingId, subsetLabelsMap)
-									if err != nil {
-										return err
-									}
-
-									deps, err := v.KubeClient.AppsV1().Deployments(v.Namespace).List(metav1.ListOptions{
-										LabelSelector: subsetLabelsString,
-									})
-									if err != nil {
-										return err
-									}
-
-									// more than one deployment as result is not recommended
-									if len(deps.Items) > 1 {
-										logger.Error(fmt.Sprintf("more than one deployment which matches labels '%s'", subsetLabelsString), v.TrackingId)
-									}
-
-									if len(deps.Items) == 0 {
-										logger.Warn(fmt.Sprintf("removing route rule for subset '%s' due to inexistent deployment '%s'", subsetLabelsString, subset.GetName()), v.TrackingId)
-									}
-
-									if len(deps.Items) == 1 {
-										dep := deps.Items[0]
-										if dep.Status.Replicas > 0 {
-											logger.Debug(fmt.Sprintf("including route rule for subset '%s' due to existent pods ('%d') for deployment '%s'", subset.GetName(), dep.Status.Replicas, dep.Name), v.TrackingId)
-											cleanedRules = append(cleanedRules, vs.Spec.Http[httpKey])
-										} else {
-											logger.Info(fmt.Sprintf("removing route rule for subset '%s' due to inexistent pods ('%d') for deployment '%s'", subset.GetName(), dep.Status.Replicas, dep.Name), v.TrackingId)
-										}
-									}
-								}
-							}
+						active, err := v.activeSubset(dss, routeValue.Destination)
+						if err != nil {
+							return err
+						}
+
+						if active {
+							cleanedRules = append(cleanedRules, vs.Spec.Http[httpKey])
 						}
 					}
 				}
 			}
+
+			// tcp & tls routes are kept while any of their subsets has pods associated
+			var cleanedTcp []*v1alpha3.TCPRoute
+			for _, tcpValue := range vs.Spec.Tcp {
+				active, err := v.activeRoute(dss, tcpValue.Route)
+				if err != nil {
+					return err
+				}
+
+				if active {
+					cleanedTcp = append(cleanedTcp, tcpValue)
+				}
+			}
+			vs.Spec.Tcp = cleanedTcp
+
+			var cleanedTls []*v1alpha3.TLSRoute
+			for _, tlsValue := range vs.Spec.Tls {
+				active, err := v.activeRoute(dss, tlsValue.Route)
+				if err != nil {
+					return err
+				}
+
+				if active {
+					cleanedTls = append(cleanedTls, tlsValue)
+				}
+			}
+			vs.Spec.Tls = cleanedTls
 		}
 
 		if m != "hard" && m != "soft" {
 			return errors.New("empty mode when trying do clear routes. Refusing to continue")
 		}
 
-		if len(cleanedRules) == 0 {
+		if len(cleanedRules) == 0 && len(vs.Spec.Tcp) == 0 && len(vs.Spec.Tls) == 0 {
 			return errors.New("empty routes when cleaning virtualService's rules")
 		}
 
+		// mirrors are set by istiops only at the master-route, where they're removed when stale
+		for _, httpValue := range cleanedRules {
+			if !v.masterRoute().Matches(httpValue) {
+				continue
+			}
+
+			err = v.clearMirror(dss, httpValue, m)
+			if err != nil {
+				return err
+			}
+		}
+
 		vs.Spec.Http = cleanedRules
 
-		err := UpdateVirtualService(v, &vs)
+		err = owned.save(&vs)
+		if err != nil {
+			return err
+		}
+
+		err = UpdateVirtualService(v, &vs)
 		if err != nil {
 			return err
 		}
@@ -137,9 +179,70 @@ func (v *VirtualService) Clear(s Shift, m string) error {
 	return nil
 }
 
+// activeSubset returns whether the subset of a destination has pods associated to be routed to, which are looked up
+// at the namespace of the destination
+func (v *VirtualService) activeSubset(dss *IstioRouteList, destination *v1alpha3.Destination) (bool, error) {
+	active := false
+	subsetName := destination.GetSubset()
+	namespace := DestinationNamespace(destination.GetHost(), v.Namespace)
+
+	for _, d := range dss.DList.Items {
+		for _, subset := range d.Spec.Subsets {
+			if subset.GetName() != subsetName {
+				continue
+			}
+
+			// finally get all pods associated with the current subset labels, whichever workload manages them
+			ready, total, err := ReadyPods(v.TrackingId, v.KubeClient, namespace, subset.Labels)
+			if err != nil {
+				return false, err
+			}
+
+			// workloads of any kind are only resolved to be logged (bare pods have none), so failing to list them
+			// doesn't prevent the clear
+			workloads, err := Workloads(v.TrackingId, v.KubeClient, namespace, subset.Labels)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("could not resolve workloads of subset '%s': %s", subset.GetName(), err), v.TrackingId)
+			}
+
+			if ready > 0 {
+				logger.Debug(fmt.Sprintf("including route rule for subset '%s' due to ready pods ('%d' of '%d') of workloads '%s'", subset.GetName(), ready, total, JoinWorkloads(workloads)), v.TrackingId)
+				active = true
+			} else if len(workloads) == 0 {
+				logger.Warn(fmt.Sprintf("removing route rule for subset '%s' due to inexistent workloads and ready pods ('%d' of '%d')", subset.GetName(), ready, total), v.TrackingId)
+			} else {
+				logger.Info(fmt.Sprintf("removing route rule for subset '%s' due to inexistent ready pods ('%d' of '%d') of workloads '%s'", subset.GetName(), ready, total, JoinWorkloads(workloads)), v.TrackingId)
+			}
+		}
+	}
+
+	return active, nil
+}
+
+// activeRoute returns whether any destination of a tcp/tls route has pods associated to be routed to
+func (v *VirtualService) activeRoute(dss *IstioRouteList, routeDestinations []*v1alpha3.RouteDestination) (bool, error) {
+	for _, routeValue := range routeDestinations {
+		// subset can be empty and won't be removed
+		if routeValue.Destination.GetSubset() == "" {
+			return true, nil
+		}
+
+		active, err := v.activeSubset(dss, routeValue.Destination)
+		if err != nil {
+			return false, err
+		}
+
+		if active {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 // Create returns a new route to be posterior appended to virtualService
 func (v *VirtualService) Create(s Shift) (*IstioRules, error) {
-	subsetName := fmt.Sprintf("%s-%v-%s", v.Name, v.Build, v.Namespace)
+	subsetName := SubsetName(v.Name, v.Build, v.Namespace)
 
 	logger.Info(fmt.Sprintf("Creating new http route for subset '%s'...", subsetName), v.TrackingId)
 	newMatch := &v1alpha3.HTTPMatchRequest{}
@@ -187,11 +290,31 @@ func (v *VirtualService) Create(s Shift) (*IstioRules, error) {
 
 	newRoute := &v1alpha3.HTTPRoute{}
 
-	if len(s.Traffic.RequestHeaders) == 0 {
+	if !s.Traffic.HasMatch() {
 		return &IstioRules{}, errors.New("can't create a new route without request header's match")
 	}
 
-	logger.Info(fmt.Sprintf("Setting request header's match rule '%#v' for '%s'...", s.Traffic.RequestHeaders, subsetName), v.TrackingId)
+	if s.Traffic.UriPrefix != "" {
+		newMatch.Uri = &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Prefix{Prefix: s.Traffic.UriPrefix}}
+	}
+
+	if s.Traffic.UriRegex != "" {
+		newMatch.Uri = &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: s.Traffic.UriRegex}}
+	}
+
+	if s.Traffic.Method != "" {
+		newMatch.Method = &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Exact{Exact: strings.ToUpper(s.Traffic.Method)}}
+	}
+
+	if len(s.Traffic.SourceLabels) > 0 {
+		newMatch.SourceLabels = s.Traffic.SourceLabels
+	}
+
+	if len(s.Traffic.Gateways) > 0 {
+		newMatch.Gateways = s.Traffic.Gateways
+	}
+
+	logger.Info(fmt.Sprintf("Setting match rule '%s' for '%s'...", newMatch, subsetName), v.TrackingId)
 	newRoute.Match = append(newRoute.Match, newMatch)
 	newRoute.Route = append(newRoute.Route, defaultDestination)
 
@@ -204,11 +327,46 @@ func (v *VirtualService) Create(s Shift) (*IstioRules, error) {
 
 // Validate checks if VirtualService and Shift objects are correctly filled up
 func (v *VirtualService) Validate(s Shift) error {
-	if s.Traffic.Weight != 0 && len(s.Traffic.RequestHeaders) > 0 {
+	err := ValidateProtocol(s.Traffic.Protocol)
+	if err != nil {
+		return err
+	}
+
+	err = validateMirror(s)
+	if err != nil {
+		return err
+	}
+
+	// a mirror doesn't route any request to the new subset
+	if s.Traffic.Mirror {
+		return nil
+	}
+
+	if isL4(s) && s.Traffic.HasMatch() {
+		return errors.New(fmt.Sprintf("'%s' routes can only be shifted by 'weight'", s.Traffic.Protocol))
+	}
+
+	if s.Traffic.Weight != 0 && s.Traffic.HasMatch() {
 		return errors.New("a route needs to be served with a 'weight' or 'request headers', not both")
 	}
 
-	if s.Traffic.Weight == 0 && len(s.Traffic.RequestHeaders) == 0 {
+	if s.Traffic.UriPrefix != "" && s.Traffic.UriRegex != "" {
+		return errors.New("a route can't match both 'uri prefix' and 'uri regex'")
+	}
+
+	if s.Traffic.UriRegex == ".+" {
+		return errors.New("uri regex '.+' is reserved to the master-route")
+	}
+
+	if len(s.Traffic.Weights) > 0 {
+		if s.Traffic.Weight != 0 || s.Traffic.HasMatch() {
+			return errors.New("a route split by 'weights' can't be served with a 'weight' or 'request headers'")
+		}
+
+		return ValidateWeights(s.Traffic.Weights)
+	}
+
+	if s.Traffic.Weight == 0 && !s.Traffic.HasMatch() {
 		return errors.New("could not update route without 'weight' or 'headers'")
 	}
 
@@ -221,7 +379,7 @@ or just create a new one (based on Create() method). The traffic will be balance
 based on Shift object with the inclusion of Weight or RequestHeaders attributes
 */
 func (v *VirtualService) Update(s Shift) error {
-	subsetName := fmt.Sprintf("%s-%v-%s", v.Name, v.Build, v.Namespace)
+	defer v.auditing(OperationShift, &s)()
 
 	vss, err := v.List(s.Selector)
 	if err != nil {
@@ -229,67 +387,218 @@ func (v *VirtualService) Update(s Shift) error {
 	}
 
 	for _, vs := range vss.VList.Items {
-		routeExists := false
-		for _, httpValue := range vs.Spec.Http {
-			for _, routeValue := range httpValue.Route {
-				// if subset already exists
-				if routeValue.Destination.Subset == subsetName {
-					routeExists = true
+		vs := vs
+		err := onConflict(v.TrackingId, v.Retry, "virtualService", vs.Name, func(attempt int) error {
+			// a conflict means the resource was changed in the meantime, so the shift is applied again over its fresh state
+			if attempt > 0 {
+				fresh, err := v.get(vs.Name)
+				if err != nil {
+					return err
 				}
+				vs = *fresh
 			}
-		}
 
-		if !routeExists {
-			// create new route
-			newHttpRoute, err := v.Create(s)
+			err := v.applyShift(s, &vs)
 			if err != nil {
 				return err
 			}
 
-			// ensure that http headers match will be the first element of vs.Spec.Http due to istio's rules precedence
-			var auxHttp []*v1alpha3.HTTPRoute
-			auxHttp = []*v1alpha3.HTTPRoute{}
-			auxHttp = append(auxHttp, newHttpRoute.MatchDestination)
-			for _, httpValue := range vs.Spec.Http {
-				auxHttp = append(auxHttp, httpValue)
+			return UpdateVirtualService(v, &vs)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// applyShift changes the routes of a virtualService object based on Shift object
+func (v *VirtualService) applyShift(s Shift, vs *v1alpha32.VirtualService) error {
+	if isL4(s) {
+		return v.applyL4Shift(s, vs)
+	}
+
+	if s.Traffic.Mirror {
+		return v.applyMirror(s, vs)
+	}
+
+	if len(s.Traffic.Weights) > 0 {
+		return v.applySplit(s, vs)
+	}
+
+	subsetName := SubsetName(v.Name, v.Build, v.Namespace)
+
+	owned, err := v.ownership(vs)
+	if err != nil {
+		return err
+	}
+
+	routeExists := false
+	for _, httpValue := range vs.Spec.Http {
+		// routes which were not created by istiops are ignored
+		if !owned.owns(httpValue) && !v.masterRoute().Matches(httpValue) {
+			continue
+		}
+
+		for _, routeValue := range httpValue.Route {
+			// if subset already exists
+			if routeValue.Destination.Subset == subsetName {
+				routeExists = true
 			}
+		}
 
-			vs.Spec.Http = auxHttp
+		// a mirrored subset can be shifted to by weight straight away
+		if s.Traffic.Weight > 0 && httpValue.Mirror.GetSubset() == subsetName && v.masterRoute().Matches(httpValue) {
+			routeExists = true
 		}
+	}
 
-		if routeExists {
-			logger.Info("Found existent rule created for virtualService, skipping creation", v.TrackingId)
+	if !routeExists {
+		// create new route
+		newHttpRoute, err := v.Create(s)
+		if err != nil {
+			return err
+		}
 
-			// If a canary rule already exists, just warn it
-			if len(s.Traffic.RequestHeaders) > 0 {
-				logger.Warn(fmt.Sprintf("Already existent canary rule for build '%v', refusing to update it", v.Build), v.TrackingId)
+		err = owned.add(subsetName, newHttpRoute.MatchDestination)
+		if err != nil {
+			return err
+		}
+
+		// ensure that http headers match will be the first element of vs.Spec.Http due to istio's rules precedence
+		var auxHttp []*v1alpha3.HTTPRoute
+		auxHttp = []*v1alpha3.HTTPRoute{}
+		auxHttp = append(auxHttp, newHttpRoute.MatchDestination)
+		for _, httpValue := range vs.Spec.Http {
+			auxHttp = append(auxHttp, httpValue)
+		}
+
+		vs.Spec.Http = auxHttp
+	}
+
+	if routeExists {
+		logger.Info("Found existent rule created for virtualService, skipping creation", v.TrackingId)
+
+		// If a canary rule already exists, just warn it unless it must be reconciled
+		if s.Traffic.HasMatch() && v.Reconcile {
+			err := v.replaceDrifted(owned, subsetName, s, vs)
+			if err != nil {
+				return err
 			}
+		} else if s.Traffic.HasMatch() {
+			logger.Warn(fmt.Sprintf("Already existent canary rule for build '%v', refusing to update it", v.Build), v.TrackingId)
+		}
 
-			// If a weight rule already exists, just update it
-			if s.Traffic.Weight > 0 {
-				httpRoutes, err := Percentage(v.TrackingId, subsetName, vs.Spec.Http, s)
-				if err != nil {
-					return err
-				}
+		// If a weight rule already exists, just update it
+		if s.Traffic.Weight > 0 {
+			previous := masterDestinations(vs, v.masterRoute())
 
-				httpRoutesNoHeaders, err := RemoveOutdatedRoutes(v.TrackingId, subsetName, httpRoutes)
-				if err != nil {
-					return err
-				}
+			httpRoutes, err := Percentage(v.TrackingId, subsetName, vs.Spec.Http, s, v.masterRoute())
+			if err != nil {
+				return err
+			}
 
-				vs.Spec.Http = httpRoutesNoHeaders
+			httpRoutesNoHeaders, err := v.removeOutdatedRoutes(owned, subsetName, httpRoutes)
+			if err != nil {
+				return err
 			}
+			v.unmirrorRouted(httpRoutesNoHeaders)
+
+			vs.Spec.Http = httpRoutesNoHeaders
+
+			v.recordHistory(s.Selector, vs, previous)
+		}
+
+	}
+
+	return owned.save(vs)
+}
+
+// applySplit sets the master-route of a virtualService object to the subsets & weights of a Shift object
+func (v *VirtualService) applySplit(s Shift, vs *v1alpha32.VirtualService) error {
+	subsetName := SubsetName(v.Name, v.Build, v.Namespace)
 
+	// the subset of the current build is created by the destinationRule router, every other one must already exist
+	labels := v.subsetLabels(s.Selector, vs)
+	for _, subset := range splitSubsets(s.Traffic.Weights) {
+		if _, ok := labels[subset]; !ok && subset != subsetName {
+			return errors.New(fmt.Sprintf("could not find subset '%s' at destinationRules", subset))
 		}
+	}
+
+	owned, err := v.ownership(vs)
+	if err != nil {
+		return err
+	}
+
+	previous := masterDestinations(vs, v.masterRoute())
 
-		err := UpdateVirtualService(v, &vs)
+	httpRoutes, err := Percentage(v.TrackingId, subsetName, vs.Spec.Http, s, v.masterRoute())
+	if err != nil {
+		return err
+	}
+
+	// request header's rules of weighted subsets are outdated
+	for _, subset := range splitSubsets(s.Traffic.Weights) {
+		httpRoutes, err = v.removeOutdatedRoutes(owned, subset, httpRoutes)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	v.unmirrorRouted(httpRoutes)
+	vs.Spec.Http = httpRoutes
 
+	v.recordHistory(s.Selector, vs, previous)
+
+	return owned.save(vs)
+}
+
+// removeOutdatedRoutes removes the routes of a subset like RemoveOutdatedRoutes, but keeping in place every route which
+// was not created by istiops
+func (v *VirtualService) removeOutdatedRoutes(owned *ownership, subset string, httpRoutes []*v1alpha3.HTTPRoute) ([]*v1alpha3.HTTPRoute, error) {
+	var candidates []*v1alpha3.HTTPRoute
+	for _, httpValue := range httpRoutes {
+		if owned.owns(httpValue) || v.masterRoute().Matches(httpValue) {
+			candidates = append(candidates, httpValue)
+		}
+	}
+
+	cleanedRoutes, err := RemoveOutdatedRoutes(v.TrackingId, subset, candidates, v.masterRoute())
+	if err != nil {
+		return nil, err
+	}
+
+	kept := map[*v1alpha3.HTTPRoute]bool{}
+	for _, httpValue := range cleanedRoutes {
+		kept[httpValue] = true
+	}
+
+	// the master-route stays as the last element, every other route keeps its previous order
+	var routes []*v1alpha3.HTTPRoute
+	for _, httpValue := range httpRoutes {
+		if v.masterRoute().Matches(httpValue) {
+			continue
+		}
+
+		if kept[httpValue] || !owned.owns(httpValue) {
+			routes = append(routes, httpValue)
+		}
+	}
+
+	return append(routes, cleanedRoutes[len(cleanedRoutes)-1]), nil
+}
+
+// get returns a virtualService by its name, not sharing routes with any other object
+func (v *VirtualService) get(name string) (*v1alpha32.VirtualService, error) {
+	vs, err := v.Istio.NetworkingV1alpha3().VirtualServices(v.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return CopyVirtualService(vs)
 }
 
 // List will return all virtualServices which matches a k8s labelSelector
@@ -313,7 +622,16 @@ func (v *VirtualService) List(selector map[string]string) (*IstioRouteList, erro
 		return nil, errors.New("empty virtualService list")
 	}
 	if len(vss.Items) <= 0 {
-		return nil, errors.New(fmt.Sprintf("could not find any virtualServices which matched label-selector '%v'", listOptions.LabelSelector))
+		return nil, NotFoundError{fmt.Sprintf("could not find any virtualServices which matched label-selector '%v'", listOptions.LabelSelector)}
+	}
+
+	// listed items are mutated by the callers, so they must not share routes with any other object
+	for vsKey := range vss.Items {
+		vsCopy, err := CopyVirtualService(&vss.Items[vsKey])
+		if err != nil {
+			return nil, err
+		}
+		vss.Items[vsKey] = *vsCopy
 	}
 
 	irl := &IstioRouteList{
@@ -323,13 +641,41 @@ func (v *VirtualService) List(selector map[string]string) (*IstioRouteList, erro
 	return irl, nil
 }
 
-// UpdateDestinationRule updates a specific virtualService given an updated object
+// UpdateVirtualService updates a specific virtualService given an updated object
 func UpdateVirtualService(vs *VirtualService, virtualService *v1alpha32.VirtualService) error {
+	// a replaced or restored master-route is only recorded by the change of its own virtualService
+	defer func() {
+		vs.audited.destinations = nil
+		vs.audited.rolledBack = 0
+	}()
+
+	current, err := vs.Istio.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(virtualService.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if vs.DryRun {
+		return PrintDiff(vs.TrackingId, vs.DiffOutput, "VirtualService", current.ObjectMeta, &current.Spec, virtualService.ObjectMeta, &virtualService.Spec)
+	}
+
+	// no-op updates are neither applied nor audited, so they never push real changes out of the audit trail
+	if unchanged(current.ObjectMeta, virtualService.ObjectMeta, &current.Spec.VirtualService, &virtualService.Spec.VirtualService) {
+		logger.Info(fmt.Sprintf("No changes for virtualService '%s', skipping update", virtualService.Name), vs.TrackingId)
+		return nil
+	}
+
+	record, err := vs.Audit.record(vs.TrackingId, vs.audited, "VirtualService", current.ObjectMeta, &virtualService.ObjectMeta, &current.Spec.VirtualService, &virtualService.Spec.VirtualService, RouteWeights(&virtualService.Spec.VirtualService))
+	if err != nil {
+		return err
+	}
+
 	logger.Info(fmt.Sprintf("Updating route for virtualService '%s'...", virtualService.Name), vs.TrackingId)
-	_, err := vs.Istio.NetworkingV1alpha3().VirtualServices(vs.Namespace).Update(virtualService)
+	_, err = vs.Istio.NetworkingV1alpha3().VirtualServices(vs.Namespace).Update(virtualService)
 	if err != nil {
 		return err
 	}
+
+	vs.Audit.write(vs.TrackingId, record)
 	return nil
 }
 
@@ -377,13 +723,77 @@ func Balance(currentSubset string, newSubset string, s Shift) ([]*v1alpha3.HTTPR
 	return routeBalanced, nil
 }
 
+// CurrentSubset returns the first of a route's subsets which is not being shifted to, as routes split by weights are
+// sorted by subset name. It returns false when every subset is the one being shifted to
+func CurrentSubset(subsets []string, newSubset string) (string, bool) {
+	for _, subset := range subsets {
+		if subset != newSubset {
+			return subset, true
+		}
+	}
+
+	return "", false
+}
+
+// ValidateWeights checks if weights of a split are in range and sum 100
+func ValidateWeights(weights map[string]int32) error {
+	var total int32
+	for _, subset := range splitSubsets(weights) {
+		if weights[subset] < 1 || weights[subset] > 100 {
+			return errors.New(fmt.Sprintf("weight of subset '%s' not in range 1 - 100", subset))
+		}
+		total += weights[subset]
+	}
+
+	if total != 100 {
+		return errors.New(fmt.Sprintf("weights must sum 100, got '%d'", total))
+	}
+
+	return nil
+}
+
+// splitSubsets returns the subsets of a split sorted by name, so routes are always generated in the same order
+func splitSubsets(weights map[string]int32) []string {
+	var subsets []string
+	for subset := range weights {
+		subsets = append(subsets, subset)
+	}
+	sort.Strings(subsets)
+
+	return subsets
+}
+
+// Split returns RouteDestinations with weight split across many subsets to be posterior appended to a virtualService
+func Split(s Shift) []*v1alpha3.HTTPRouteDestination {
+	var routeSplit []*v1alpha3.HTTPRouteDestination
+
+	for _, subset := range splitSubsets(s.Traffic.Weights) {
+		routeSplit = append(routeSplit, &v1alpha3.HTTPRouteDestination{
+			Weight: s.Traffic.Weights[subset],
+			Destination: &v1alpha3.Destination{
+				Host:   s.Hostname,
+				Subset: subset,
+				Port: &v1alpha3.PortSelector{
+					Port: &v1alpha3.PortSelector_Number{
+						Number: s.Port,
+					},
+				},
+			},
+		})
+	}
+
+	return routeSplit
+}
+
 // Remove returns a slice of Routes without an element given an index
 func Remove(slice []*v1alpha3.HTTPRoute, index int) []*v1alpha3.HTTPRoute {
 	return append(slice[:index], slice[index+1:]...)
 }
 
 // RemoveOutdatedRoutes returns a slice without any route which matches the given subset
-func RemoveOutdatedRoutes(trackingId string, subset string, httpRoute []*v1alpha3.HTTPRoute) ([]*v1alpha3.HTTPRoute, error) {
+func RemoveOutdatedRoutes(trackingId string, subset string, httpRoute []*v1alpha3.HTTPRoute, master MasterRoute) ([]*v1alpha3.HTTPRoute, error) {
+	master = orDefault(master)
+
 	var noMasterRoutes []*v1alpha3.HTTPRoute
 	var masterRoute *v1alpha3.HTTPRoute
 	var cleanedRoutes []*v1alpha3.HTTPRoute
@@ -391,11 +801,9 @@ func RemoveOutdatedRoutes(trackingId string, subset string, httpRoute []*v1alpha
 	// get a HTTPRoute without a master route to be posterior cleaned
 	for httpKey, httpValue := range httpRoute {
 		// remove request header route based on subset to avoid non-used rules persisted
-		for _, matchValue := range httpValue.Match {
-			if matchValue.Uri.GetRegex() == ".+" {
-				masterRoute = httpRoute[httpKey]
-				noMasterRoutes = Remove(httpRoute, httpKey)
-			}
+		if master.Matches(httpValue) {
+			masterRoute = httpRoute[httpKey]
+			noMasterRoutes = Remove(httpRoute, httpKey)
 		}
 	}
 
@@ -421,7 +829,7 @@ func RemoveOutdatedRoutes(trackingId string, subset string, httpRoute []*v1alpha
 		return nil, errors.New("got nil routes when removing outdated subsets")
 	}
 
-	if cleanedRoutes[len(cleanedRoutes)-1].Match[0].Uri.GetRegex() != ".+" {
+	if !master.Matches(cleanedRoutes[len(cleanedRoutes)-1]) {
 		return nil, errors.New(fmt.Sprintf("non master-route as last element in routes: %s", cleanedRoutes))
 	}
 
@@ -429,7 +837,9 @@ func RemoveOutdatedRoutes(trackingId string, subset string, httpRoute []*v1alpha
 }
 
 // Percentage returns a []HTTPRoute with weight routing set to be posterior appended to a virtualService
-func Percentage(trackingId string, subset string, httpRoute []*v1alpha3.HTTPRoute, s Shift) ([]*v1alpha3.HTTPRoute, error) {
+func Percentage(trackingId string, subset string, httpRoute []*v1alpha3.HTTPRoute, s Shift, master MasterRoute) ([]*v1alpha3.HTTPRoute, error) {
+	master = orDefault(master)
+
 	// Finding master route (URI match)
 	var masterRouteCounter int
 	var masterIndex int
@@ -442,28 +852,40 @@ func Percentage(trackingId string, subset string, httpRoute []*v1alpha3.HTTPRout
 
 	// work with percentage rules
 	for httpKey, httpValue := range httpRoute {
-		for _, matchValue := range httpValue.Match {
+		// reconstruct master route to attend a balanced traffic between versions
+		if master.Matches(httpValue) {
+			logger.Info(fmt.Sprintf("Updating master route to balance canary traffic"), trackingId)
 
-			// reconstruct master route to attend a balanced traffic between versions
-			if matchValue.Uri.GetRegex() == ".+" {
-				logger.Info(fmt.Sprintf("Updating master route to balance canary traffic"), trackingId)
+			masterRouteCounter += masterMatches(master, httpValue)
+			masterIndex = httpKey
 
-				masterRouteCounter += 1
-				masterIndex = httpKey
+			if len(s.Traffic.Weights) > 0 {
+				httpRoute[httpKey].Route = Split(s)
+				continue
+			}
 
-				newSubset := httpValue.Route[0].Destination.Subset
+			// a weight is balanced between two subsets, any other subset of a split would be silently dropped
+			if len(httpValue.Route) > 2 {
+				return nil, errors.New(fmt.Sprintf("master-route is split across %d subsets, refusing to balance a 'weight' between two of them: shift with 'weights' instead", len(httpValue.Route)))
+			}
 
-				balancedRoute, err := Balance(newSubset, subset, s)
-				if err != nil {
-					return nil, err
-				}
+			var subsets []string
+			for _, routeValue := range httpValue.Route {
+				subsets = append(subsets, routeValue.Destination.GetSubset())
+			}
 
-				httpRoute[httpKey].Route = balancedRoute
+			currentSubset, ok := CurrentSubset(subsets, subset)
+			if !ok {
+				logger.Info(fmt.Sprintf("Master-route already routes every request to subset '%s', skipping", subset), trackingId)
+				continue
+			}
 
-				if len(httpRoute[httpKey].Route) > 2 {
-					return nil, errors.New("more than 2 destination for route")
-				}
+			balancedRoute, err := Balance(currentSubset, subset, s)
+			if err != nil {
+				return nil, err
 			}
+
+			httpRoute[httpKey].Route = balancedRoute
 		}
 	}
 
@@ -478,9 +900,8 @@ func Percentage(trackingId string, subset string, httpRoute []*v1alpha3.HTTPRout
 
 	// create a master route rule if does not exists
 	if masterRouteCounter == 0 {
-		logger.Info(fmt.Sprintf("Could not find a master route 'Regex: .+', creating with 100%% of weight..."), trackingId)
+		logger.Info(fmt.Sprintf("Could not find a master route '%s', creating with 100%% of weight...", master), trackingId)
 		routeMaster := &v1alpha3.HTTPRoute{}
-		routeMasterMatch := &v1alpha3.HTTPMatchRequest{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}}
 
 		routeMasterDestination := &v1alpha3.HTTPRouteDestination{
 			Destination: &v1alpha3.Destination{
@@ -494,8 +915,11 @@ func Percentage(trackingId string, subset string, httpRoute []*v1alpha3.HTTPRout
 			},
 		}
 
-		routeMaster.Match = append(routeMaster.Match, routeMasterMatch)
+		routeMaster.Match = master.Match()
 		routeMaster.Route = append(routeMaster.Route, routeMasterDestination)
+		if len(s.Traffic.Weights) > 0 {
+			routeMaster.Route = Split(s)
+		}
 		httpRoute = append(httpRoute, routeMaster)
 	}
 
@@ -514,3 +938,18 @@ func ValidateVirtualServiceList(irl *IstioRouteList) error {
 
 	return nil
 }
+
+// SetDryRun makes the router print its changes as a diff instead of applying them
+func (v *VirtualService) SetDryRun(dryRun bool) {
+	v.DryRun = dryRun
+}
+
+// GetNamespace returns the namespace which the router operates at
+func (v *VirtualService) GetNamespace() string {
+	return v.Namespace
+}
+
+// SetNamespace binds the router to another namespace
+func (v *VirtualService) SetNamespace(namespace string) {
+	v.Namespace = namespace
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"istio.io/api/networking/v1alpha3"
 	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeFake "k8s.io/client-go/kubernetes/fake"
 	"testing"
@@ -398,6 +399,16 @@ func TestVirtualService_Clear_Soft_Integrated(t *testing.T) {
 	_, err = vs.KubeClient.AppsV1().Deployments(tvs.Namespace).Create(&depWithoutPods)
 	assert.NoError(t, err)
 
+	// routes are kept by their ready pods, so the pod which isn't ready yet doesn't keep its route
+	for _, pod := range []*corev1.Pod{
+		readyPod("api-test-with-deployments-a", tvs.Namespace, labels, true),
+		readyPod("api-test-with-deployments-b", tvs.Namespace, labels, true),
+		readyPod("api-test-without-deployments-a", tvs.Namespace, labelsNoPods, false),
+	} {
+		_, err = vs.KubeClient.CoreV1().Pods(tvs.Namespace).Create(pod)
+		assert.NoError(t, err)
+	}
+
 	// before the clear function there are two http routes
 	mockedVs, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(tvs.Name, metav1.GetOptions{})
 	assert.Equal(t, 3, len(mockedVs.Spec.Http))
@@ -515,6 +526,13 @@ func TestVirtualService_Clear_Soft_Integrated_WithPods(t *testing.T) {
 	// create a deployment with 2 pods to test a soft clear
 	_, err = vs.KubeClient.AppsV1().Deployments(tvs.Namespace).Create(&depWithPods)
 	assert.NoError(t, err)
+	for _, pod := range []*corev1.Pod{
+		readyPod("api-test-with-deployments-a", tvs.Namespace, labels, true),
+		readyPod("api-test-with-deployments-b", tvs.Namespace, labels, true),
+	} {
+		_, err = vs.KubeClient.CoreV1().Pods(tvs.Namespace).Create(pod)
+		assert.NoError(t, err)
+	}
 
 	// before the clear function there are two http routes
 	mockedVs, _ := fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(tvs.Name, metav1.GetOptions{})
@@ -813,7 +831,7 @@ func TestPercentage_Unit_EmptyRoute(t *testing.T) {
 
 	shift := Shift{}
 
-	_, err := Percentage("cid", "subset", emptyRouteList, shift)
+	_, err := Percentage("cid", "subset", emptyRouteList, shift, nil)
 	assert.EqualError(t, err, "empty routes")
 }
 
@@ -840,7 +858,7 @@ func TestPercentage_Unit_ExistentMasterRoute(t *testing.T) {
 		Traffic:  Traffic{},
 	}
 
-	routed, err := Percentage("unit-testing-uuid", "subset", routeList, shift)
+	routed, err := Percentage("unit-testing-uuid", "subset", routeList, shift, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, ".+", routed[0].Match[0].Uri.GetRegex())
 	assert.Equal(t, "existent-subset", routed[0].Route[0].Destination.Subset)
@@ -858,28 +876,28 @@ func TestPercentage_Unit_NewMasterRouteAgain(t *testing.T) {
 		Traffic:  Traffic{},
 	}
 
-	routed, err := Percentage("unit-testing-uuid", "new-subset", routeList, shift)
+	routed, err := Percentage("unit-testing-uuid", "new-subset", routeList, shift, nil)
 
 	assert.NoError(t, err)
 	assert.Equal(t, ".+", routed[1].Match[0].Uri.GetRegex())
 	assert.Equal(t, "new-subset", routed[1].Route[0].Destination.Subset)
 
-	routed, err = Percentage("unit-testing-uuid", "new-subset", routed, shift)
+	routed, err = Percentage("unit-testing-uuid", "new-subset", routed, shift, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, ".+", routed[1].Match[0].Uri.GetRegex())
 	assert.Equal(t, "new-subset", routed[1].Route[0].Destination.Subset)
 
-	routed, err = Percentage("unit-testing-uuid", "new-subset", routed, shift)
+	routed, err = Percentage("unit-testing-uuid", "new-subset", routed, shift, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, ".+", routed[1].Match[0].Uri.GetRegex())
 	assert.Equal(t, "new-subset", routed[1].Route[0].Destination.Subset)
 
-	routed, err = Percentage("unit-testing-uuid", "new-subset", routed, shift)
+	routed, err = Percentage("unit-testing-uuid", "new-subset", routed, shift, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, ".+", routed[1].Match[0].Uri.GetRegex())
 	assert.Equal(t, "new-subset", routed[1].Route[0].Destination.Subset)
 
-	routed, err = Percentage("unit-testing-uuid", "new-subset", routed, shift)
+	routed, err = Percentage("unit-testing-uuid", "new-subset", routed, shift, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, ".+", routed[1].Match[0].Uri.GetRegex())
 	assert.Equal(t, "new-subset", routed[1].Route[0].Destination.Subset)
@@ -897,7 +915,7 @@ func TestPercentage_Unit_NewMasterRoute(t *testing.T) {
 		Traffic:  Traffic{},
 	}
 
-	routed, err := Percentage("unit-testing-uuid", "new-subset", routeList, shift)
+	routed, err := Percentage("unit-testing-uuid", "new-subset", routeList, shift, nil)
 
 	assert.NoError(t, err)
 	assert.Equal(t, ".+", routed[1].Match[0].Uri.GetRegex())
@@ -934,7 +952,7 @@ func TestPercentage_Unit_MultipleMasterRoute(t *testing.T) {
 		Traffic:  Traffic{},
 	}
 
-	_, err := Percentage("unit-testing-uuid", "new-subset", routeList, shift)
+	_, err := Percentage("unit-testing-uuid", "new-subset", routeList, shift, nil)
 
 	assert.EqualError(t, err, "multiple master routes found")
 
@@ -1236,7 +1254,7 @@ func TestRemoveOutdatedRoutes_Unit_EmptyRoutes(t *testing.T) {
 
 	subsetName := fmt.Sprintf("%s-%v-%s", vs.Name, vs.Build, vs.Namespace)
 
-	cleanedHttpRoute, err := RemoveOutdatedRoutes(vs.TrackingId, subsetName, httpRoute)
+	cleanedHttpRoute, err := RemoveOutdatedRoutes(vs.TrackingId, subsetName, httpRoute, nil)
 
 	assert.EqualError(t, err, "got nil routes when removing outdated subsets")
 	assert.Equal(t, 0, len(cleanedHttpRoute))
@@ -1289,21 +1307,21 @@ func TestRemoveOutdatedRoutes_Unit(t *testing.T) {
 		Route: routeKept,
 	})
 
-	cleanedRoutes, err := RemoveOutdatedRoutes(vs.TrackingId, subsetName, httpRoute)
+	cleanedRoutes, err := RemoveOutdatedRoutes(vs.TrackingId, subsetName, httpRoute, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(cleanedRoutes))
 	assert.Equal(t, "subset-kept", cleanedRoutes[0].Route[0].Destination.Subset)
 	assert.Equal(t, ".+", cleanedRoutes[len(cleanedRoutes)-1].Match[0].Uri.GetRegex())
 
 	// testing idempotence
-	cleanedRoutes, err = RemoveOutdatedRoutes(vs.TrackingId, subsetName, cleanedRoutes)
+	cleanedRoutes, err = RemoveOutdatedRoutes(vs.TrackingId, subsetName, cleanedRoutes, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(cleanedRoutes))
 	assert.Equal(t, "subset-kept", cleanedRoutes[0].Route[0].Destination.Subset)
 	assert.Equal(t, ".+", cleanedRoutes[len(cleanedRoutes)-1].Match[0].Uri.GetRegex())
 
 	// testing idempotence
-	cleanedRoutes, err = RemoveOutdatedRoutes(vs.TrackingId, subsetName, cleanedRoutes)
+	cleanedRoutes, err = RemoveOutdatedRoutes(vs.TrackingId, subsetName, cleanedRoutes, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(cleanedRoutes))
 	assert.Equal(t, "subset-kept", cleanedRoutes[0].Route[0].Destination.Subset)
@@ -1378,47 +1396,20 @@ func TestVirtualService_Update_Integrated_NonExistentMasterRoute_Percentage(t *t
 	assert.Equal(t, fmt.Sprintf("%s-%v-%s", vs.Name, vs.Build, vs.Namespace), re.Spec.Http[0].Route[0].Destination.Subset)
 	assert.Equal(t, ".+", re.Spec.Http[len(re.Spec.Http)-1].Match[0].Uri.GetRegex())
 
-	// === idempotence check same rule
+	// === a master-route which already routes every request to the subset is kept as is
 
-	err = vs.Update(shift)
-	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
-
-	assert.NoError(t, err)
-	assert.Equal(t, 1, len(re.Spec.Http))
-	assert.Equal(t, 2, len(re.Spec.Http[0].Route))
-	assert.Equal(t, 1, len(re.Spec.Http[0].Match))
-	assert.Equal(t, fmt.Sprintf("%s-%v-%s", vs.Name, vs.Build, vs.Namespace), re.Spec.Http[0].Route[0].Destination.Subset)
-	assert.Equal(t, ".+", re.Spec.Http[len(re.Spec.Http)-1].Match[0].Uri.GetRegex())
-	assert.Equal(t, int32(50), re.Spec.Http[0].Route[0].Weight)
-	assert.Equal(t, int32(50), re.Spec.Http[0].Route[1].Weight)
-
-	// === third check same rule
-
-	err = vs.Update(shift)
-	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
-
-	assert.NoError(t, err)
-	assert.Equal(t, 1, len(re.Spec.Http))
-	assert.Equal(t, 2, len(re.Spec.Http[0].Route))
-	assert.Equal(t, 1, len(re.Spec.Http[0].Match))
-	assert.Equal(t, fmt.Sprintf("%s-%v-%s", vs.Name, vs.Build, vs.Namespace), re.Spec.Http[0].Route[0].Destination.Subset)
-	assert.Equal(t, ".+", re.Spec.Http[len(re.Spec.Http)-1].Match[0].Uri.GetRegex())
-	assert.Equal(t, int32(50), re.Spec.Http[0].Route[0].Weight)
-	assert.Equal(t, int32(50), re.Spec.Http[0].Route[1].Weight)
+	for _, weight := range []int32{50, 60} {
+		shift.Traffic.Weight = weight
+		err = vs.Update(shift)
+		re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
 
-	// == fourth check different percentage
-	shift.Traffic.Weight = 60
-	err = vs.Update(shift)
-	re, _ = fakeIstioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Get(v.Name, metav1.GetOptions{})
-
-	assert.NoError(t, err)
-	assert.Equal(t, 1, len(re.Spec.Http))
-	assert.Equal(t, 2, len(re.Spec.Http[0].Route))
-	assert.Equal(t, 1, len(re.Spec.Http[0].Match))
-	assert.Equal(t, fmt.Sprintf("%s-%v-%s", vs.Name, vs.Build, vs.Namespace), re.Spec.Http[0].Route[0].Destination.Subset)
-	assert.Equal(t, ".+", re.Spec.Http[len(re.Spec.Http)-1].Match[0].Uri.GetRegex())
-	assert.Equal(t, int32(40), re.Spec.Http[0].Route[0].Weight)
-	assert.Equal(t, int32(60), re.Spec.Http[0].Route[1].Weight)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(re.Spec.Http))
+		assert.Equal(t, 1, len(re.Spec.Http[0].Route))
+		assert.Equal(t, 1, len(re.Spec.Http[0].Match))
+		assert.Equal(t, fmt.Sprintf("%s-%v-%s", vs.Name, vs.Build, vs.Namespace), re.Spec.Http[0].Route[0].Destination.Subset)
+		assert.Equal(t, ".+", re.Spec.Http[len(re.Spec.Http)-1].Match[0].Uri.GetRegex())
+	}
 }
 
 func TestVirtualService_List_Integrated(t *testing.T) {
@@ -1553,3 +1544,115 @@ func TestVirtualService_Create_Unit_HeadersAndWeight_Regexp(t *testing.T) {
 	assert.Equal(t, "^some@.+.com", ir.MatchDestination.Match[0].Headers["x-email"].GetRegex())
 
 }
+
+func TestVirtualService_Create_Unit_MatchCriteria(t *testing.T) {
+	vs := VirtualService{
+		TrackingId: "unit-testing-uuid",
+		Name:       "api-testing",
+		Namespace:  "integration",
+		Build:      4,
+	}
+
+	shift := Shift{
+		Port:     8080,
+		Hostname: "myHostname",
+		Traffic: Traffic{
+			UriPrefix:    "/v2",
+			Method:       "post",
+			SourceLabels: map[string]string{"app": "frontend"},
+			Gateways:     []string{"public-gateway"},
+			Exact:        true,
+		},
+	}
+
+	ir, err := vs.Create(shift)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-testing-4-integration", ir.MatchDestination.Route[0].Destination.Subset)
+	assert.Equal(t, 0, len(ir.MatchDestination.Match[0].Headers))
+	assert.Equal(t, "/v2", ir.MatchDestination.Match[0].Uri.GetPrefix())
+	assert.Equal(t, "POST", ir.MatchDestination.Match[0].Method.GetExact())
+	assert.Equal(t, map[string]string{"app": "frontend"}, ir.MatchDestination.Match[0].SourceLabels)
+	assert.Equal(t, []string{"public-gateway"}, ir.MatchDestination.Match[0].Gateways)
+
+	shift.Traffic = Traffic{UriRegex: "^/v[2-3]/.*", Exact: true}
+	ir, err = vs.Create(shift)
+	assert.NoError(t, err)
+	assert.Equal(t, "^/v[2-3]/.*", ir.MatchDestination.Match[0].Uri.GetRegex())
+	assert.Nil(t, ir.MatchDestination.Match[0].Method)
+
+	// gateways only restrict a route, they are not enough to match a canary
+	shift.Traffic = Traffic{Gateways: []string{"public-gateway"}, Exact: true}
+	_, err = vs.Create(shift)
+	assert.EqualError(t, err, "can't create a new route without request header's match")
+}
+
+func TestVirtualService_Validate_Unit_MatchCriteria(t *testing.T) {
+	vs := VirtualService{}
+
+	err := vs.Validate(Shift{Traffic: Traffic{UriPrefix: "/v2", UriRegex: "/v2.*"}})
+	assert.EqualError(t, err, "a route can't match both 'uri prefix' and 'uri regex'")
+
+	err = vs.Validate(Shift{Traffic: Traffic{UriRegex: ".+"}})
+	assert.EqualError(t, err, "uri regex '.+' is reserved to the master-route")
+
+	err = vs.Validate(Shift{Traffic: Traffic{Method: "GET", Weight: 10}})
+	assert.EqualError(t, err, "a route needs to be served with a 'weight' or 'request headers', not both")
+
+	err = vs.Validate(Shift{Traffic: Traffic{SourceLabels: map[string]string{"app": "frontend"}}})
+	assert.NoError(t, err)
+}
+
+func TestVirtualService_Clear_Integrated_HardUriPrefix(t *testing.T) {
+	istioClient := istioFake.NewSimpleClientset()
+	selector := map[string]string{"app": "api"}
+
+	v := v1alpha32.VirtualService{}
+	v.Name = "api-virtualservice"
+	v.Namespace = "default"
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}}},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api", Subset: "api-1-default"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{}
+	d.Name = "api-destinationrule"
+	d.Namespace = "default"
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-1-default", Labels: map[string]string{"app": "api", "build": "1"}},
+	}
+
+	_, _ = istioClient.NetworkingV1alpha3().VirtualServices(v.Namespace).Create(&v)
+	_, _ = istioClient.NetworkingV1alpha3().DestinationRules(d.Namespace).Create(&d)
+
+	drR := &DestinationRule{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient}
+	vsR := &VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient}
+
+	shift := Shift{
+		Port:     5000,
+		Hostname: "api",
+		Selector: selector,
+		Traffic: Traffic{
+			PodSelector: map[string]string{"app": "api", "build": "2"},
+			UriPrefix:   "/v2",
+		},
+	}
+	assert.NoError(t, drR.Update(shift))
+	assert.NoError(t, vsR.Update(shift))
+
+	vs, _ := istioClient.NetworkingV1alpha3().VirtualServices("default").Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 2, len(vs.Spec.Http))
+	assert.Equal(t, "/v2", vs.Spec.Http[0].Match[0].Uri.GetPrefix())
+
+	// routes matching an uri prefix are removed as any other canary route
+	assert.NoError(t, vsR.Clear(Shift{Selector: selector}, "hard"))
+
+	vs, _ = istioClient.NetworkingV1alpha3().VirtualServices("default").Get(v.Name, metav1.GetOptions{})
+	assert.Equal(t, 1, len(vs.Spec.Http))
+	assert.Equal(t, ".+", vs.Spec.Http[0].Match[0].Uri.GetRegex())
+}
@@ -0,0 +1,174 @@
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// WorkloadKind lists the workloads of a kind which are matched by a label-selector, so subsets can be backed by any
+// kind of workload
+type WorkloadKind interface {
+	Kind() string
+	List(kubeClient KubeClientInterface, namespace string, labelSelector string) ([]Workload, error)
+}
+
+// Workload is a workload which manages the pods of a subset
+type Workload struct {
+	Kind      string
+	Name      string
+	Namespace string
+	// Ready is the number of ready replicas reported by the workload's status
+	Ready int32
+}
+
+// String returns the workload as '<kind>/<name>'
+func (w Workload) String() string {
+	return fmt.Sprintf("%s/%s", w.Kind, w.Name)
+}
+
+// WorkloadKinds are the kinds of workloads looked up for subsets, other kinds can be appended to it
+var WorkloadKinds = []WorkloadKind{Deployments{}, StatefulSets{}, DaemonSets{}, ReplicaSets{}}
+
+// Workloads returns the workloads of every kind of WorkloadKinds matched by labels at a namespace
+func Workloads(trackingId string, kubeClient KubeClientInterface, namespace string, labels map[string]string) ([]Workload, error) {
+	labelSelector, err := Stringify(trackingId, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	var workloads []Workload
+	for _, kind := range WorkloadKinds {
+		listed, err := kind.List(kubeClient, namespace, labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(listed, func(i, j int) bool { return listed[i].Name < listed[j].Name })
+
+		workloads = append(workloads, listed...)
+	}
+
+	return workloads, nil
+}
+
+// JoinWorkloads returns workloads as a comma-separated list, along with their ready replicas
+func JoinWorkloads(workloads []Workload) string {
+	var names []string
+	for _, workload := range workloads {
+		names = append(names, fmt.Sprintf("%s (%d ready)", workload, workload.Ready))
+	}
+
+	return strings.Join(names, ",")
+}
+
+// listWorkloads lists the workloads of a kind matched by a label-selector, reading the ready replicas of each listed
+// item through ready, which skips the items it doesn't return as a workload of the kind
+func listWorkloads(kind string, labelSelector string, list func(metav1.ListOptions) (runtime.Object, error), ready func(runtime.Object) (int32, bool)) ([]Workload, error) {
+	listed, err := list(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := meta.ExtractList(listed)
+	if err != nil {
+		return nil, err
+	}
+
+	var workloads []Workload
+	for _, item := range items {
+		readyReplicas, ok := ready(item)
+		if !ok {
+			continue
+		}
+
+		object, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+
+		workloads = append(workloads, Workload{Kind: kind, Name: object.GetName(), Namespace: object.GetNamespace(), Ready: readyReplicas})
+	}
+
+	return workloads, nil
+}
+
+// Deployments is the kind of apps/v1 deployments
+type Deployments struct{}
+
+// Kind returns 'Deployment'
+func (Deployments) Kind() string {
+	return "Deployment"
+}
+
+// List returns the deployments matched by a label-selector at a namespace
+func (d Deployments) List(kubeClient KubeClientInterface, namespace string, labelSelector string) ([]Workload, error) {
+	return listWorkloads(d.Kind(), labelSelector, func(options metav1.ListOptions) (runtime.Object, error) {
+		return kubeClient.AppsV1().Deployments(namespace).List(options)
+	}, func(item runtime.Object) (int32, bool) {
+		return item.(*appsv1.Deployment).Status.ReadyReplicas, true
+	})
+}
+
+// StatefulSets is the kind of apps/v1 statefulSets
+type StatefulSets struct{}
+
+// Kind returns 'StatefulSet'
+func (StatefulSets) Kind() string {
+	return "StatefulSet"
+}
+
+// List returns the statefulSets matched by a label-selector at a namespace
+func (ss StatefulSets) List(kubeClient KubeClientInterface, namespace string, labelSelector string) ([]Workload, error) {
+	return listWorkloads(ss.Kind(), labelSelector, func(options metav1.ListOptions) (runtime.Object, error) {
+		return kubeClient.AppsV1().StatefulSets(namespace).List(options)
+	}, func(item runtime.Object) (int32, bool) {
+		return item.(*appsv1.StatefulSet).Status.ReadyReplicas, true
+	})
+}
+
+// DaemonSets is the kind of apps/v1 daemonSets
+type DaemonSets struct{}
+
+// Kind returns 'DaemonSet'
+func (DaemonSets) Kind() string {
+	return "DaemonSet"
+}
+
+// List returns the daemonSets matched by a label-selector at a namespace
+func (ds DaemonSets) List(kubeClient KubeClientInterface, namespace string, labelSelector string) ([]Workload, error) {
+	return listWorkloads(ds.Kind(), labelSelector, func(options metav1.ListOptions) (runtime.Object, error) {
+		return kubeClient.AppsV1().DaemonSets(namespace).List(options)
+	}, func(item runtime.Object) (int32, bool) {
+		return item.(*appsv1.DaemonSet).Status.NumberReady, true
+	})
+}
+
+// ReplicaSets is the kind of apps/v1 replicaSets which aren't managed by a deployment, as the ones of Argo Rollouts
+type ReplicaSets struct{}
+
+// Kind returns 'ReplicaSet'
+func (ReplicaSets) Kind() string {
+	return "ReplicaSet"
+}
+
+// List returns the replicaSets matched by a label-selector at a namespace, leaving out the ones of deployments
+func (rs ReplicaSets) List(kubeClient KubeClientInterface, namespace string, labelSelector string) ([]Workload, error) {
+	return listWorkloads(rs.Kind(), labelSelector, func(options metav1.ListOptions) (runtime.Object, error) {
+		return kubeClient.AppsV1().ReplicaSets(namespace).List(options)
+	}, func(item runtime.Object) (int32, bool) {
+		replicaSet := item.(*appsv1.ReplicaSet)
+
+		// replicaSets of deployments share their labels, they're already listed as the deployment itself
+		owner := metav1.GetControllerOf(replicaSet)
+		if owner != nil && owner.Kind == "Deployment" {
+			return 0, false
+		}
+
+		return replicaSet.Status.ReadyReplicas, true
+	})
+}
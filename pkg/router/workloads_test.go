@@ -0,0 +1,71 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeWorkloads struct{}
+
+func (fakeWorkloads) Kind() string {
+	return "Rollout"
+}
+
+func (fakeWorkloads) List(kubeClient KubeClientInterface, namespace string, labelSelector string) ([]Workload, error) {
+	return []Workload{{Kind: "Rollout", Name: "api-2", Namespace: namespace, Ready: 1}}, nil
+}
+
+func TestWorkloads_Unit(t *testing.T) {
+	build2 := map[string]string{"app": "api", "build": "2"}
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default", Labels: build2}
+	}
+
+	// replicaSets of a deployment are left out, while others (as Argo Rollouts' ones) are kept
+	deploymentRs := &appsv1.ReplicaSet{ObjectMeta: meta("api-2-7d9f8")}
+	controller := true
+	deploymentRs.OwnerReferences = []metav1.OwnerReference{{Kind: "Deployment", Name: "api-2", Controller: &controller}}
+
+	deployment := &appsv1.Deployment{ObjectMeta: meta("api-2")}
+	deployment.Status.ReadyReplicas = 2
+	daemonSet := &appsv1.DaemonSet{ObjectMeta: meta("api-2-agent")}
+	daemonSet.Status.NumberReady = 3
+
+	kubeClient := kubeFake.NewSimpleClientset(
+		deployment,
+		deploymentRs,
+		&appsv1.ReplicaSet{ObjectMeta: meta("api-2-rollout")},
+		&appsv1.StatefulSet{ObjectMeta: meta("api-2-db")},
+		daemonSet,
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "api-3", Namespace: "default", Labels: map[string]string{"app": "api", "build": "3"}}},
+	)
+
+	workloads, err := Workloads("unit-testing-uuid", kubeClient, "default", build2)
+	assert.NoError(t, err)
+	assert.Equal(t, []Workload{
+		{Kind: "Deployment", Name: "api-2", Namespace: "default", Ready: 2},
+		{Kind: "StatefulSet", Name: "api-2-db", Namespace: "default"},
+		{Kind: "DaemonSet", Name: "api-2-agent", Namespace: "default", Ready: 3},
+		{Kind: "ReplicaSet", Name: "api-2-rollout", Namespace: "default"},
+	}, workloads)
+	assert.Equal(t, "Deployment/api-2 (2 ready),StatefulSet/api-2-db (0 ready),DaemonSet/api-2-agent (3 ready),ReplicaSet/api-2-rollout (0 ready)", JoinWorkloads(workloads))
+
+	workloads, err = Workloads("unit-testing-uuid", kubeClient, "default", map[string]string{"build": "4"})
+	assert.NoError(t, err)
+	assert.Empty(t, workloads)
+}
+
+func TestWorkloads_Unit_Pluggable(t *testing.T) {
+	defaultKinds := WorkloadKinds
+	defer func() { WorkloadKinds = defaultKinds }()
+
+	WorkloadKinds = append(WorkloadKinds, fakeWorkloads{})
+
+	workloads, err := Workloads("unit-testing-uuid", kubeFake.NewSimpleClientset(), "default", map[string]string{"build": "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Workload{{Kind: "Rollout", Name: "api-2", Namespace: "default", Ready: 1}}, workloads)
+}
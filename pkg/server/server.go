@@ -0,0 +1,327 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/operator"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pismo/istiops/pkg/view"
+	"github.com/pkg/errors"
+)
+
+// ShiftRequest is the body of a shift, the same as router.Shift plus the routers' attributes
+type ShiftRequest struct {
+	router.Shift
+	Namespace   string
+	Build       uint32
+	MasterRoute string
+}
+
+// ClearRequest is the body of a clear of the resources matched by Selector
+type ClearRequest struct {
+	Namespace string
+	Selector  map[string]string
+	// Mode is 'soft' (default) or 'hard'
+	Mode        string
+	MasterRoute string
+}
+
+const (
+	// ReadTimeout bounds the time to read a whole request, including its body
+	ReadTimeout = 10 * time.Second
+	// WriteTimeout bounds the time to reply a request, which includes the operation (ex: a shift with its retries)
+	WriteTimeout = 2 * time.Minute
+	// IdleTimeout bounds the time which keep-alive connections wait for the next request
+	IdleTimeout = 2 * time.Minute
+)
+
+// TrackingIdHeader is the header of requests which carries their tracking id, replied by every response as well. A
+// new one is generated for requests which don't send it
+const TrackingIdHeader = "X-Tracking-Id"
+
+// trackingIdPattern restricts the tracking ids sent by clients, as they're written to logs and audit records
+var trackingIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error string
+}
+
+// Server exposes Get, Update and Clear of the Operator over a REST API authenticated by a bearer token.
+// Every request replies the structured view of istio's resources, the same as 'show -o json'.
+type Server struct {
+	// TrackingId of the server's own logs, each request has its own one
+	TrackingId string
+	// Token which every request must send at the 'Authorization: Bearer <token>' header
+	Token      string
+	Istio      router.IstioClientInterface
+	KubeClient router.KubeClientInterface
+	// Audit of the changes requested through the API
+	Audit router.Audit
+	// TLSCert & TLSKey are the files of the certificate which the API is served with, it's only served without TLS
+	// at loopback addresses
+	TLSCert string
+	TLSKey  string
+}
+
+// Handler returns the routes of the API:
+//
+//	GET  /v1/routes?namespace=<namespace>&label-selector=<selector>
+//	POST /v1/shift (ShiftRequest)
+//	POST /v1/clear (ClearRequest)
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/routes", s.authenticated(http.MethodGet, s.routes))
+	mux.HandleFunc("/v1/shift", s.authenticated(http.MethodPost, s.shift))
+	mux.HandleFunc("/v1/clear", s.authenticated(http.MethodPost, s.clear))
+
+	return mux
+}
+
+// ListenAndServe serves the API at the given address (ex: '127.0.0.1:8080'), with TLS when a certificate is given
+func (s *Server) ListenAndServe(address string) error {
+	if s.Token == "" {
+		return errors.New("an empty token is not allowed")
+	}
+
+	if (s.TLSCert == "") != (s.TLSKey == "") {
+		return errors.New("both TLS certificate and key must be given")
+	}
+
+	server := s.httpServer(address)
+
+	if s.TLSCert != "" {
+		logger.Info(fmt.Sprintf("Serving istiops API with TLS at '%s'", address), s.TrackingId)
+		return server.ListenAndServeTLS(s.TLSCert, s.TLSKey)
+	}
+
+	// bearer tokens would be sent in plain text over the network
+	if !loopback(address) {
+		return errors.New(fmt.Sprintf("refusing to serve at non-loopback address '%s' without TLS", address))
+	}
+
+	logger.Info(fmt.Sprintf("Serving istiops API at '%s'", address), s.TrackingId)
+
+	return server.ListenAndServe()
+}
+
+// httpServer returns the http server of the API, bounding the time of requests and idle connections
+func (s *Server) httpServer(address string) *http.Server {
+	return &http.Server{
+		Addr:         address,
+		Handler:      s.Handler(),
+		ReadTimeout:  ReadTimeout,
+		WriteTimeout: WriteTimeout,
+		IdleTimeout:  IdleTimeout,
+	}
+}
+
+// loopback returns whether an address only listens to the loopback interface ('localhost', '127.0.0.1' or '::1')
+func loopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// handler serves a request along with its tracking id
+type handler func(w http.ResponseWriter, r *http.Request, trackingId string)
+
+func (s *Server) authenticated(method string, handler handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trackingId := s.trackingId(r)
+		w.Header().Set(TrackingIdHeader, trackingId)
+
+		authorization := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		if s.Token == "" || !strings.HasPrefix(authorization, "Bearer ") || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			reply(w, http.StatusUnauthorized, ErrorResponse{Error: "invalid or missing bearer token"})
+			return
+		}
+
+		if r.Method != method {
+			reply(w, http.StatusMethodNotAllowed, ErrorResponse{Error: fmt.Sprintf("method '%s' is not allowed, must be '%s'", r.Method, method)})
+			return
+		}
+
+		handler(w, r, trackingId)
+	}
+}
+
+// trackingId returns the tracking id sent by a request, or a new one so concurrent requests are told apart at logs
+// and audit records
+func (s *Server) trackingId(r *http.Request) string {
+	trackingId := r.Header.Get(TrackingIdHeader)
+	if trackingIdPattern.MatchString(trackingId) {
+		return trackingId
+	}
+
+	tracking, err := uuid.NewUUID()
+	if err != nil {
+		logger.Warn(fmt.Sprintf("could not generate a tracking id: %s", err), s.TrackingId)
+		return s.TrackingId
+	}
+
+	return tracking.String()
+}
+
+func (s *Server) routes(w http.ResponseWriter, r *http.Request, trackingId string) {
+	namespace := namespaceOrDefault(r.URL.Query().Get("namespace"))
+
+	selector, err := router.Mapify(trackingId, r.URL.Query().Get("label-selector"))
+	if err != nil {
+		reply(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("%s", err)})
+		return
+	}
+
+	op := s.operator(trackingId, namespace, "", 0, nil)
+	s.view(w, op, selector, trackingId)
+}
+
+func (s *Server) shift(w http.ResponseWriter, r *http.Request, trackingId string) {
+	request := ShiftRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		reply(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("could not parse shift request: %s", err)})
+		return
+	}
+
+	if request.Hostname == "" || request.Port == 0 || request.Build == 0 || len(request.Selector) == 0 || len(request.Traffic.PodSelector) == 0 {
+		reply(w, http.StatusBadRequest, ErrorResponse{Error: "Hostname, Port, Build, Selector and Traffic.PodSelector are required"})
+		return
+	}
+
+	masterRoute, err := router.ParseMasterRoute(request.MasterRoute)
+	if err != nil {
+		reply(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("%s", err)})
+		return
+	}
+
+	namespace := namespaceOrDefault(request.Namespace)
+	op := s.operator(trackingId, namespace, request.Hostname, request.Build, masterRoute)
+
+	logger.Info(fmt.Sprintf("Shifting traffic of '%s' to build '%d' at namespace '%s'", request.Hostname, request.Build, namespace), trackingId)
+	err = op.Update(request.Shift)
+	if err != nil {
+		reply(w, http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("%s", err)})
+		return
+	}
+
+	s.view(w, op, request.Selector, trackingId)
+}
+
+func (s *Server) clear(w http.ResponseWriter, r *http.Request, trackingId string) {
+	request := ClearRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		reply(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("could not parse clear request: %s", err)})
+		return
+	}
+
+	if len(request.Selector) == 0 {
+		reply(w, http.StatusBadRequest, ErrorResponse{Error: "Selector is required"})
+		return
+	}
+
+	if request.Mode == "" {
+		request.Mode = "soft"
+	}
+
+	if request.Mode != "soft" && request.Mode != "hard" {
+		reply(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("clear mode '%s' must be 'soft' or 'hard'", request.Mode)})
+		return
+	}
+
+	masterRoute, err := router.ParseMasterRoute(request.MasterRoute)
+	if err != nil {
+		reply(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("%s", err)})
+		return
+	}
+
+	namespace := namespaceOrDefault(request.Namespace)
+	op := s.operator(trackingId, namespace, "", 0, masterRoute)
+
+	logger.Info(fmt.Sprintf("Clearing routes of namespace '%s' with mode '%s'", namespace, request.Mode), trackingId)
+	err = op.Clear(router.Shift{Selector: request.Selector}, request.Mode)
+	if err != nil {
+		reply(w, http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("%s", err)})
+		return
+	}
+
+	s.view(w, op, request.Selector, trackingId)
+}
+
+// view replies the structured view of the resources matched by selector
+func (s *Server) view(w http.ResponseWriter, op operator.Operator, selector map[string]string, trackingId string) {
+	irl, err := op.Get(selector)
+	if err != nil {
+		reply(w, http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("%s", err)})
+		return
+	}
+
+	resourceList := view.Structured(trackingId, irl, s.KubeClient)
+	if resourceList == nil {
+		resourceList = []view.Resource{}
+	}
+
+	reply(w, http.StatusOK, resourceList)
+}
+
+func (s *Server) operator(trackingId string, namespace string, hostname string, build uint32, masterRoute router.MasterRoute) operator.Operator {
+	return &operator.Istiops{
+		DrRouter: &router.DestinationRule{
+			TrackingId: trackingId,
+			Name:       hostname,
+			Namespace:  namespace,
+			Build:      build,
+			Istio:      s.Istio,
+			KubeClient: s.KubeClient,
+			Audit:      s.Audit,
+		},
+		VsRouter: &router.VirtualService{
+			TrackingId:  trackingId,
+			Name:        hostname,
+			Namespace:   namespace,
+			Build:       build,
+			Istio:       s.Istio,
+			KubeClient:  s.KubeClient,
+			Audit:       s.Audit,
+			MasterRoute: masterRoute,
+		},
+	}
+}
+
+func namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return "default"
+	}
+
+	return namespace
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		logger.Error(fmt.Sprintf("could not write response: %s", err), "server")
+	}
+}
@@ -0,0 +1,357 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pismo/istiops/pkg/view"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMain(m *testing.M) {
+	// discard stdout logs if not being run with '-v' flag
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// resource is the part of view.Resource asserted by tests, as istio's match types can't be unmarshalled
+type resource struct {
+	Name   string
+	Routes []struct {
+		Master       bool
+		Destinations []view.Destination
+	}
+}
+
+func fakeServer() *Server {
+	istioClient := istioFake.NewSimpleClientset()
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = "integration"
+	v.Labels = selector
+	v.Spec.Hosts = []string{"api-service"}
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-service-1-integration"}},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = "integration"
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-service-1-integration", Labels: map[string]string{"app": "api", "build": "1"}},
+	}
+
+	_, _ = istioClient.NetworkingV1alpha3().VirtualServices(v.Namespace).Create(&v)
+	_, _ = istioClient.NetworkingV1alpha3().DestinationRules(d.Namespace).Create(&d)
+
+	return &Server{
+		TrackingId: "unit-testing-uuid",
+		Token:      "s3cr3t",
+		Istio:      istioClient,
+		KubeClient: kubeFake.NewSimpleClientset(),
+	}
+}
+
+func request(t *testing.T, s *Server, method string, url string, token string, body interface{}) *httptest.ResponseRecorder {
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		assert.NoError(t, err)
+	}
+
+	r := httptest.NewRequest(method, url, bytes.NewReader(b))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+
+	return w
+}
+
+func TestServer_Integrated_Routes(t *testing.T) {
+	s := fakeServer()
+
+	w := request(t, s, http.MethodGet, "/v1/routes?namespace=integration&label-selector=environment=integration-tests", "s3cr3t", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var resourceList []resource
+	err := json.Unmarshal(w.Body.Bytes(), &resourceList)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(resourceList))
+	assert.Equal(t, "integration-test-virtualservice", resourceList[0].Name)
+	assert.Equal(t, true, resourceList[0].Routes[0].Master)
+	assert.Equal(t, "api-service-1-integration", resourceList[0].Routes[0].Destinations[0].Subset.Name)
+}
+
+func TestServer_Integrated_ShiftAndClear(t *testing.T) {
+	s := fakeServer()
+
+	shift := ShiftRequest{
+		Shift: router.Shift{
+			Port:     5000,
+			Hostname: "api-service",
+			Selector: map[string]string{"environment": "integration-tests"},
+			Traffic: router.Traffic{
+				PodSelector:    map[string]string{"app": "api", "build": "2"},
+				RequestHeaders: map[string]string{"x-version": "2"},
+				Exact:          true,
+			},
+		},
+		Namespace: "integration",
+		Build:     2,
+	}
+
+	w := request(t, s, http.MethodPost, "/v1/shift", "s3cr3t", shift)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resourceList []resource
+	err := json.Unmarshal(w.Body.Bytes(), &resourceList)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(resourceList[0].Routes))
+	assert.Equal(t, "api-service-2-integration", resourceList[0].Routes[0].Destinations[0].Subset.Name)
+
+	// build 2 has no pods, so a soft clear removes its route
+	w = request(t, s, http.MethodPost, "/v1/clear", "s3cr3t", ClearRequest{
+		Namespace: "integration",
+		Selector:  map[string]string{"environment": "integration-tests"},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	resourceList = nil
+	err = json.Unmarshal(w.Body.Bytes(), &resourceList)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(resourceList[0].Routes))
+	assert.Equal(t, true, resourceList[0].Routes[0].Master)
+}
+
+func TestServer_Unit_ErrorCases(t *testing.T) {
+	failureCases := []struct {
+		method string
+		url    string
+		token  string
+		body   interface{}
+		status int
+		err    string
+	}{
+		{
+			http.MethodGet,
+			"/v1/routes?label-selector=environment=integration-tests",
+			"",
+			nil,
+			http.StatusUnauthorized,
+			"invalid or missing bearer token",
+		},
+		{
+			http.MethodGet,
+			"/v1/routes?label-selector=environment=integration-tests",
+			"wrong",
+			nil,
+			http.StatusUnauthorized,
+			"invalid or missing bearer token",
+		},
+		{
+			http.MethodPost,
+			"/v1/routes",
+			"s3cr3t",
+			nil,
+			http.StatusMethodNotAllowed,
+			"method 'POST' is not allowed, must be 'GET'",
+		},
+		{
+			http.MethodGet,
+			"/v1/routes",
+			"s3cr3t",
+			nil,
+			http.StatusBadRequest,
+			"got an empty labelSelector string",
+		},
+		{
+			http.MethodPost,
+			"/v1/shift",
+			"s3cr3t",
+			ShiftRequest{Build: 2},
+			http.StatusBadRequest,
+			"Hostname, Port, Build, Selector and Traffic.PodSelector are required",
+		},
+		{
+			http.MethodPost,
+			"/v1/shift",
+			"s3cr3t",
+			ShiftRequest{
+				Shift: router.Shift{
+					Port:     5000,
+					Hostname: "api-service",
+					Selector: map[string]string{"environment": "integration-tests"},
+					Traffic:  router.Traffic{PodSelector: map[string]string{"app": "api"}, RequestHeaders: map[string]string{"x-version": "2"}},
+				},
+				Build:       2,
+				MasterRoute: "named",
+			},
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			http.MethodPost,
+			"/v1/clear",
+			"s3cr3t",
+			ClearRequest{Selector: map[string]string{"environment": "integration-tests"}, Mode: "all"},
+			http.StatusBadRequest,
+			"clear mode 'all' must be 'soft' or 'hard'",
+		},
+		{
+			http.MethodPost,
+			"/v1/clear",
+			"s3cr3t",
+			ClearRequest{Namespace: "integration", Selector: map[string]string{"environment": "nonexistent"}},
+			http.StatusInternalServerError,
+			"",
+		},
+	}
+
+	for _, tt := range failureCases {
+		s := fakeServer()
+
+		w := request(t, s, tt.method, tt.url, tt.token, tt.body)
+		assert.Equal(t, tt.status, w.Code, tt.url)
+
+		response := ErrorResponse{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, response.Error)
+		if tt.err != "" {
+			assert.Equal(t, tt.err, response.Error)
+		}
+	}
+}
+
+func TestServer_Unit_ListenAndServeWithoutToken(t *testing.T) {
+	s := &Server{}
+
+	err := s.ListenAndServe(":0")
+	assert.EqualError(t, err, "an empty token is not allowed")
+}
+
+func TestServer_Unit_ListenAndServeWithoutTLS(t *testing.T) {
+	failureCases := []struct {
+		server  *Server
+		address string
+		err     string
+	}{
+		{&Server{Token: "s3cr3t"}, ":8080", "refusing to serve at non-loopback address ':8080' without TLS"},
+		{&Server{Token: "s3cr3t"}, "10.0.0.1:8080", "refusing to serve at non-loopback address '10.0.0.1:8080' without TLS"},
+		{&Server{Token: "s3cr3t", TLSCert: "tls.crt"}, "127.0.0.1:8080", "both TLS certificate and key must be given"},
+	}
+
+	for _, tt := range failureCases {
+		err := tt.server.ListenAndServe(tt.address)
+		assert.EqualError(t, err, tt.err)
+	}
+
+	assert.True(t, loopback("127.0.0.1:8080"))
+	assert.True(t, loopback("[::1]:8080"))
+	assert.True(t, loopback("localhost:8080"))
+	assert.False(t, loopback("0.0.0.0:8080"))
+}
+
+func TestServer_Unit_HttpServer(t *testing.T) {
+	server := fakeServer().httpServer("127.0.0.1:8080")
+
+	assert.Equal(t, ReadTimeout, server.ReadTimeout)
+	assert.Equal(t, WriteTimeout, server.WriteTimeout)
+	assert.Equal(t, IdleTimeout, server.IdleTimeout)
+}
+
+func TestServer_Unit_BearerPrefix(t *testing.T) {
+	s := fakeServer()
+
+	// the token must be sent as a bearer one
+	r := httptest.NewRequest(http.MethodGet, "/v1/routes?namespace=integration&label-selector=environment=integration-tests", nil)
+	r.Header.Set("Authorization", "s3cr3t")
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestServer_Integrated_TrackingId(t *testing.T) {
+	s := fakeServer()
+
+	shift := ShiftRequest{
+		Shift: router.Shift{
+			Port:     5000,
+			Hostname: "api-service",
+			Selector: map[string]string{"environment": "integration-tests"},
+			Traffic: router.Traffic{
+				PodSelector:    map[string]string{"app": "api", "build": "2"},
+				RequestHeaders: map[string]string{"x-version": "2"},
+				Exact:          true,
+			},
+		},
+		Namespace: "integration",
+		Build:     2,
+	}
+
+	// every request has its own tracking id
+	first := request(t, s, http.MethodGet, "/v1/routes?namespace=integration&label-selector=environment=integration-tests", "s3cr3t", nil)
+	w := request(t, s, http.MethodPost, "/v1/shift", "s3cr3t", shift)
+	assert.Equal(t, http.StatusOK, w.Code)
+	trackingId := w.Header().Get(TrackingIdHeader)
+	assert.NotEmpty(t, trackingId)
+	assert.NotEqual(t, s.TrackingId, trackingId)
+	assert.NotEqual(t, first.Header().Get(TrackingIdHeader), trackingId)
+
+	vs, _ := s.Istio.NetworkingV1alpha3().VirtualServices("integration").Get("integration-test-virtualservice", metav1.GetOptions{})
+	records, err := router.AuditTrail(vs.ObjectMeta)
+	assert.NoError(t, err)
+	assert.Equal(t, trackingId, records[len(records)-1].TrackingId)
+
+	// a tracking id sent by the client is kept, unless it's malformed
+	b, _ := json.Marshal(ClearRequest{Namespace: "integration", Selector: map[string]string{"environment": "integration-tests"}})
+	r := httptest.NewRequest(http.MethodPost, "/v1/clear", bytes.NewReader(b))
+	r.Header.Set("Authorization", "Bearer s3cr3t")
+	r.Header.Set(TrackingIdHeader, "pipeline-42")
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pipeline-42", w.Header().Get(TrackingIdHeader))
+
+	vs, _ = s.Istio.NetworkingV1alpha3().VirtualServices("integration").Get("integration-test-virtualservice", metav1.GetOptions{})
+	records, err = router.AuditTrail(vs.ObjectMeta)
+	assert.NoError(t, err)
+	assert.Equal(t, "pipeline-42", records[len(records)-1].TrackingId)
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/routes?namespace=integration&label-selector=environment=integration-tests", nil)
+	r.Header.Set("Authorization", "Bearer s3cr3t")
+	r.Header.Set(TrackingIdHeader, "bad\nid")
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	assert.NotEqual(t, "bad\nid", w.Header().Get(TrackingIdHeader))
+	assert.NotEmpty(t, w.Header().Get(TrackingIdHeader))
+}
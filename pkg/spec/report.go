@@ -0,0 +1,80 @@
+package spec
+
+import (
+	"fmt"
+
+	"github.com/pismo/istiops/pkg/router"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Change is the unified diff of a resource changed by an apply
+type Change struct {
+	Resource string
+	Diff     string
+}
+
+type resourceState struct {
+	kind string
+	meta metav1.ObjectMeta
+	spec interface{}
+}
+
+func states(irl router.IstioRouteList) []resourceState {
+	var resources []resourceState
+
+	if irl.DList != nil {
+		for i := range irl.DList.Items {
+			dr := &irl.DList.Items[i]
+			resources = append(resources, resourceState{"DestinationRule", unaudited(dr.ObjectMeta), &dr.Spec})
+		}
+	}
+
+	if irl.VList != nil {
+		for i := range irl.VList.Items {
+			vs := &irl.VList.Items[i]
+			resources = append(resources, resourceState{"VirtualService", unaudited(vs.ObjectMeta), &vs.Spec})
+		}
+	}
+
+	return resources
+}
+
+// unaudited returns a copy of a resource's metadata without its audit records, which change on every update
+func unaudited(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	if _, ok := meta.Annotations[router.HistoryAnnotation]; !ok {
+		return meta
+	}
+
+	copied := *meta.DeepCopy()
+	delete(copied.Annotations, router.HistoryAnnotation)
+
+	return copied
+}
+
+// Changes returns the diff of every resource which differs between two states of istio's resources
+func Changes(before router.IstioRouteList, after router.IstioRouteList) ([]Change, error) {
+	previous := map[string]string{}
+	for _, resource := range states(before) {
+		value, err := router.Yamlify(resource.kind, resource.meta, resource.spec)
+		if err != nil {
+			return nil, err
+		}
+		previous[fmt.Sprintf("%s/%s/%s", resource.kind, resource.meta.Namespace, resource.meta.Name)] = value
+	}
+
+	var changes []Change
+	for _, resource := range states(after) {
+		value, err := router.Yamlify(resource.kind, resource.meta, resource.spec)
+		if err != nil {
+			return nil, err
+		}
+
+		name := fmt.Sprintf("%s/%s/%s", resource.kind, resource.meta.Namespace, resource.meta.Name)
+		diff := router.UnifiedDiff(name, previous[name], value)
+		if diff != "" {
+			changes = append(changes, Change{Resource: name, Diff: diff})
+		}
+	}
+
+	return changes, nil
+}
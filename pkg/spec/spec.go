@@ -0,0 +1,205 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+)
+
+const (
+	// APIVersion is the version of the traffic spec format supported
+	APIVersion = "istiops.io/v1alpha1"
+	// Kind is the kind of the traffic spec documents
+	Kind = "TrafficSpec"
+)
+
+// Spec is the desired traffic state of istio's resources
+type Spec struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Namespace of every shift which does not set its own one
+	Namespace string      `json:"namespace,omitempty"`
+	Shifts    []ShiftSpec `json:"shifts"`
+}
+
+// ShiftSpec is the desired traffic of a single destination, the same as the flags of the 'shift' command
+type ShiftSpec struct {
+	Namespace string `json:"namespace,omitempty"`
+	// Destination is the hostname with port ('api.domain.io:8080' or 'k8s-service:8080')
+	Destination   string            `json:"destination"`
+	Build         uint32            `json:"build"`
+	LabelSelector map[string]string `json:"labelSelector"`
+	PodSelector   map[string]string `json:"podSelector"`
+	Weight        int32             `json:"weight,omitempty"`
+	Weights       map[string]int32  `json:"weights,omitempty"`
+	Match         *MatchSpec        `json:"match,omitempty"`
+	Protocol      string            `json:"protocol,omitempty"`
+	MasterRoute   string            `json:"masterRoute,omitempty"`
+}
+
+// MatchSpec are the criteria of requests served by a canary route
+type MatchSpec struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	// Regexp matches header values as regular expressions instead of exact values
+	Regexp       bool              `json:"regexp,omitempty"`
+	UriPrefix    string            `json:"uriPrefix,omitempty"`
+	UriRegex     string            `json:"uriRegex,omitempty"`
+	Method       string            `json:"method,omitempty"`
+	SourceLabels map[string]string `json:"sourceLabels,omitempty"`
+	Gateways     []string          `json:"gateways,omitempty"`
+}
+
+// Load reads and parses a traffic spec file
+func Load(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse returns a validated traffic spec from its yaml (or json) representation, refusing unknown fields
+func Parse(data []byte) (*Spec, error) {
+	j, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not parse traffic spec: %s", err))
+	}
+
+	s := &Spec{}
+	decoder := json.NewDecoder(bytes.NewReader(j))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(s)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not parse traffic spec: %s", err))
+	}
+
+	err = s.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Validate checks if a traffic spec is of a supported version and its shifts are correctly filled up
+func (s *Spec) Validate() error {
+	if s.APIVersion != APIVersion {
+		return errors.New(fmt.Sprintf("apiVersion '%s' is not supported, must be '%s'", s.APIVersion, APIVersion))
+	}
+
+	if s.Kind != Kind {
+		return errors.New(fmt.Sprintf("kind '%s' is not supported, must be '%s'", s.Kind, Kind))
+	}
+
+	if len(s.Shifts) == 0 {
+		return errors.New("traffic spec without any shift")
+	}
+
+	for i, shift := range s.Shifts {
+		err := shift.Validate()
+		if err != nil {
+			return errors.New(fmt.Sprintf("shifts[%d]: %s", i, err))
+		}
+	}
+
+	return nil
+}
+
+// Validate checks if a shift spec is correctly filled up
+func (ss ShiftSpec) Validate() error {
+	_, _, err := ss.Host()
+	if err != nil {
+		return err
+	}
+
+	if ss.Build == 0 {
+		return errors.New("empty build")
+	}
+
+	if len(ss.LabelSelector) == 0 {
+		return errors.New("empty labelSelector")
+	}
+
+	if len(ss.PodSelector) == 0 {
+		return errors.New("empty podSelector")
+	}
+
+	_, err = router.ParseMasterRoute(ss.MasterRoute)
+
+	return err
+}
+
+// Drained returns whether a shift routes no traffic to its build, having neither a weight, weights nor a match
+func (ss ShiftSpec) Drained() bool {
+	return ss.Weight == 0 && len(ss.Weights) == 0 && ss.Match == nil
+}
+
+// NamespaceOf returns the namespace of a shift, which defaults to the spec one and then to 'default'
+func (s *Spec) NamespaceOf(shift ShiftSpec) string {
+	if shift.Namespace != "" {
+		return shift.Namespace
+	}
+
+	if s.Namespace != "" {
+		return s.Namespace
+	}
+
+	return "default"
+}
+
+// Host returns the hostname and port of a shift destination
+func (ss ShiftSpec) Host() (string, uint32, error) {
+	destinationSplitted := strings.Split(ss.Destination, ":")
+	if len(destinationSplitted) != 2 {
+		return "", 0, errors.New(fmt.Sprintf("destination '%s' does not follow the format 'destination:port'", ss.Destination))
+	}
+
+	port, err := strconv.ParseUint(destinationSplitted[1], 10, 32)
+	if err != nil {
+		return "", 0, errors.New(fmt.Sprintf("invalid port of destination '%s': %s", ss.Destination, err))
+	}
+
+	return destinationSplitted[0], uint32(port), nil
+}
+
+// Shift returns the router.Shift object of a shift spec
+func (ss ShiftSpec) Shift() (router.Shift, error) {
+	hostname, port, err := ss.Host()
+	if err != nil {
+		return router.Shift{}, err
+	}
+
+	s := router.Shift{
+		Port:     port,
+		Hostname: hostname,
+		Selector: ss.LabelSelector,
+		Traffic: router.Traffic{
+			PodSelector: ss.PodSelector,
+			Exact:       true,
+			Weight:      ss.Weight,
+			Weights:     ss.Weights,
+			Protocol:    ss.Protocol,
+		},
+	}
+
+	if ss.Match != nil {
+		s.Traffic.RequestHeaders = ss.Match.Headers
+		s.Traffic.Exact = !ss.Match.Regexp
+		s.Traffic.Regexp = ss.Match.Regexp
+		s.Traffic.UriPrefix = ss.Match.UriPrefix
+		s.Traffic.UriRegex = ss.Match.UriRegex
+		s.Traffic.Method = ss.Match.Method
+		s.Traffic.SourceLabels = ss.Match.SourceLabels
+		s.Traffic.Gateways = ss.Match.Gateways
+	}
+
+	return s, nil
+}
@@ -0,0 +1,156 @@
+package spec
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+)
+
+const trafficSpec = `
+apiVersion: istiops.io/v1alpha1
+kind: TrafficSpec
+namespace: payments
+shifts:
+  - destination: api-service:5000
+    build: 3
+    labelSelector:
+      environment: pipeline-go
+    podSelector:
+      app: api
+      build: "3"
+    match:
+      headers:
+        x-email: somebody@domain.io
+      method: get
+  - destination: api-worker:6000
+    namespace: workers
+    build: 7
+    labelSelector:
+      app: api-worker
+    podSelector:
+      app: api-worker
+      build: "7"
+    weight: 20
+    masterRoute: catch-all
+`
+
+func TestParse_Unit(t *testing.T) {
+	s, err := Parse([]byte(trafficSpec))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(s.Shifts))
+	assert.Equal(t, "payments", s.NamespaceOf(s.Shifts[0]))
+	assert.Equal(t, "workers", s.NamespaceOf(s.Shifts[1]))
+
+	shift, err := s.Shifts[0].Shift()
+	assert.NoError(t, err)
+	assert.Equal(t, "api-service", shift.Hostname)
+	assert.Equal(t, uint32(5000), shift.Port)
+	assert.Equal(t, map[string]string{"environment": "pipeline-go"}, shift.Selector)
+	assert.Equal(t, map[string]string{"x-email": "somebody@domain.io"}, shift.Traffic.RequestHeaders)
+	assert.Equal(t, "get", shift.Traffic.Method)
+	assert.True(t, shift.Traffic.Exact)
+	assert.False(t, shift.Traffic.Regexp)
+
+	shift, err = s.Shifts[1].Shift()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(20), shift.Traffic.Weight)
+	assert.True(t, shift.Traffic.Exact)
+	assert.Equal(t, router.MasterRouteCatchAll, s.Shifts[1].MasterRoute)
+
+	// shifts without any weight nor match route no traffic to their build
+	assert.False(t, s.Shifts[0].Drained())
+	assert.False(t, s.Shifts[1].Drained())
+	assert.True(t, ShiftSpec{Destination: "api-service:5000", Build: 3}.Drained())
+}
+
+func TestParse_Unit_ErrorCases(t *testing.T) {
+	failureCases := []struct {
+		spec string
+		err  string
+	}{
+		{
+			"apiVersion: istiops.io/v2\nkind: TrafficSpec\n",
+			"apiVersion 'istiops.io/v2' is not supported, must be 'istiops.io/v1alpha1'",
+		},
+		{
+			"apiVersion: istiops.io/v1alpha1\nkind: Shift\n",
+			"kind 'Shift' is not supported, must be 'TrafficSpec'",
+		},
+		{
+			"apiVersion: istiops.io/v1alpha1\nkind: TrafficSpec\n",
+			"traffic spec without any shift",
+		},
+		{
+			"apiVersion: istiops.io/v1alpha1\nkind: TrafficSpec\nshifts:\n  - destination: api-service\n",
+			"shifts[0]: destination 'api-service' does not follow the format 'destination:port'",
+		},
+		{
+			"apiVersion: istiops.io/v1alpha1\nkind: TrafficSpec\nshifts:\n  - destination: api-service:5000\n    labelSelector: {app: api}\n    podSelector: {app: api}\n",
+			"shifts[0]: empty build",
+		},
+		{
+			"apiVersion: istiops.io/v1alpha1\nkind: TrafficSpec\nshifts:\n  - destination: api-service:5000\n    build: 1\n    labelSelector: {app: api}\n    podSelector: {app: api}\n    masterRoute: named\n",
+			"shifts[0]: named master-routes are not supported, HTTPRoute has no 'name' at the istio API in use",
+		},
+		{
+			"apiVersion: istiops.io/v1alpha1\nkind: TrafficSpec\nshifts:\n  - destination: api-service:5000\n    wieght: 10\n",
+			"could not parse traffic spec: json: unknown field \"wieght\"",
+		},
+	}
+
+	for _, tt := range failureCases {
+		_, err := Parse([]byte(tt.spec))
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestChanges_Unit(t *testing.T) {
+	vs := v1alpha32.VirtualService{}
+	vs.Name = "api-virtualservice"
+	vs.Namespace = "default"
+	vs.Spec.Http = []*v1alpha3.HTTPRoute{
+		{Route: []*v1alpha3.HTTPRouteDestination{{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-1-default"}}}},
+	}
+
+	dr := v1alpha32.DestinationRule{}
+	dr.Name = "api-destinationrule"
+	dr.Namespace = "default"
+
+	before := router.IstioRouteList{
+		VList: &v1alpha32.VirtualServiceList{Items: []v1alpha32.VirtualService{vs}},
+		DList: &v1alpha32.DestinationRuleList{Items: []v1alpha32.DestinationRule{dr}},
+	}
+
+	changes, err := Changes(before, before)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(changes))
+
+	updated := vs
+	updated.Spec.Http = []*v1alpha3.HTTPRoute{
+		{Route: []*v1alpha3.HTTPRouteDestination{{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-2-default"}}}},
+	}
+	after := router.IstioRouteList{
+		VList: &v1alpha32.VirtualServiceList{Items: []v1alpha32.VirtualService{updated}},
+		DList: before.DList,
+	}
+
+	changes, err = Changes(before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, "VirtualService/default/api-virtualservice", changes[0].Resource)
+	assert.Contains(t, changes[0].Diff, "-        subset: api-1-default")
+	assert.Contains(t, changes[0].Diff, "+        subset: api-2-default")
+
+	// audit records alone are not changes
+	audited := dr
+	audited.Annotations = map[string]string{router.HistoryAnnotation: "[]"}
+	after.DList = &v1alpha32.DestinationRuleList{Items: []v1alpha32.DestinationRule{audited}}
+
+	changes, err = Changes(before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(changes))
+	assert.NotContains(t, changes[0].Diff, router.HistoryAnnotation)
+}
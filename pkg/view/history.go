@@ -0,0 +1,104 @@
+package view
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/pkg/errors"
+	"istio.io/api/networking/v1alpha3"
+)
+
+// Revision is a recorded state of a virtualService, as left by one of its changes
+type Revision struct {
+	Number     int
+	Timestamp  time.Time
+	Namespace  string
+	Name       string
+	Operation  string
+	Build      uint32 `json:",omitempty"`
+	User       string
+	TrackingId string
+	// Routes are the weights of each route's destinations after the change (ex: 'api-1-default=80,api-2-default=20')
+	Routes []string
+}
+
+// Revisions returns the recorded states of a virtualService from its audit records, the newest one being the last
+// element
+func Revisions(vs v1alpha32.VirtualService) ([]Revision, error) {
+	records, err := router.AuditTrail(vs.ObjectMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []Revision
+	for _, record := range records {
+		revisions = append(revisions, Revision{
+			Number:     record.Revision,
+			Timestamp:  record.Timestamp,
+			Namespace:  vs.Namespace,
+			Name:       vs.Name,
+			Operation:  record.Operation,
+			Build:      record.Build,
+			User:       record.User,
+			TrackingId: record.TrackingId,
+			Routes:     record.Summary,
+		})
+	}
+
+	return revisions, nil
+}
+
+// SpecAt returns the whole spec of a virtualService at one of its revisions, restored from its current spec by
+// reverting the diffs of the newer revisions
+func SpecAt(vs v1alpha32.VirtualService, revision int) (*v1alpha3.VirtualService, error) {
+	records, err := router.AuditTrail(vs.ObjectMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, record := range records {
+		if record.Revision == revision {
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, errors.New(fmt.Sprintf("virtualService '%s' has no recorded revision '%d'", vs.Name, revision))
+	}
+
+	text, err := router.SpecText(&vs.Spec.VirtualService)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(records) - 1; i >= 0 && records[i].Revision > revision; i-- {
+		if records[i].Truncated {
+			return nil, errors.New(fmt.Sprintf("could not restore revision '%d' of virtualService '%s': the diff of revision '%d' is truncated", revision, vs.Name, records[i].Revision))
+		}
+
+		text, err = router.ReversePatch(text, records[i].Diff)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("could not restore revision '%d' of virtualService '%s', it was changed out of istiops: %s", revision, vs.Name, err))
+		}
+	}
+
+	spec := &v1alpha3.VirtualService{}
+	err = jsonpb.UnmarshalString(text, spec)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("could not parse revision '%d' of virtualService '%s': %s", revision, vs.Name, err))
+	}
+
+	return spec, nil
+}
+
+// SortRevisions sorts revisions of many virtualServices by time, keeping the order of simultaneous ones
+func SortRevisions(revisions []Revision) {
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Timestamp.Before(revisions[j].Timestamp)
+	})
+}
@@ -0,0 +1,98 @@
+package view
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRevisions_Integrated(t *testing.T) {
+	istioClient := istioFake.NewSimpleClientset()
+	kubeClient := kubeFake.NewSimpleClientset()
+	selector := map[string]string{"app": "api"}
+
+	vs := v1alpha32.VirtualService{}
+	vs.Name = "api-virtualservice"
+	vs.Namespace = "default"
+	vs.Labels = selector
+	vs.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api", Subset: "api-1-default"}},
+			},
+		},
+	}
+
+	dr := v1alpha32.DestinationRule{}
+	dr.Name = "api-destinationrule"
+	dr.Namespace = "default"
+	dr.Labels = selector
+	dr.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-1-default", Labels: map[string]string{"app": "api", "build": "1"}},
+	}
+
+	_, _ = istioClient.NetworkingV1alpha3().VirtualServices(vs.Namespace).Create(&vs)
+	_, _ = istioClient.NetworkingV1alpha3().DestinationRules(dr.Namespace).Create(&dr)
+
+	vsR := &router.VirtualService{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeClient, Audit: router.Audit{User: "jane"}}
+	drR := &router.DestinationRule{TrackingId: "unit-testing-uuid", Name: "api", Namespace: "default", Build: 2, Istio: istioClient, KubeClient: kubeClient, Audit: router.Audit{User: "jane"}}
+
+	shift := router.Shift{
+		Port:     5000,
+		Hostname: "api",
+		Selector: selector,
+		Traffic: router.Traffic{
+			PodSelector:    map[string]string{"app": "api", "build": "2"},
+			RequestHeaders: map[string]string{"x-version": "2"},
+			Exact:          true,
+		},
+	}
+	assert.NoError(t, drR.Update(shift))
+	assert.NoError(t, vsR.Update(shift))
+
+	shift.Traffic.RequestHeaders = nil
+	shift.Traffic.Weight = 20
+	assert.NoError(t, vsR.Update(shift))
+
+	current, _ := istioClient.NetworkingV1alpha3().VirtualServices("default").Get(vs.Name, metav1.GetOptions{})
+
+	revisions, err := Revisions(*current)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, 1, revisions[0].Number)
+	assert.Equal(t, router.OperationShift, revisions[0].Operation)
+	assert.Equal(t, uint32(2), revisions[0].Build)
+	assert.Equal(t, "jane", revisions[0].User)
+	assert.Equal(t, "unit-testing-uuid", revisions[0].TrackingId)
+	assert.Equal(t, []string{"api-2-default=100", "api-1-default=100"}, revisions[0].Routes)
+	assert.Equal(t, 2, revisions[1].Number)
+	assert.Equal(t, []string{"api-1-default=80,api-2-default=20"}, revisions[1].Routes)
+
+	spec, err := SpecAt(*current, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(spec.Http))
+	assert.Equal(t, 1, len(spec.Http[1].Route))
+
+	// revisions can't be restored once the virtualService is changed out of istiops
+	changed := current.DeepCopy()
+	changed.Spec.Http[0].Route[0].Weight = 50
+	_, err = SpecAt(*changed, 1)
+	assert.Error(t, err)
+
+	_, err = SpecAt(*current, 3)
+	assert.EqualError(t, err, "virtualService 'api-virtualservice' has no recorded revision '3'")
+
+	// resources without audit records have no revisions
+	revisions, err = Revisions(vs)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(revisions))
+}
@@ -0,0 +1,191 @@
+package view
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/router"
+	"istio.io/api/networking/v1alpha3"
+)
+
+type Subset struct {
+	Name   string
+	Labels map[string]string
+}
+
+// Deployment is the workload which manages the pods of a destination's subset, of any of router.WorkloadKinds
+type Deployment struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Pods      int32
+}
+
+type Destination struct {
+	Service    string
+	Weight     int32
+	Subset     Subset
+	Routable   bool
+	Deployment Deployment
+}
+
+type Routes struct {
+	Name         string `json:",omitempty"`
+	Protocol     string
+	Master       bool
+	Match        []*v1alpha3.HTTPMatchRequest
+	TcpMatch     []*v1alpha3.L4MatchAttributes  `json:",omitempty"`
+	TlsMatch     []*v1alpha3.TLSMatchAttributes `json:",omitempty"`
+	Destinations []Destination
+	// Mirror is the destination which requests of the route are mirrored to
+	Mirror *Destination `json:",omitempty"`
+}
+
+type Resource struct {
+	Name      string
+	Namespace string
+	Hosts     []string
+	Routes    []*Routes
+}
+
+// Structured returns the view of istio's resources and the deployments which their routes are routed to
+func Structured(trackingId string, irl router.IstioRouteList, kClient router.KubeClientInterface) []Resource {
+	var r Resource
+	var resourceList []Resource
+
+	for _, vs := range irl.VList.Items {
+		r = Resource{}
+
+		r.Name = vs.Name
+		r.Namespace = vs.Namespace
+		r.Hosts = vs.Spec.Hosts
+
+		master := router.DetectMasterRoute(&vs)
+		for _, httpValue := range vs.Spec.Http {
+			route := &Routes{Protocol: router.ProtocolHTTP, Master: master != nil && master.Matches(httpValue)}
+
+			name, err := router.OwnedRouteName(&vs, httpValue)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("%s", err), trackingId)
+			}
+			route.Name = name
+
+			for _, matchValue := range httpValue.Match {
+				route.Match = append(route.Match, matchValue)
+			}
+
+			// handle destination
+			for _, httpRoute := range httpValue.Route {
+				route.Destinations = append(route.Destinations, destination(trackingId, vs.Namespace, irl, kClient, httpRoute.Destination, httpRoute.Weight))
+			}
+
+			// every request is mirrored, as there's no mirror percent at the istio API in use
+			if httpValue.Mirror != nil {
+				mirror := destination(trackingId, vs.Namespace, irl, kClient, httpValue.Mirror, router.MirrorPercentAll)
+				route.Mirror = &mirror
+			}
+
+			r.Routes = append(r.Routes, route)
+		}
+
+		for _, tcpValue := range vs.Spec.Tcp {
+			route := &Routes{Protocol: router.ProtocolTCP, TcpMatch: tcpValue.Match}
+
+			for _, tcpRoute := range tcpValue.Route {
+				route.Destinations = append(route.Destinations, destination(trackingId, vs.Namespace, irl, kClient, tcpRoute.Destination, tcpRoute.Weight))
+			}
+
+			r.Routes = append(r.Routes, route)
+		}
+
+		for _, tlsValue := range vs.Spec.Tls {
+			route := &Routes{Protocol: router.ProtocolTLS, TlsMatch: tlsValue.Match}
+
+			for _, tlsRoute := range tlsValue.Route {
+				route.Destinations = append(route.Destinations, destination(trackingId, vs.Namespace, irl, kClient, tlsRoute.Destination, tlsRoute.Weight))
+			}
+
+			r.Routes = append(r.Routes, route)
+		}
+
+		resourceList = append(resourceList, r)
+	}
+
+	// resources of aggregated lists are grouped by namespace
+	sort.SliceStable(resourceList, func(i, j int) bool {
+		return resourceList[i].Namespace < resourceList[j].Namespace
+	})
+
+	return resourceList
+}
+
+// destination returns a route destination with its subset labels and the pods which it is routed to
+func destination(trackingId string, namespace string, irl router.IstioRouteList, kClient router.KubeClientInterface, routeDestination *v1alpha3.Destination, weight int32) Destination {
+	jr := Destination{}
+	jr.Service = fmt.Sprintf("%s:%d", routeDestination.Host, routeDestination.Port.GetNumber())
+
+	var currentWeight int32
+	if weight == 0 {
+		currentWeight = 100
+	} else {
+		currentWeight = weight
+	}
+	jr.Weight = currentWeight
+
+	subsetExists := false
+	jr.Routable = true
+	// aggregated lists have destinationRules of many namespaces, so the subset is searched among all of them
+	for _, dr := range irl.DList.Items {
+
+		// validate if subset is valid and routable
+		for _, subset := range dr.Spec.Subsets {
+			js := Subset{}
+			js.Labels = map[string]string{}
+
+			if subset.Name == routeDestination.Subset {
+				subsetExists = true
+				js.Name = subset.Name
+
+				// append pod labels
+				for labelKey, labelValue := range subset.Labels {
+					js.Labels[labelKey] = labelValue
+				}
+
+				jr.Subset.Labels = js.Labels
+				jr.Subset.Name = js.Name
+			}
+		}
+	}
+
+	// there are no pods' labels to look deployments up by
+	if !subsetExists {
+		jr.Subset.Name = routeDestination.Subset
+		jr.Routable = false
+		return jr
+	}
+
+	// validate if there are any pods to be routed, whichever workload manages them
+	namespace = router.DestinationNamespace(routeDestination.Host, namespace)
+	ready, _, err := router.ReadyPods(trackingId, kClient, namespace, jr.Subset.Labels)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("%s", err), trackingId)
+		return jr
+	}
+	jr.Deployment.Namespace = namespace
+	jr.Deployment.Pods = ready
+
+	// the workload is named when there's a single one managing the pods
+	workloads, err := router.Workloads(trackingId, kClient, namespace, jr.Subset.Labels)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("%s", err), trackingId)
+		return jr
+	}
+
+	if len(workloads) == 1 {
+		jr.Deployment.Kind = workloads[0].Kind
+		jr.Deployment.Name = workloads[0].Name
+	}
+
+	return jr
+}
@@ -0,0 +1,57 @@
+package view
+
+import (
+	"testing"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStructured_Integrated_Mirror(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-2-0", Namespace: "integration", Labels: map[string]string{"build": "2"}}}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	kubeClient := kubeFake.NewSimpleClientset(pod)
+
+	vs := v1alpha32.VirtualService{}
+	vs.Name = "api-virtualservice"
+	vs.Namespace = "integration"
+	vs.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api", Subset: "api-1-integration", Port: &v1alpha3.PortSelector{Port: &v1alpha3.PortSelector_Number{Number: 5000}}}},
+			},
+			Mirror: &v1alpha3.Destination{Host: "api", Subset: "api-2-integration", Port: &v1alpha3.PortSelector{Port: &v1alpha3.PortSelector_Number{Number: 5000}}},
+		},
+		{
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api", Subset: "api-1-integration", Port: &v1alpha3.PortSelector{Port: &v1alpha3.PortSelector_Number{Number: 5000}}}},
+			},
+		},
+	}
+
+	dr := v1alpha32.DestinationRule{}
+	dr.Namespace = "integration"
+	dr.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-1-integration", Labels: map[string]string{"build": "1"}},
+		{Name: "api-2-integration", Labels: map[string]string{"build": "2"}},
+	}
+
+	irl := router.IstioRouteList{
+		VList: &v1alpha32.VirtualServiceList{Items: []v1alpha32.VirtualService{vs}},
+		DList: &v1alpha32.DestinationRuleList{Items: []v1alpha32.DestinationRule{dr}},
+	}
+
+	resources := Structured("unit-testing-uuid", irl, kubeClient)
+	mirror := resources[0].Routes[0].Mirror
+	assert.NotNil(t, mirror)
+	assert.Equal(t, "api:5000", mirror.Service)
+	assert.Equal(t, int32(100), mirror.Weight)
+	assert.Equal(t, "api-2-integration", mirror.Subset.Name)
+	assert.Equal(t, int32(1), mirror.Deployment.Pods)
+	assert.Nil(t, resources[0].Routes[1].Mirror)
+}
@@ -0,0 +1,136 @@
+package view
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/pismo/istiops/pkg/logger"
+	"github.com/pismo/istiops/pkg/router"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Event is a new structured view of istio's resources, emitted when any of them changes
+type Event struct {
+	Time      time.Time
+	Resources []Resource
+}
+
+// Watcher watches virtualServices, destinationRules, deployments and pods, emitting the structured view of istio's
+// resources each time their routes, weights, subsets or ready pods change
+type Watcher struct {
+	TrackingId string
+	// Namespace of the watched resources, empty meaning all namespaces
+	Namespace string
+	Selector  map[string]string
+	// Get returns the current istio's resources matched by a selector, as Operator.Get
+	Get        func(selector map[string]string) (router.IstioRouteList, error)
+	Istio      router.IstioClientInterface
+	KubeClient router.KubeClientInterface
+}
+
+// Run emits the current view and then every changed one until stop is closed
+func (w *Watcher) Run(stop <-chan struct{}, emit func(Event)) error {
+	current, err := w.view()
+	if err != nil {
+		return err
+	}
+	emit(Event{Time: time.Now(), Resources: current})
+
+	changes := make(chan struct{}, 1)
+	errs := make(chan error, 1)
+
+	labelSelector, err := router.Stringify(w.TrackingId, w.Selector)
+	if err != nil {
+		return err
+	}
+
+	sources := map[string]func() (watch.Interface, error){
+		"virtualServices": func() (watch.Interface, error) {
+			return w.Istio.NetworkingV1alpha3().VirtualServices(w.Namespace).Watch(v1.ListOptions{LabelSelector: labelSelector})
+		},
+		"destinationRules": func() (watch.Interface, error) {
+			return w.Istio.NetworkingV1alpha3().DestinationRules(w.Namespace).Watch(v1.ListOptions{LabelSelector: labelSelector})
+		},
+		// subsets' deployments don't share the resources' labels, so every deployment of the namespace is watched
+		"deployments": func() (watch.Interface, error) {
+			return w.KubeClient.AppsV1().Deployments(w.Namespace).Watch(v1.ListOptions{})
+		},
+		// ready pods are counted of any workload kind, so pods are watched as well
+		"pods": func() (watch.Interface, error) {
+			return w.KubeClient.CoreV1().Pods(w.Namespace).Watch(v1.ListOptions{})
+		},
+	}
+
+	for name, source := range sources {
+		wi, err := source()
+		if err != nil {
+			return err
+		}
+		go w.forward(name, wi, source, stop, changes, errs)
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case err := <-errs:
+			return err
+		case <-changes:
+			resourceList, err := w.view()
+			if err != nil {
+				logger.Warn(fmt.Sprintf("%s", err), w.TrackingId)
+				continue
+			}
+
+			if reflect.DeepEqual(current, resourceList) {
+				continue
+			}
+
+			current = resourceList
+			emit(Event{Time: time.Now(), Resources: current})
+		}
+	}
+}
+
+// forward notifies every event of a watch as a change, watching again when it is closed by the api-server
+func (w *Watcher) forward(name string, wi watch.Interface, source func() (watch.Interface, error), stop <-chan struct{}, changes chan<- struct{}, errs chan<- error) {
+	for {
+		select {
+		case <-stop:
+			wi.Stop()
+			return
+		case _, ok := <-wi.ResultChan():
+			if !ok {
+				logger.Debug(fmt.Sprintf("Watch of %s closed, watching again", name), w.TrackingId)
+
+				var err error
+				wi, err = source()
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					return
+				}
+				continue
+			}
+
+			// pending changes are collapsed, as the whole view is rebuilt
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (w *Watcher) view() ([]Resource, error) {
+	irl, err := w.Get(w.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	return Structured(w.TrackingId, irl, w.KubeClient), nil
+}
@@ -0,0 +1,123 @@
+package view
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	v1alpha32 "github.com/aspenmesh/istio-client-go/pkg/apis/networking/v1alpha3"
+	istioFake "github.com/aspenmesh/istio-client-go/pkg/client/clientset/versioned/fake"
+	"github.com/pismo/istiops/pkg/operator"
+	"github.com/pismo/istiops/pkg/router"
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMain(m *testing.M) {
+	// discard stdout logs if not being run with '-v' flag
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func next(t *testing.T, events <-chan Event) Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event was emitted")
+	}
+
+	return Event{}
+}
+
+func TestWatcher_Integrated_Run(t *testing.T) {
+	istioClient := istioFake.NewSimpleClientset()
+	kubeClient := kubeFake.NewSimpleClientset()
+
+	selector := map[string]string{"environment": "integration-tests"}
+
+	v := v1alpha32.VirtualService{Spec: v1alpha32.VirtualServiceSpec{}}
+	v.Name = "integration-test-virtualservice"
+	v.Namespace = "integration"
+	v.Labels = selector
+	v.Spec.Http = []*v1alpha3.HTTPRoute{
+		{
+			Match: []*v1alpha3.HTTPMatchRequest{
+				{Uri: &v1alpha3.StringMatch{MatchType: &v1alpha3.StringMatch_Regex{Regex: ".+"}}},
+			},
+			Route: []*v1alpha3.HTTPRouteDestination{
+				{Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-service-1-integration"}, Weight: 100},
+			},
+		},
+	}
+
+	d := v1alpha32.DestinationRule{Spec: v1alpha32.DestinationRuleSpec{}}
+	d.Name = "integration-test-destinationrule"
+	d.Namespace = "integration"
+	d.Labels = selector
+	d.Spec.Subsets = []*v1alpha3.Subset{
+		{Name: "api-service-1-integration", Labels: map[string]string{"app": "api", "build": "1"}},
+	}
+
+	_, _ = istioClient.NetworkingV1alpha3().VirtualServices(v.Namespace).Create(&v)
+	_, _ = istioClient.NetworkingV1alpha3().DestinationRules(d.Namespace).Create(&d)
+
+	sts := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "api-1", Namespace: "integration", Labels: map[string]string{"app": "api", "build": "1"}}}
+	_, _ = kubeClient.AppsV1().StatefulSets("integration").Create(sts)
+
+	op := &operator.Istiops{
+		DrRouter: &router.DestinationRule{TrackingId: "unit-testing-uuid", Namespace: "integration", Istio: istioClient, KubeClient: kubeClient},
+		VsRouter: &router.VirtualService{TrackingId: "unit-testing-uuid", Namespace: "integration", Istio: istioClient, KubeClient: kubeClient},
+	}
+
+	w := &Watcher{
+		TrackingId: "unit-testing-uuid",
+		Namespace:  "integration",
+		Selector:   selector,
+		Get:        op.Get,
+		Istio:      istioClient,
+		KubeClient: kubeClient,
+	}
+
+	events := make(chan Event, 10)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- w.Run(stop, func(e Event) { events <- e })
+	}()
+
+	e := next(t, events)
+	assert.Equal(t, int32(0), e.Resources[0].Routes[0].Destinations[0].Deployment.Pods)
+	assert.Equal(t, "StatefulSet", e.Resources[0].Routes[0].Destinations[0].Deployment.Kind)
+	assert.Equal(t, "api-1", e.Resources[0].Routes[0].Destinations[0].Deployment.Name)
+
+	// ready pods changed
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-1-0", Namespace: "integration", Labels: map[string]string{"app": "api", "build": "1"}}}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	_, err := kubeClient.CoreV1().Pods("integration").Create(pod)
+	assert.NoError(t, err)
+
+	e = next(t, events)
+	assert.Equal(t, int32(1), e.Resources[0].Routes[0].Destinations[0].Deployment.Pods)
+
+	// weights changed
+	v.Spec.Http[0].Route[0].Weight = 80
+	v.Spec.Http[0].Route = append(v.Spec.Http[0].Route, &v1alpha3.HTTPRouteDestination{
+		Destination: &v1alpha3.Destination{Host: "api-service", Subset: "api-service-1-integration"}, Weight: 20,
+	})
+	_, err = istioClient.NetworkingV1alpha3().VirtualServices(v.Namespace).Update(&v)
+	assert.NoError(t, err)
+
+	e = next(t, events)
+	assert.Equal(t, 2, len(e.Resources[0].Routes[0].Destinations))
+	assert.Equal(t, int32(80), e.Resources[0].Routes[0].Destinations[0].Weight)
+
+	close(stop)
+	assert.NoError(t, <-done)
+}